@@ -10,12 +10,21 @@ import (
 	"time"
 
 	"github.com/ventsip/ph/engine"
+	"github.com/ventsip/ph/mqtt"
 	"github.com/ventsip/ph/server"
 )
 
 var version = "undefined"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "passwd" {
+		if err := server.Passwd(server.UsersFile, os.Args[2:], os.Stdin, os.Stderr); err != nil {
+			log.Fatalln("error setting password:", err)
+		}
+		log.Println("password set in", server.UsersFile)
+		return
+	}
+
 	log.Println(version)
 	defer log.Println("exiting.")
 
@@ -27,6 +36,11 @@ func main() {
 
 	ph := engine.NewProcessHunter(checkPeriod, balanceFile, savePeriod, engine.Kill, cfgFile)
 
+	// the balance holds the audits of the allowlist groups, needed to load the config
+	if err := ph.LoadBalance(); err != nil {
+		log.Println("error loading balance file:", err)
+	}
+
 	log.Println("config:", cfgFile)
 	if err := ph.LoadConfig(); err != nil {
 		log.Println("error loading config file:", err)
@@ -35,10 +49,6 @@ func main() {
 
 	log.Println(ph.GetLimits())
 
-	if err := ph.LoadBalance(); err != nil {
-		log.Println("error loading balance file:", err)
-	}
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -55,6 +65,8 @@ func main() {
 	go ph.Run(ctx, &wg)
 	wg.Add(1)
 	go server.Serve(ctx, &wg, ph, version, make(chan<- struct{}, 1))
+	wg.Add(1)
+	go mqtt.Run(ctx, &wg, ph)
 	wg.Wait()
 
 	if err := ph.SaveBalance(); err != nil {
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/ventsip/ph/server"
 	"golang.org/x/sys/windows/svc"
 )
 
@@ -25,12 +27,21 @@ func usage(errmsg string) {
 		"%s\n\n"+
 			"usage: %s <command>\n"+
 			"       where <command> is one of\n"+
-			"       install, remove, debug, start, stop, pause or continue.\n",
+			"       install, remove, debug, start, stop, pause, continue or passwd [user].\n",
 		errmsg, os.Args[0])
 
 	os.Exit(2)
 }
 
+// passwd sets the password of a user in the users file, next to the executable, where the service runs
+func passwd(args []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return server.Passwd(filepath.Join(filepath.Dir(exe), server.UsersFile), args, os.Stdin, os.Stderr)
+}
+
 func main() {
 	isIntSess, err := svc.IsAnInteractiveSession()
 	if err != nil {
@@ -62,6 +73,8 @@ func main() {
 		err = controlService(svcName, svc.Pause, svc.Paused)
 	case "continue":
 		err = controlService(svcName, svc.Continue, svc.Running)
+	case "passwd":
+		err = passwd(os.Args[2:])
 	default:
 		usage(fmt.Sprintf("invalid command %s", cmd))
 	}
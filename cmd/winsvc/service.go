@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/ventsip/ph/engine"
+	"github.com/ventsip/ph/mqtt"
 	"github.com/ventsip/ph/server"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/debug"
@@ -53,6 +54,11 @@ func (m *myservice) Execute(args []string, r <-chan svc.ChangeRequest, changes c
 
 	ph := engine.NewProcessHunter(checkPeriod, balanceFile, savePeriod, engine.Kill, cfgFile)
 
+	// the balance holds the audits of the allowlist groups, needed to load the config
+	if err := ph.LoadBalance(); err != nil {
+		log.Println("error loading balance file:", err)
+	}
+
 	log.Println("config:", cfgFile)
 	if err := ph.LoadConfig(); err != nil {
 		log.Println("error loading config file:", err)
@@ -61,10 +67,6 @@ func (m *myservice) Execute(args []string, r <-chan svc.ChangeRequest, changes c
 
 	log.Println(ph.GetLimits())
 
-	if err := ph.LoadBalance(); err != nil {
-		log.Println("error loading balance file:", err)
-	}
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -73,6 +75,8 @@ func (m *myservice) Execute(args []string, r <-chan svc.ChangeRequest, changes c
 	go ph.Run(ctx, &wg)
 	wg.Add(1)
 	go server.Serve(ctx, &wg, ph, version, make(chan<- struct{}))
+	wg.Add(1)
+	go mqtt.Run(ctx, &wg, ph)
 
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
@@ -116,6 +120,8 @@ func (m *myservice) Execute(args []string, r <-chan svc.ChangeRequest, changes c
 			go ph.Run(ctx, &wg)
 			wg.Add(1)
 			go server.Serve(ctx, &wg, ph, version, make(chan<- struct{}, 1))
+			wg.Add(1)
+			go mqtt.Run(ctx, &wg, ph)
 			changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
 		default:
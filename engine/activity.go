@@ -0,0 +1,82 @@
+package engine
+
+import "time"
+
+// ActivitySource tells which users are idle, e.g. away from the keyboard.
+// IdleUsers is called once per check; the users it doesn't return are considered active.
+type ActivitySource interface {
+	IdleUsers() (map[string]bool, error)
+}
+
+// dayBalance is the time balance of the processes for a day
+type dayBalance struct {
+	active    TimeBalance            // running time of the processes, while their owners were active
+	idle      TimeBalance            // running time of the processes, while their owners were idle
+	users     map[string]TimeBalance // active running time of the processes, by user
+	usersIdle map[string]TimeBalance // idle running time of the processes, by user
+	cpuIdle   map[string]TimeBalance // running time the processes didn't use enough CPU time, by group ID (CPU accounting only)
+}
+
+// of returns the running time of the process p of users (of all users, if users is empty),
+// including the idle time when idle is set
+func (db dayBalance) of(p string, users []string, idle bool) time.Duration {
+	if len(users) == 0 {
+		d := db.active[p]
+		if idle {
+			d = d + db.idle[p]
+		}
+		return d
+	}
+
+	d := time.Duration(0)
+	for _, u := range users {
+		d = d + db.users[u][p]
+		if idle {
+			d = d + db.usersIdle[u][p]
+		}
+	}
+	return d
+}
+
+// dayBalance returns the time balance of the processes for the day
+func (ph *ProcessHunter) dayBalance(day string) dayBalance {
+	return dayBalance{
+		active:    ph.balance[day],
+		idle:      ph.idle[day],
+		users:     ph.users.day(day),
+		usersIdle: ph.usersIdle.day(day),
+		cpuIdle:   ph.cpuIdle.day(day),
+	}
+}
+
+// SetActivitySource sets the source of user activity. All users are considered active when a is nil.
+func (ph *ProcessHunter) SetActivitySource(a ActivitySource) {
+	ph.limitsRWM.Lock()
+	defer ph.limitsRWM.Unlock()
+
+	ph.activitySource = a
+}
+
+// idleUsers returns the set of the idle owners of processes, according to ph.activitySource
+func (ph *ProcessHunter) idleUsers(processes []processInfo) map[string]bool {
+	ph.limitsRWM.RLock()
+	a := ph.activitySource
+	ph.limitsRWM.RUnlock()
+
+	idle := make(map[string]bool)
+	if a == nil {
+		return idle
+	}
+
+	// all the users are considered active when their activity is not known
+	users, err := a.IdleUsers()
+	if err != nil {
+		return idle
+	}
+	for _, p := range processes {
+		if p.user != "" && users[p.user] {
+			idle[p.user] = true
+		}
+	}
+	return idle
+}
@@ -0,0 +1,90 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// logindActivity is an ActivitySource that uses the IdleHint of the users in systemd-logind
+type logindActivity struct{}
+
+// defaultActivitySource returns the ActivitySource of the OS, or nil if loginctl is not available
+func defaultActivitySource() ActivitySource {
+	if _, err := exec.LookPath("loginctl"); err != nil {
+		return nil
+	}
+	return logindActivity{}
+}
+
+// IdleUsers returns the idle users, as per logind. Only the users with a session are queried,
+// with two runs of loginctl, whatever the number of the users.
+func (logindActivity) IdleUsers() (map[string]bool, error) {
+	out, err := exec.Command("loginctl", "list-users", "--no-legend").Output()
+	if err != nil {
+		return nil, err
+	}
+	users := parseUsers(string(out))
+	if len(users) == 0 {
+		return map[string]bool{}, nil
+	}
+
+	args := append([]string{"show-user", "--property=Name", "--property=IdleHint"}, users...)
+	out, err = exec.Command("loginctl", args...).Output()
+	// a user who logged out meanwhile fails the command, but the others are still shown
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return parseIdleHints(string(out))
+}
+
+// parseUsers parses the names of the users listed by loginctl list-users --no-legend, one per line: UID USER [LINGER STATE]
+func parseUsers(s string) []string {
+	var users []string
+	for _, line := range strings.Split(s, "\n") {
+		if f := strings.Fields(line); len(f) >= 2 {
+			users = append(users, f[1])
+		}
+	}
+	return users
+}
+
+// parseIdleHints parses the Name and IdleHint properties of users, as shown by loginctl show-user
+// (a block of NAME=VALUE lines per user, separated by empty lines), and returns the idle users
+func parseIdleHints(s string) (map[string]bool, error) {
+	idle := make(map[string]bool)
+	for _, block := range strings.Split(s, "\n\n") {
+		props := make(map[string]string)
+		for _, line := range strings.Split(block, "\n") {
+			if k, v, ok := strings.Cut(line, "="); ok {
+				props[k] = v
+			}
+		}
+		name, ok := props["Name"]
+		if !ok {
+			continue
+		}
+		i, err := parseIdleHint(props["IdleHint"])
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", name, err)
+		}
+		if i {
+			idle[name] = true
+		}
+	}
+	return idle, nil
+}
+
+// parseIdleHint parses the value of the logind IdleHint property
+func parseIdleHint(s string) (bool, error) {
+	switch strings.TrimSpace(s) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("bad IdleHint: %q", s)
+}
@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIdleHint(t *testing.T) {
+	for s, e := range map[string]bool{"yes\n": true, "no\n": false} {
+		idle, err := parseIdleHint(s)
+		if err != nil || idle != e {
+			t.Error("parseIdleHint", s, "returned", idle, err)
+		}
+	}
+	if _, err := parseIdleHint(""); err == nil {
+		t.Error("parsed empty IdleHint")
+	}
+}
+
+func TestParseUsers(t *testing.T) {
+	users := parseUsers(" 1000 alice no active\n1001 bob\n\n")
+	if !reflect.DeepEqual(users, []string{"alice", "bob"}) {
+		t.Error("unexpected users", users)
+	}
+}
+
+func TestParseIdleHints(t *testing.T) {
+	idle, err := parseIdleHints("Name=alice\nIdleHint=yes\n\nIdleHint=no\nName=bob\n")
+	if err != nil || !reflect.DeepEqual(idle, map[string]bool{"alice": true}) {
+		t.Error("unexpected idle users", idle, err)
+	}
+	if _, err := parseIdleHints("Name=alice\nIdleHint=maybe\n"); err == nil {
+		t.Error("parsed a bad IdleHint")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package engine
+
+// defaultActivitySource returns nil, since user activity is not supported on this OS
+func defaultActivitySource() ActivitySource {
+	return nil
+}
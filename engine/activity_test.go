@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"context"
+	"os/user"
+	"testing"
+	"time"
+)
+
+// fakeActivity is an ActivitySource with fixed idle users
+type fakeActivity map[string]bool
+
+func (f fakeActivity) IdleUsers() (map[string]bool, error) {
+	return f, nil
+}
+
+func TestIdleUsers(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	ph.SetActivitySource(fakeActivity{"alice": true, "bob": false})
+
+	idle := ph.idleUsers([]processInfo{{user: "alice"}, {user: "bob"}, {user: "carol"}, {user: ""}})
+	if !idle["alice"] || idle["bob"] || idle["carol"] || idle[""] {
+		t.Error("unexpected idle users", idle)
+	}
+}
+
+func TestEvaluateGroupsIdle(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "games", PG: []string{"game"}, DL: DayLimits{"*": time.Hour}},
+		{ID: "all", PG: []string{"game"}, DL: DayLimits{"*": time.Hour}, CountIdle: true},
+		{ID: "alice", PG: []string{"game"}, DL: DayLimits{"*": time.Hour}, CountIdle: true, Users: []string{"alice"}},
+	}
+	db := dayBalance{
+		active:    TimeBalance{"game": time.Minute * 40},
+		idle:      TimeBalance{"game": time.Minute * 30},
+		users:     map[string]TimeBalance{"alice": {"game": time.Minute * 10}},
+		usersIdle: map[string]TimeBalance{"alice": {"game": time.Minute * 30}},
+	}
+
+	pgbs := evaluateGroups(groups, db, overrides{}, now)
+
+	for i, e := range []time.Duration{time.Minute * 40, time.Minute * 70, time.Minute * 40} {
+		if pgbs[i].Balance.Duration != e {
+			t.Error("group", pgbs[i].ID, "balance", pgbs[i].Balance, "expected", e)
+		}
+	}
+	if pgbs[0].Overtime || !pgbs[1].Overtime || pgbs[2].Overtime {
+		t.Error("idle time not counted as configured", pgbs)
+	}
+}
+
+func TestCheckProcessesIdle(t *testing.T) {
+	u, err := user.Current()
+	if err != nil {
+		t.Skip("current user unknown:", err)
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, func(int) error { return nil }, "")
+	ph.SetActivitySource(fakeActivity{u.Username: true})
+	ph.SetSessionSource(nil)
+
+	err = ph.checkProcesses(context.Background(), time.Minute)
+	if err != nil {
+		t.Fatal("checkProcesses failed:", err)
+	}
+
+	date := toText(time.Now())
+	if len(ph.usersIdle[u.Username][date]) == 0 {
+		t.Skip("process owners are not supported on this OS")
+	}
+	if len(ph.users[u.Username][date]) != 0 {
+		t.Error("running time of an idle user accounted as active:", ph.users[u.Username][date])
+	}
+}
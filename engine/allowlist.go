@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GroupTypeAllowlist is the type of process groups whose processes are the only ones
+// that the target users may run, while the group's limit or downtime applies
+const GroupTypeAllowlist = "allowlist"
+
+// AllowlistPreview is the result of the audit of an allowlist process group.
+// It lists the processes that would have been killed, if the allowlist applied during the audit.
+type AllowlistPreview struct {
+	Group       string              `json:"group"`       // Group is the ID of the allowlist group
+	Fingerprint string              `json:"fingerprint"` // Fingerprint identifies the allowlist and the target users that were audited
+	Since       time.Time           `json:"since"`       // Since is when the audit started
+	Updated     time.Time           `json:"updated"`     // Updated is when the audit was last updated
+	Processes   map[string][]string `json:"processes"`   // Processes maps target users to the processes that would have been killed
+}
+
+// isAllowlist returns whether g is an allowlist group
+func (g ProcessGroupDayLimit) isAllowlist() bool {
+	return g.Type == GroupTypeAllowlist
+}
+
+// fingerprint identifies the allowlist and the target users of g
+func (g ProcessGroupDayLimit) fingerprint() string {
+	pg, users := slices.Clone(g.PG), slices.Clone(g.Users)
+	slices.Sort(pg)
+	slices.Sort(users)
+
+	h := sha256.Sum256([]byte(strings.Join(pg, "\n") + "\n\n" + strings.Join(users, "\n")))
+	return hex.EncodeToString(h[:8])
+}
+
+// disallowed returns the processes that the allowlist group g would kill:
+// the processes owned by the target users, that are not in the allowlist and are not protected
+func (g ProcessGroupDayLimit) disallowed(processes []processInfo, protected map[int]bool, protectedNames []string) []processInfo {
+	var victims []processInfo
+	for _, p := range processes {
+		if !slices.Contains(g.Users, p.user) || slices.Contains(g.PG, p.name) {
+			continue
+		}
+		if protected[p.pid] || isProtectedName(p.name, protectedNames) {
+			continue
+		}
+		victims = append(victims, p)
+	}
+	return victims
+}
+
+// auditAllowlist records victims - the processes that the allowlist group g would kill - in the audit preview of g.
+// The preview starts over when the allowlist or the target users of g change.
+func (ph *ProcessHunter) auditAllowlist(g ProcessGroupDayLimit, victims []processInfo, now time.Time) {
+	ph.auditsRWM.Lock()
+	defer ph.auditsRWM.Unlock()
+
+	id, fp := g.GroupID(), g.fingerprint()
+
+	ap, ok := ph.audits[id]
+	if !ok || ap.Fingerprint != fp {
+		ap = AllowlistPreview{Group: id, Fingerprint: fp, Since: now, Processes: make(map[string][]string)}
+	}
+	ap.Updated = now
+
+	for _, v := range victims {
+		if !slices.Contains(ap.Processes[v.user], v.name) {
+			ap.Processes[v.user] = append(ap.Processes[v.user], v.name)
+			slices.Sort(ap.Processes[v.user])
+		}
+	}
+
+	ph.audits[id] = ap
+}
+
+// checkAllowlists returns an error if cfg enforces an allowlist group, that has not been audited
+// with the same allowlist and target users
+func (ph *ProcessHunter) checkAllowlists(cfg Config) error {
+	ph.auditsRWM.RLock()
+	defer ph.auditsRWM.RUnlock()
+
+	for _, g := range cfg.groups() {
+		if !g.isAllowlist() || !g.Enforce {
+			continue
+		}
+		if ap, ok := ph.audits[g.GroupID()]; !ok || ap.Fingerprint != g.fingerprint() {
+			return fmt.Errorf("allowlist group %s cannot be enforced before it is audited: "+
+				"set \"enforce\" to false and review the processes it would kill at /audit", g.GroupID())
+		}
+	}
+
+	return nil
+}
+
+// GetAllowlistPreviews returns the audit previews of the allowlist groups
+func (ph *ProcessHunter) GetAllowlistPreviews() []AllowlistPreview {
+	ph.auditsRWM.RLock()
+	defer ph.auditsRWM.RUnlock()
+
+	aps := make([]AllowlistPreview, 0, len(ph.audits))
+	for _, ap := range ph.audits {
+		aps = append(aps, ap)
+	}
+	slices.SortFunc(aps, func(a, b AllowlistPreview) int { return strings.Compare(a.Group, b.Group) })
+
+	return aps
+}
+
+// enforceAllowlist audits the allowlist group g, or kills the processes it disallows,
+// when g is enforced and its limit or downtime (or of a parent group) applies, as per pgb.
+// It returns ctx.Err() if ctx is cancelled.
+func (ph *ProcessHunter) enforceAllowlist(ctx context.Context, g ProcessGroupDayLimit, pgb ProcessGroupDayBalance, processes []processInfo, protected map[int]bool, now time.Time) error {
+	victims := g.disallowed(processes, protected, ph.config.Protected)
+
+	if !g.Enforce {
+		ph.auditAllowlist(g, victims, now)
+		if pgb.BlockedBy != "" && len(victims) > 0 {
+			log.Println(pgb.ID, "allowlist audit: would kill", len(victims), "processes")
+		}
+		return nil
+	}
+
+	if pgb.BlockedBy == "" {
+		return nil
+	}
+
+	log.Println(pgb.ID, "allowlist applies for", g.Users, "blocked by", pgb.BlockedBy)
+	for _, v := range victims {
+		if err := ph.kill(ctx, pgb.ID, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAllowlistDisallowed(t *testing.T) {
+	g := ProcessGroupDayLimit{Type: GroupTypeAllowlist, Users: []string{"kid"}, PG: []string{"homework"}}
+
+	processes := []processInfo{
+		{pid: 10, name: "homework", user: "kid"},
+		{pid: 11, name: "game", user: "kid"},
+		{pid: 12, name: "game", user: "parent"},
+		{pid: 13, name: "gnome-shell", user: "kid"},
+		{pid: 14, name: "shell", user: "kid"},
+		{pid: 15, name: "tool", user: "kid"},
+	}
+
+	victims := g.disallowed(processes, map[int]bool{14: true}, []string{"tool"})
+
+	if !reflect.DeepEqual(victims, []processInfo{{pid: 11, name: "game", user: "kid"}}) {
+		t.Error("wrong processes disallowed by the allowlist:", victims)
+	}
+}
+
+func TestAllowlistAuditBeforeEnforce(t *testing.T) {
+	const (
+		audited  = `[{"id": "bedtime", "type": "allowlist", "users": ["kid"], "processes": ["homework"], "downtime": {"*": [".."]}}]`
+		enforced = `[{"id": "bedtime", "type": "allowlist", "users": ["kid"], "processes": ["homework"], "downtime": {"*": [".."]}, "enforce": true}]`
+		changed  = `[{"id": "bedtime", "type": "allowlist", "users": ["kid"], "processes": ["homework", "game"], "downtime": {"*": [".."]}, "enforce": true}]`
+	)
+
+	var killed []int
+	f := func(pid int) error {
+		killed = append(killed, pid)
+		return nil
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, f, "")
+
+	if ph.SetConfig([]byte(enforced)) == nil {
+		t.Error("enforced an allowlist group before it was audited")
+	}
+
+	err := ph.SetConfig([]byte(audited))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	processes := []processInfo{{pid: 10, name: "homework", user: "kid"}, {pid: 11, name: "game", user: "kid"}}
+	now := time.Now()
+	g := ph.GetLimits()[0]
+	pgb := evaluateGroups(ph.GetLimits(), dayBalance{active: TimeBalance{}}, overrides{}, now)[0]
+
+	err = ph.enforceAllowlist(context.Background(), g, pgb, processes, nil, now)
+	if err != nil {
+		t.Error("enforceAllowlist failed:", err)
+	}
+	if len(killed) != 0 {
+		t.Error("killed processes in audit mode:", killed)
+	}
+
+	aps := ph.GetAllowlistPreviews()
+	if len(aps) != 1 || !reflect.DeepEqual(aps[0].Processes, map[string][]string{"kid": {"game"}}) {
+		t.Error("wrong audit preview:", aps)
+	}
+
+	if ph.SetConfig([]byte(changed)) == nil {
+		t.Error("enforced an allowlist group that was audited with another allowlist")
+	}
+
+	err = ph.SetConfig([]byte(enforced))
+	if err != nil {
+		t.Fatal("Could not enforce audited allowlist group:", err)
+	}
+
+	g = ph.GetLimits()[0]
+	err = ph.enforceAllowlist(context.Background(), g, pgb, processes, nil, now)
+	if err != nil {
+		t.Error("enforceAllowlist failed:", err)
+	}
+	if !reflect.DeepEqual(killed, []int{11}) {
+		t.Error("wrong processes killed by the allowlist:", killed)
+	}
+}
+
+func TestParseConfigAllowlist(t *testing.T) {
+	invalid := []string{
+		`[{"type": "allowlist", "processes": ["homework"], "downtime": {"*": [".."]}}]`,
+		`[{"type": "allowlist", "users": ["kid"], "processes": ["homework"], "downtime": {"*": [".."]}, "allow_protected": true}]`,
+		`[{"type": "blocklist", "processes": ["game"], "downtime": {"*": [".."]}}]`,
+		`[{"processes": ["game"], "downtime": {"*": [".."]}, "enforce": true}]`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"slices"
+	"time"
+)
+
+// AccountingCPU is the accounting mode of process groups that count the running time of their processes as usage
+// only while the processes use CPU time above a threshold
+const AccountingCPU = "cpu"
+
+// defaultCPUThreshold is the CPU threshold (percent of the running time) of the groups with CPU accounting,
+// when not configured
+const defaultCPUThreshold = 1.0
+
+// cpuThreshold returns the CPU threshold (percent) of group g, and whether g has CPU accounting
+func (g ProcessGroupDayLimit) cpuThreshold() (float64, bool) {
+	if g.Accounting != AccountingCPU {
+		return 0, false
+	}
+	if g.CPUThreshold == 0 {
+		return defaultCPUThreshold, true
+	}
+	return g.CPUThreshold, true
+}
+
+// cpuGrowth returns the CPU time used by each of the processes since the previous call (by PID).
+// The first call that sees a process takes its CPU time as the baseline, and returns zero growth for it.
+// Processes with unknown CPU time are left out.
+func (ph *ProcessHunter) cpuGrowth(processes []processInfo) map[int]time.Duration {
+	growth := make(map[int]time.Duration)
+	cpuTimes := make(map[int]time.Duration)
+	for _, p := range processes {
+		if !p.cpuKnown {
+			continue
+		}
+		cpuTimes[p.pid] = p.cpu
+
+		g := time.Duration(0)
+		if prev, ok := ph.cpuTimes[p.pid]; ok && prev <= p.cpu {
+			g = p.cpu - prev
+		}
+		growth[p.pid] = g
+	}
+	ph.cpuTimes = cpuTimes
+
+	return growth
+}
+
+// isBusy returns whether process p used enough CPU time during dt, to count dt as usage,
+// as per the CPU threshold th (percent) and its CPU time growth. Processes with unknown CPU time are always busy.
+func isBusy(p processInfo, dt time.Duration, th float64, growth map[int]time.Duration) bool {
+	g, known := growth[p.pid]
+	if !known {
+		return true
+	}
+
+	return float64(g) >= float64(dt)*th/100
+}
+
+// lowCPU returns the processes of the groups with CPU accounting that didn't use enough CPU time during dt,
+// as per the CPU threshold of each group (see isBusy): their PIDs, by group ID
+func lowCPU(groups []ProcessGroupDayLimit, processes []processInfo, dt time.Duration, growth map[int]time.Duration) map[string]map[int]bool {
+	m := make(map[string]map[int]bool)
+	for _, g := range groups {
+		th, ok := g.cpuThreshold()
+		if !ok {
+			continue
+		}
+
+		pids := make(map[int]bool)
+		for _, p := range processes {
+			if g.includes(p.user) && slices.Contains(g.PG, p.name) && !isBusy(p, dt, th, growth) {
+				pids[p.pid] = true
+			}
+		}
+		m[g.GroupID()] = pids
+	}
+	return m
+}
+
+// GetCPUHistory returns the daily CPU time used by the processes
+func (ph *ProcessHunter) GetCPUHistory() dayTimeBalance {
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+
+	return ph.cpu
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLowCPU(t *testing.T) {
+	groups := []ProcessGroupDayLimit{
+		{ID: "launchers", PG: []string{"steam", "game"}, Accounting: AccountingCPU, CPUThreshold: 5},
+		{ID: "games", PG: []string{"game"}, Accounting: AccountingCPU},
+		{ID: "video", PG: []string{"player"}},
+	}
+	processes := []processInfo{
+		{pid: 1, name: "steam"},
+		{pid: 2, name: "game"},
+		{pid: 3, name: "player"},
+	}
+
+	// 3 seconds of CPU time in 3 minutes is below 5%, and above 1%
+	growth := map[int]time.Duration{1: time.Second * 3, 2: time.Second * 3, 3: 0}
+	low := lowCPU(groups, processes, time.Minute*3, growth)
+	if len(low) != 2 || !low["launchers"][1] || !low["launchers"][2] || len(low["games"]) != 0 {
+		t.Error("unexpected processes with low CPU time", low)
+	}
+}
+
+func TestCPUGrowth(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+
+	processes := []processInfo{
+		{pid: 1, name: "steam", cpu: time.Second * 10, cpuKnown: true},
+		{pid: 2, name: "game", cpu: time.Second * 20, cpuKnown: true},
+		{pid: 3, name: "player"},
+	}
+	growth := ph.cpuGrowth(processes)
+	if len(growth) != 2 || growth[1] != 0 || growth[2] != 0 {
+		t.Error("unexpected CPU growth of new processes", growth)
+	}
+
+	processes[0].cpu = time.Second * 11
+	processes[1].cpu = time.Second * 50
+	growth = ph.cpuGrowth(processes)
+	if growth[1] != time.Second || growth[2] != time.Second*30 {
+		t.Error("unexpected CPU growth", growth)
+	}
+
+	// 1 second of CPU time in 3 minutes is below 5%, 30 seconds is above 1%
+	dt := time.Minute * 3
+	if isBusy(processes[0], dt, 5, growth) || !isBusy(processes[1], dt, 1, growth) || !isBusy(processes[2], dt, 5, growth) {
+		t.Error("unexpected busy processes")
+	}
+}
+
+func TestCPUIdleBalance(t *testing.T) {
+	db := dayBalance{
+		active:  TimeBalance{"steam": time.Hour},
+		idle:    TimeBalance{"steam": time.Minute * 30},
+		cpuIdle: map[string]TimeBalance{"launchers": {"steam": time.Minute * 40}},
+	}
+
+	// the time without enough CPU time is not counted, even by groups that count idle time
+	launchers := ProcessGroupDayLimit{ID: "launchers", PG: []string{"steam"}, Accounting: AccountingCPU, CountIdle: true}
+	if d := launchers.balance(db); d != time.Minute*50 {
+		t.Error("unexpected balance of a group with CPU accounting", d)
+	}
+	// other groups with the same processes count it
+	all := ProcessGroupDayLimit{ID: "all", PG: []string{"steam"}}
+	if d := all.balance(db); d != time.Hour {
+		t.Error("unexpected balance of a group without CPU accounting", d)
+	}
+}
+
+func TestParseConfigAccounting(t *testing.T) {
+	_, err := parseConfig([]byte(`[{"processes": ["steam"], "limits": {"*": "1h"}, "accounting": "cpu", "cpu_threshold": 2.5}]`))
+	if err != nil {
+		t.Error("rejected cpu accounting", err)
+	}
+
+	invalid := []string{
+		`[{"processes": ["steam"], "limits": {"*": "1h"}, "accounting": "gpu"}]`,
+		`[{"processes": ["steam"], "limits": {"*": "1h"}, "accounting": "cpu", "cpu_threshold": -1}]`,
+		`[{"processes": ["steam"], "limits": {"*": "1h"}, "cpu_threshold": 1}]`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DiscoveredProcess describes the usage of a process that doesn't belong to any process group
+type DiscoveredProcess struct {
+	Name      string         `json:"process"`    // Name is the process name
+	Balance   prettyDuration `json:"balance"`    // Balance is the total running time in the date range
+	Days      int            `json:"days"`       // Days is the number of days in the date range when the process was running
+	FirstSeen string         `json:"first_seen"` // FirstSeen is the first date in the balance history when the process was running
+	New       bool           `json:"new"`        // New indicates whether the process was first seen recently
+}
+
+// Discover ranks the processes that don't belong to any process group by their running time
+// between the dates from and to (inclusive), highest first.
+// Processes first seen in the last newDays days (including today) are flagged as new.
+func (ph *ProcessHunter) Discover(from time.Time, to time.Time, newDays int) []DiscoveredProcess {
+	ph.limitsRWM.RLock()
+	matched := groupedProcesses(ph.limits)
+	ph.limitsRWM.RUnlock()
+
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+
+	f, t := toText(from), toText(to)
+	recent := toText(time.Now().AddDate(0, 0, 1-newDays))
+
+	found := make(map[string]*DiscoveredProcess)
+	for day, tb := range ph.balance {
+		for p, d := range tb {
+			if matched[p] || d <= 0 {
+				continue
+			}
+
+			dp, ok := found[p]
+			if !ok {
+				dp = &DiscoveredProcess{Name: p, FirstSeen: day}
+				found[p] = dp
+			}
+			if day < dp.FirstSeen {
+				dp.FirstSeen = day
+			}
+			if f <= day && day <= t {
+				dp.Balance.Duration = dp.Balance.Duration + d
+				dp.Days++
+			}
+		}
+	}
+
+	dps := make([]DiscoveredProcess, 0, len(found))
+	for _, dp := range found {
+		if dp.Days == 0 {
+			continue
+		}
+		dp.New = newDays > 0 && dp.FirstSeen >= recent
+		dp.Balance.Duration = dp.Balance.Round(time.Second)
+		dps = append(dps, *dp)
+	}
+
+	slices.SortFunc(dps, func(a, b DiscoveredProcess) int {
+		if a.Balance != b.Balance {
+			if a.Balance.Duration > b.Balance.Duration {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return dps
+}
+
+// AddProcessToGroup adds process to the process group with ID groupID (which can be a group of a profile)
+// and applies (and saves) the modified configuration, like SetConfig does
+func (ph *ProcessHunter) AddProcessToGroup(process string, groupID string) error {
+	if process == "" {
+		return errors.New("process name required")
+	}
+
+	return ph.updateConfig(func(cfg *Config) error {
+		for _, g := range cfg.groups() {
+			if slices.Contains(g.PG, process) {
+				return fmt.Errorf("process %s already belongs to a process group", process)
+			}
+		}
+
+		// copy the groups (and the profiles), so that the current configuration is not modified
+		cfg.Groups = slices.Clone(cfg.Groups)
+		cfg.Profiles = slices.Clone(cfg.Profiles)
+
+		groups := cfg.Groups
+		group := slices.IndexFunc(groups, func(g ProcessGroupDayLimit) bool { return g.GroupID() == groupID })
+		for i := 0; group < 0 && i < len(cfg.Profiles); i++ {
+			pr := &cfg.Profiles[i]
+			if id, ok := strings.CutPrefix(groupID, pr.User+"."); ok {
+				pr.Groups = slices.Clone(pr.Groups)
+				groups = pr.Groups
+				group = slices.IndexFunc(groups, func(g ProcessGroupDayLimit) bool { return g.GroupID() == id })
+			}
+		}
+		if group < 0 {
+			return fmt.Errorf("process group %s does not exist", groupID)
+		}
+
+		groups[group].PG = append(slices.Clone(groups[group].PG), process)
+		return nil
+	})
+}
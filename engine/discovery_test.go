@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiscover(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	ph.limits = []ProcessGroupDayLimit{
+		{PG: []string{"game"}, DL: DayLimits{"*": time.Hour}},
+	}
+
+	now := time.Now()
+	today := toText(now)
+	yesterday := toText(now.AddDate(0, 0, -1))
+	longAgo := toText(now.AddDate(0, 0, -30))
+
+	ph.balance.add(today, "game", time.Hour)
+	ph.balance.add(today, "newgame", time.Minute*20)
+	ph.balance.add(yesterday, "newgame", time.Minute*20)
+	ph.balance.add(today, "browser", time.Minute*30)
+	ph.balance.add(longAgo, "browser", time.Hour)
+	ph.balance.add(longAgo, "oldgame", time.Hour)
+
+	dps := ph.Discover(now.AddDate(0, 0, -6), now, 7)
+
+	if len(dps) != 2 {
+		t.Fatal("expected 2 discovered processes, got", dps)
+	}
+	if dps[0].Name != "newgame" || dps[0].Balance.Duration != time.Minute*40 || dps[0].Days != 2 || !dps[0].New {
+		t.Error("wrong first discovered process:", dps[0])
+	}
+	if dps[1].Name != "browser" || dps[1].Balance.Duration != time.Minute*30 || dps[1].New || dps[1].FirstSeen != longAgo {
+		t.Error("wrong second discovered process:", dps[1])
+	}
+}
+
+func TestAddProcessToGroup(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`[{"processes": ["p1"], "limits": {"*": "1h"}}, {"processes": ["p2"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	err = ph.AddProcessToGroup("p3", "p2")
+	if err != nil {
+		t.Error("Could not add process to a group:", err)
+	}
+
+	limits := ph.GetLimits()
+	if len(limits[1].PG) != 2 || limits[1].PG[1] != "p3" || len(limits[0].PG) != 1 {
+		t.Error("process not added to the group correctly:", limits)
+	}
+
+	if ph.AddProcessToGroup("p1", "p2") == nil {
+		t.Error("added a process that already belongs to a group")
+	}
+	if ph.AddProcessToGroup("p4", "p5") == nil {
+		t.Error("added a process to a group that does not exist")
+	}
+}
+
+func TestAddProcessesConcurrently(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	if err := ph.SetConfig([]byte(`[{"id": "games", "processes": ["p0"], "limits": {"*": "1h"}}]`)); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ph.AddProcessToGroup(fmt.Sprint("p", i), "games"); err != nil {
+				t.Error("Could not add process to a group:", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if limits := ph.GetLimits(); len(limits[0].PG) != 11 {
+		t.Error("processes added concurrently were lost:", limits[0].PG)
+	}
+}
+
+func TestAddProcessToProfileGroup(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`{"groups": [{"processes": ["p1"], "limits": {"*": "1h"}}],
+		"profiles": [{"user": "alice", "groups": [{"id": "games", "processes": ["p2"], "limits": {"*": "1h"}}]}]}`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	err = ph.AddProcessToGroup("p3", "alice.games")
+	if err != nil {
+		t.Error("Could not add process to a profile group:", err)
+	}
+
+	cfg := ph.GetConfig()
+	if pg := cfg.Profiles[0].Groups[0].PG; len(pg) != 2 || pg[1] != "p3" || len(cfg.Groups[0].PG) != 1 {
+		t.Error("process not added to the profile group correctly:", cfg)
+	}
+
+	if ph.AddProcessToGroup("p4", "bob.games") == nil {
+		t.Error("added a process to a group that does not exist")
+	}
+}
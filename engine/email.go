@@ -0,0 +1,346 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	emailPeriod     = 30 * time.Second // how often the pending events are emailed, and the digest time is checked
+	maxEmailPending = 100              // the most events kept for the next email
+)
+
+// defaultEmailEvents are the types of events emailed by default:
+// the groups that became blocked, the processes started again after a kill, configuration changes,
+// and the requests for more time
+var defaultEmailEvents = []string{EventBlock, EventRespawn, EventConfig, EventRequest}
+
+// Email configures the email notifications and the daily digest
+type Email struct {
+	Server   string   `json:"server"`             // Server is the address of the SMTP server (host:port)
+	StartTLS bool     `json:"starttls"`           // StartTLS requires upgrading the connection to TLS with STARTTLS
+	Username string   `json:"username,omitempty"` // Username authenticates to the server with PLAIN authentication, if set
+	Password string   `json:"password,omitempty"` // Password is the password of Username
+	From     string   `json:"from"`               // From is the sender address
+	To       []string `json:"to"`                 // To lists the recipient addresses
+	Events   []string `json:"events,omitempty"`   // Events lists the types of events to email (see defaultEmailEvents)
+	Digest   string   `json:"digest,omitempty"`   // Digest is the time of day (HH:MM) when the daily digest is sent; no digest if empty
+}
+
+// digestData is the data of the daily digest templates
+type digestData struct {
+	Date      string
+	Groups    []ProcessGroupDayBalance
+	Processes []processTime
+	Kills     int
+}
+
+// processTime is the running time of a process
+type processTime struct {
+	Name    string
+	Balance time.Duration
+}
+
+// eventsSubject, eventsText and eventsHTML are the templates of the event emails, executed with the events
+var (
+	eventsSubject = template.Must(template.New("subject").Parse(
+		`ph: {{len .}} new event{{if gt (len .) 1}}s{{end}}`))
+	eventsText = template.Must(template.New("text").Parse(
+		`{{range .}}{{.Time.Format "15:04:05"}} {{.Type}}{{with .Group}} {{.}}{{end}}{{with .User}} {{.}}{{end}}{{with .Process}} {{.}}{{end}}{{with .Message}}: {{.}}{{end}}
+{{end}}`))
+	eventsHTML = htmltemplate.Must(htmltemplate.New("html").Parse(
+		`<table>{{range .}}<tr><td>{{.Time.Format "15:04:05"}}</td><td>{{.Type}}</td><td>{{.Group}}</td><td>{{.User}}</td><td>{{.Process}}</td><td>{{.Message}}</td></tr>{{end}}</table>`))
+)
+
+// digestSubject, digestText and digestHTML are the templates of the daily digest, executed with digestData
+var (
+	digestSubject = template.Must(template.New("subject").Parse(`ph: daily digest {{.Date}}`))
+	digestText    = template.Must(template.New("text").Parse(
+		`Process groups on {{.Date}}:
+{{range .Groups}}{{.ID}}: {{.Balance}}{{if .LimitDefined}} of {{.Limit}}{{end}}{{if .BlockedBy}}, blocked by {{.BlockedBy}}{{end}}
+{{end}}
+Processes:
+{{range .Processes}}{{.Name}}: {{.Balance}}
+{{end}}
+Processes killed: {{.Kills}}
+`))
+	digestHTML = htmltemplate.Must(htmltemplate.New("html").Parse(
+		`<h2>Process groups on {{.Date}}</h2>
+<table>{{range .Groups}}<tr><td>{{.ID}}</td><td>{{.Balance}}{{if .LimitDefined}} of {{.Limit}}{{end}}</td><td>{{with .BlockedBy}}blocked by {{.}}{{end}}</td></tr>{{end}}</table>
+<h2>Processes</h2>
+<table>{{range .Processes}}<tr><td>{{.Name}}</td><td>{{.Balance}}</td></tr>{{end}}</table>
+<p>Processes killed: {{.Kills}}</p>`))
+)
+
+// mailer emails the events and the daily digest
+type mailer struct {
+	mu         sync.Mutex
+	cfg        *Email
+	pending    []Event
+	lastDigest string                            // the date of the last digest
+	send       func(cfg Email, msg []byte) error // sends the message msg
+}
+
+// newMailer returns a mailer that sends the messages with sendMail
+func newMailer() *mailer {
+	return &mailer{send: sendMail}
+}
+
+// set sets the email configuration; emails are not sent when cfg is nil
+func (m *mailer) set(cfg *Email) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cfg = cfg
+}
+
+// enqueue adds e to the pending events, if its type is emailed
+func (m *mailer) enqueue(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cfg == nil {
+		return
+	}
+	events := m.cfg.Events
+	if events == nil {
+		events = defaultEmailEvents
+	}
+	if !slices.Contains(events, e.Type) {
+		return
+	}
+	if len(m.pending) >= maxEmailPending {
+		log.Println("too many events to email, dropping", e.Type, "event")
+		return
+	}
+	m.pending = append(m.pending, e)
+}
+
+// flush emails the pending events, if any
+func (m *mailer) flush() error {
+	m.mu.Lock()
+	cfg, events := m.cfg, m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	if cfg == nil || len(events) == 0 {
+		return nil
+	}
+
+	msg, err := message(*cfg, eventsSubject, eventsText, eventsHTML, events, time.Now())
+	if err != nil {
+		return err
+	}
+	return m.send(*cfg, msg)
+}
+
+// digestDue returns whether the digest of the day of now is due, and marks it as sent if so
+func (m *mailer) digestDue(now time.Time) (Email, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cfg == nil || m.cfg.Digest == "" {
+		return Email{}, false
+	}
+	at, err := time.Parse(dtTimeFormat, m.cfg.Digest)
+	if err != nil || now.Format(dtTimeFormat) < at.Format(dtTimeFormat) {
+		return Email{}, false
+	}
+
+	date := toText(now)
+	if m.lastDigest == date {
+		return Email{}, false
+	}
+	m.lastDigest = date
+	return *m.cfg, true
+}
+
+// digest returns the digest of the day of now
+func (ph *ProcessHunter) digest(now time.Time) digestData {
+	date := toText(now)
+	d := digestData{Date: date, Groups: ph.GetLatestPGroupsBalance()}
+
+	ph.balanceRWM.RLock()
+	for name, b := range ph.balance[date] {
+		d.Processes = append(d.Processes, processTime{name, b.Round(time.Second)})
+	}
+	ph.balanceRWM.RUnlock()
+	sort.Slice(d.Processes, func(i, j int) bool {
+		if d.Processes[i].Balance == d.Processes[j].Balance {
+			return d.Processes[i].Name < d.Processes[j].Name
+		}
+		return d.Processes[i].Balance > d.Processes[j].Balance
+	})
+
+	for _, e := range ph.GetEvents() {
+		if e.Type == EventKill && toText(e.Time) == date {
+			d.Kills++
+		}
+	}
+	return d
+}
+
+// sendDigest emails the daily digest, if it's due at now
+func (ph *ProcessHunter) sendDigest(now time.Time) error {
+	cfg, due := ph.mailer.digestDue(now)
+	if !due {
+		return nil
+	}
+
+	msg, err := message(cfg, digestSubject, digestText, digestHTML, ph.digest(now), now)
+	if err != nil {
+		return err
+	}
+	return ph.mailer.send(cfg, msg)
+}
+
+// runEmail emails the pending events and the daily digest periodically, until ctx is cancelled
+func (ph *ProcessHunter) runEmail(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// don't send the digest of today again, when ph starts after the digest time
+	if _, due := ph.mailer.digestDue(time.Now()); due {
+		log.Println("skipping the daily digest of today")
+	}
+
+	ticker := time.NewTicker(emailPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := ph.mailer.flush(); err != nil {
+				log.Println("error sending email:", err)
+			}
+			return
+		case <-ticker.C:
+		}
+
+		if err := ph.mailer.flush(); err != nil {
+			log.Println("error sending email:", err)
+		}
+		if err := ph.sendDigest(time.Now()); err != nil {
+			log.Println("error sending the daily digest:", err)
+		}
+	}
+}
+
+// message returns the email message with the subject and the text and HTML bodies, executed with data
+func message(cfg Email, subject *template.Template, text *template.Template, html *htmltemplate.Template, data any, now time.Time) ([]byte, error) {
+	var s, t, h bytes.Buffer
+	if err := subject.Execute(&s, data); err != nil {
+		return nil, err
+	}
+	if err := text.Execute(&t, data); err != nil {
+		return nil, err
+	}
+	if err := html.Execute(&h, data); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	fmt.Fprintf(&b, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(cfg.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", s.String()))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+
+	for _, part := range []struct {
+		ctype string
+		body  []byte
+	}{{"text/plain", t.Bytes()}, {"text/html", h.Bytes()}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.ctype + "; charset=utf-8"}})
+		if err != nil {
+			return nil, err
+		}
+		w.Write(part.body)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// sendMail sends msg to the recipients of cfg, through the SMTP server of cfg
+func sendMail(cfg Email, msg []byte) error {
+	host, _, err := net.SplitHostPort(cfg.Server)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", cfg.Server, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if cfg.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("the SMTP server doesn't support STARTTLS")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		// PlainAuth refuses to send the password without TLS, unless the server is on localhost
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return err
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range cfg.To {
+		rcpt, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		if err := c.Rcpt(rcpt.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
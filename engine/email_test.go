@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP is a plaintext SMTP server that records the messages it receives
+type fakeSMTP struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	auth     []string // the decoded AUTH PLAIN credentials
+	from     []string
+	rcpt     []string
+	messages []string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("cannot listen", err)
+	}
+	s := &fakeSMTP{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.Fields(line + " ")[0])
+		s.mu.Lock()
+		switch cmd {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			b, _ := base64.StdEncoding.DecodeString(strings.Fields(line)[2])
+			s.auth = append(s.auth, string(b))
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			s.from = append(s.from, line)
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.rcpt = append(s.rcpt, line)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			b, _ := io.ReadAll(tp.DotReader())
+			s.messages = append(s.messages, string(b))
+			tp.PrintfLine("250 ok")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *fakeSMTP) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func TestEmailEvents(t *testing.T) {
+	s := newFakeSMTP(t)
+
+	m := newMailer()
+	m.set(&Email{Server: s.ln.Addr().String(), Username: "ph", Password: "pw",
+		From: "ph <ph@example.com>", To: []string{"parent@example.com"}})
+
+	now := time.Now()
+	m.enqueue(Event{Time: now, Type: EventKill, Process: "game"})
+	m.enqueue(Event{Time: now, Type: EventBlock, Group: "games", Message: "limit reached"})
+	m.enqueue(Event{Time: now, Type: EventConfig, Message: "config changed"})
+
+	if err := m.flush(); err != nil {
+		t.Fatal("cannot send email", err)
+	}
+	msgs := s.received()
+	if len(msgs) != 1 {
+		t.Fatal("expected one batched email, got", len(msgs))
+	}
+	msg := msgs[0]
+	for _, want := range []string{"Subject: ph: 2 new events", "text/plain", "text/html", "games", "config changed"} {
+		if !strings.Contains(msg, want) {
+			t.Error("email does not contain", want, ":", msg)
+		}
+	}
+	if strings.Contains(msg, "game\r\n") || strings.Contains(msg, EventKill) {
+		t.Error("email contains an event that is not selected:", msg)
+	}
+
+	s.mu.Lock()
+	if len(s.auth) != 1 || s.auth[0] != "\x00ph\x00pw" {
+		t.Error("unexpected credentials", s.auth)
+	}
+	if len(s.from) != 1 || !strings.Contains(s.from[0], "<ph@example.com>") ||
+		len(s.rcpt) != 1 || !strings.Contains(s.rcpt[0], "<parent@example.com>") {
+		t.Error("unexpected envelope", s.from, s.rcpt)
+	}
+	s.mu.Unlock()
+
+	// nothing pending, nothing sent
+	if err := m.flush(); err != nil || len(s.received()) != 1 {
+		t.Error("sent an email without events", err)
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	s := newFakeSMTP(t)
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	ph.mailer.set(&Email{Server: s.ln.Addr().String(), From: "ph@example.com", To: []string{"parent@example.com"}, Digest: "20:00"})
+
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 20:30", time.Local)
+	ph.balance[toText(now)] = TimeBalance{"game": time.Hour, "editor": time.Minute * 10}
+	ph.emit(Event{Time: now, Type: EventKill, Process: "game"})
+
+	if err := ph.sendDigest(now.Add(-time.Hour)); err != nil || len(s.received()) != 0 {
+		t.Error("sent the digest before its time", err)
+	}
+	if err := ph.sendDigest(now); err != nil {
+		t.Fatal("cannot send the digest", err)
+	}
+	if err := ph.sendDigest(now.Add(time.Minute)); err != nil {
+		t.Error("cannot send the digest", err)
+	}
+
+	msgs := s.received()
+	if len(msgs) != 1 {
+		t.Fatal("expected one digest, got", len(msgs))
+	}
+	for _, want := range []string{"daily digest 2024-01-10", "game: 1h0m0s", "editor: 10m0s", "Processes killed: 1"} {
+		if !strings.Contains(msgs[0], want) {
+			t.Error("digest does not contain", want, ":", msgs[0])
+		}
+	}
+	if strings.Index(msgs[0], "game: ") > strings.Index(msgs[0], "editor: ") {
+		t.Error("processes are not sorted by time:", msgs[0])
+	}
+}
+
+func TestEmailStartTLS(t *testing.T) {
+	s := newFakeSMTP(t)
+
+	err := sendMail(Email{Server: s.ln.Addr().String(), StartTLS: true, From: "ph@example.com", To: []string{"parent@example.com"}}, []byte("test"))
+	if err == nil {
+		t.Error("sent an email without STARTTLS")
+	}
+	if len(s.received()) != 0 {
+		t.Error("sent an email without STARTTLS")
+	}
+}
+
+func TestParseConfigEmail(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"groups": [], "email": {"server": "smtp.example.com:587", "starttls": true,
+		"from": "ph <ph@example.com>", "to": ["parent@example.com"], "digest": "20:00"}}`)); err != nil {
+		t.Error("rejected email settings", err)
+	}
+
+	invalid := []string{
+		`{"groups": [], "email": {"server": "smtp.example.com", "from": "ph@example.com", "to": ["parent@example.com"]}}`,
+		`{"groups": [], "email": {"server": "smtp.example.com:25", "from": "ph", "to": ["parent@example.com"]}}`,
+		`{"groups": [], "email": {"server": "smtp.example.com:25", "from": "ph@example.com", "to": []}}`,
+		`{"groups": [], "email": {"server": "smtp.example.com:25", "from": "ph@example.com", "to": ["parent@example.com"], "digest": "8pm"}}`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
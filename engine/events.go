@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"log"
+	"slices"
+	"time"
+)
+
+// Types of events
+const (
+	EventKill            = "kill"             // a process was killed
+	EventKillFailed      = "kill_failed"      // a process could not be killed
+	EventRespawn         = "respawn"          // a process started again shortly after it was killed
+	EventWarning         = "warning"          // the processes of a group are about to be killed
+	EventBlock           = "block"            // a group became blocked, by its own limit or downtime, or by those of a parent group
+	EventUnblock         = "unblock"          // a group is no longer blocked
+	EventSessionWarning  = "session_warning"  // the session time of a user is about to run out
+	EventSessionEnd      = "session_end"      // the sessions of a user were ended, since the session limit or downtime applies
+	EventConfig          = "config"           // the configuration was changed, or reloaded from the config file
+	EventLoginFailed     = "login_failed"     // a login to the web UI or the API failed
+	EventLockout         = "lockout"          // a client was locked out after too many failed logins
+	EventRequest         = "request"          // a user requested more time for a group
+	EventRequestApproved = "request_approved" // a request for more time was approved, and the time granted
+	EventRequestDenied   = "request_denied"   // a request for more time was denied
+)
+
+// maxEvents is how many of the latest events are kept
+const maxEvents = 100
+
+// Event describes something that ph did, or is about to do, e.g. killing a process or ending a user session
+type Event struct {
+	Time    time.Time `json:"time"`              // Time is when the event happened
+	Type    string    `json:"type"`              // Type is the type of the event, e.g. EventKill
+	Group   string    `json:"group,omitempty"`   // Group is the ID of the process group involved
+	User    string    `json:"user,omitempty"`    // User is the user involved
+	Process string    `json:"process,omitempty"` // Process is the name of the process involved
+	PID     int       `json:"pid,omitempty"`     // PID is the ID of the process involved
+	Message string    `json:"message,omitempty"` // Message describes the event
+}
+
+// emit logs e, records it in the latest events and sends it to the webhooks and the mailer
+func (ph *ProcessHunter) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	log.Println(e.Type, e.Group, e.User, e.Process, e.PID, e.Message)
+	ph.webhooks.enqueue(e)
+	ph.mailer.enqueue(e)
+
+	ph.eventsRWM.Lock()
+	defer ph.eventsRWM.Unlock()
+
+	ph.events = append(ph.events, e)
+	if len(ph.events) > maxEvents {
+		ph.events = slices.Clone(ph.events[len(ph.events)-maxEvents:])
+	}
+}
+
+// Emit emits event e of another package, e.g. a failed login to the web UI
+func (ph *ProcessHunter) Emit(e Event) {
+	ph.emit(e)
+}
+
+// GetEvents returns the latest events, oldest first
+func (ph *ProcessHunter) GetEvents() []Event {
+	ph.eventsRWM.RLock()
+	defer ph.eventsRWM.RUnlock()
+
+	return append(make([]Event, 0, len(ph.events)), ph.events...)
+}
@@ -0,0 +1,126 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// constants of the Linux process connector (see linux/connector.h and linux/cn_proc.h)
+const (
+	cnIdxProc         = 1 // CN_IDX_PROC
+	cnValProc         = 1 // CN_VAL_PROC
+	procCnMcastListen = 1 // PROC_CN_MCAST_LISTEN
+	procEventExec     = 2 // PROC_EVENT_EXEC
+	cnMsgLen          = 20
+)
+
+// execEvents listens to the exec notifications of the Linux process connector,
+// and returns a channel with the names of the processes that start. It requires CAP_NET_ADMIN.
+// The channel is closed when ctx is cancelled, or the notifications cannot be received.
+func execEvents(ctx context.Context) (<-chan string, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM, syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, err
+	}
+
+	// time out the receive calls, so that ctx is checked regularly
+	tv := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	if err := syscall.Sendto(fd, listenMessage(), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	names := make(chan string, 64)
+	go func() {
+		defer close(names)
+		defer syscall.Close(fd)
+
+		buf := make([]byte, os.Getpagesize())
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			if err != nil {
+				log.Println("error receiving exec notifications:", err)
+				return
+			}
+
+			msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+			for _, m := range msgs {
+				pid, ok := parseExecEvent(m.Data)
+				if !ok {
+					continue
+				}
+				b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+				if err != nil {
+					continue
+				}
+				select {
+				case names <- strings.TrimSpace(string(b)):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return names, nil
+}
+
+// listenMessage returns the netlink message that subscribes to the notifications of the process connector
+func listenMessage() []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN+cnMsgLen+4)
+
+	// nlmsghdr
+	binary.NativeEndian.PutUint32(b[0:], uint32(len(b)))
+	binary.NativeEndian.PutUint16(b[4:], syscall.NLMSG_DONE)
+	binary.NativeEndian.PutUint32(b[12:], uint32(os.Getpid()))
+
+	// cn_msg, followed by the operation
+	c := b[syscall.NLMSG_HDRLEN:]
+	binary.NativeEndian.PutUint32(c[0:], cnIdxProc)
+	binary.NativeEndian.PutUint32(c[4:], cnValProc)
+	binary.NativeEndian.PutUint16(c[16:], 4)
+	binary.NativeEndian.PutUint32(c[cnMsgLen:], procCnMcastListen)
+
+	return b
+}
+
+// parseExecEvent returns the process ID of the exec event in data (cn_msg followed by proc_event),
+// and whether data is an exec event
+func parseExecEvent(data []byte) (int, bool) {
+	// proc_event: what, cpu, timestamp_ns, and then exec_proc_event: process_pid, process_tgid
+	if len(data) < cnMsgLen+24 {
+		return 0, false
+	}
+
+	e := data[cnMsgLen:]
+	if binary.NativeEndian.Uint32(e[0:]) != procEventExec {
+		return 0, false
+	}
+	return int(binary.NativeEndian.Uint32(e[20:])), true
+}
@@ -0,0 +1,29 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseExecEvent(t *testing.T) {
+	data := make([]byte, cnMsgLen+40)
+	e := data[cnMsgLen:]
+	binary.NativeEndian.PutUint32(e[0:], procEventExec)
+	binary.NativeEndian.PutUint32(e[16:], 1234)
+	binary.NativeEndian.PutUint32(e[20:], 1230)
+
+	if pid, ok := parseExecEvent(data); !ok || pid != 1230 {
+		t.Error("parseExecEvent returned", pid, ok)
+	}
+
+	binary.NativeEndian.PutUint32(e[0:], 1) // PROC_EVENT_FORK
+	if _, ok := parseExecEvent(data); ok {
+		t.Error("parsed a fork event as exec")
+	}
+	if _, ok := parseExecEvent(data[:cnMsgLen+8]); ok {
+		t.Error("parsed a short event")
+	}
+}
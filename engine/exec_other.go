@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+// execEvents is not supported on this OS
+func execEvents(ctx context.Context) (<-chan string, error) {
+	return nil, errors.New("exec notifications are not supported")
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultFastCheck is how often the processes of the blocked process groups are checked, unless configured otherwise
+const defaultFastCheck = 5 * time.Second
+
+// blockedGroup is a process group with processes that are blocked, and the names of those processes
+type blockedGroup struct {
+	g     ProcessGroupDayLimit
+	names []string
+}
+
+// fastPeriod returns how often the processes of the blocked process groups are checked, and whether the fast checks are enabled
+func (ph *ProcessHunter) fastPeriod() (time.Duration, bool) {
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+
+	if ph.config.FastCheck == "" {
+		return defaultFastCheck, true
+	}
+	d, err := time.ParseDuration(ph.config.FastCheck)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+// blockedGroups returns the process groups with blocked processes, as of the latest check.
+// The processes blocked by a group are the same that checkProcesses kills.
+// ph.limitsRWM and ph.pgroupsRWM must be locked by the caller.
+func (ph *ProcessHunter) blockedGroups() []blockedGroup {
+	if len(ph.pgroups) != len(ph.limits) {
+		return nil
+	}
+
+	var bgs []blockedGroup
+	for i, g := range ph.limits {
+		pgb := ph.pgroups[i]
+		if pgb.ID != g.GroupID() || !g.isEnabled() {
+			continue
+		}
+		switch {
+		case g.isAllowlist():
+			if pgb.BlockedBy == "" && len(pgb.BlockedPG) > 0 {
+				bgs = append(bgs, blockedGroup{g, pgb.BlockedPG})
+			}
+		case pgb.BlockedBy != "":
+			bgs = append(bgs, blockedGroup{g, g.PG})
+		case len(pgb.BlockedPG) > 0:
+			bgs = append(bgs, blockedGroup{g, pgb.BlockedPG})
+		}
+	}
+	return bgs
+}
+
+// blockedNames returns the names of the blocked processes, as of the latest check
+func (ph *ProcessHunter) blockedNames() map[string]bool {
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+	ph.pgroupsRWM.RLock()
+	defer ph.pgroupsRWM.RUnlock()
+
+	names := make(map[string]bool)
+	for _, bg := range ph.blockedGroups() {
+		for _, n := range bg.names {
+			names[n] = true
+		}
+	}
+	return names
+}
+
+// fastCheck kills the running processes of the blocked process groups (as of the latest check),
+// including the ones that didn't run yet today, e.g. a game started for the first time during downtime.
+// Unlike checkProcesses, it doesn't list the processes in full and doesn't update the time balance.
+// It returns ctx.Err() if ctx is cancelled.
+func (ph *ProcessHunter) fastCheck(ctx context.Context) error {
+	names := ph.blockedNames()
+	if len(names) == 0 {
+		return nil
+	}
+
+	processes, err := scanProcesses(names)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	ph.balanceRWM.Lock()
+	defer ph.balanceRWM.Unlock()
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+	defer ph.notifyKills()
+	ph.pgroupsRWM.RLock()
+	defer ph.pgroupsRWM.RUnlock()
+
+	pt := newProcessTable(processes, protectedPIDs(processes, ph.config.ProtectedPIDs))
+	for _, bg := range ph.blockedGroups() {
+		for _, name := range bg.names {
+			if err := ph.killNamed(ctx, bg.g, name, pt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// runFast is a goroutine that runs fastCheck periodically (see Settings.FastCheck),
+// and when a blocked process starts, if exec notifications are enabled (see Settings.Netlink)
+func (ph *ProcessHunter) runFast(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	period, enabled := ph.fastPeriod()
+	if !enabled {
+		period = ph.checkPeriod
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	var execs <-chan string
+	netlink := false
+	for {
+		ph.limitsRWM.RLock()
+		useNetlink := ph.config.Netlink
+		ph.limitsRWM.RUnlock()
+
+		// exec notifications are started once, when first enabled
+		if useNetlink && !netlink {
+			netlink = true
+			var err error
+			if execs, err = execEvents(ctx); err != nil {
+				log.Println("error listening for exec notifications:", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case name, ok := <-execs:
+			if !ok {
+				execs = nil
+			} else if ph.blockedNames()[name] {
+				ph.fastCheck(ctx)
+			}
+		case <-ticker.C:
+			if enabled {
+				ph.fastCheck(ctx)
+			}
+		}
+
+		if p, e := ph.fastPeriod(); p != period || e != enabled {
+			period, enabled = p, e
+			if !enabled {
+				p = ph.checkPeriod
+			}
+			ticker.Reset(p)
+		}
+	}
+}
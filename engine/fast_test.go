@@ -0,0 +1,102 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFastCheck(t *testing.T) {
+	cmds, err := startTestProcesses(t, testProcess1, testProcess2)
+	if err != nil {
+		t.Error("Cannot start test processes", err)
+	}
+	defer stopTestProcesses(t, cmds)
+
+	var killed []int
+	f := func(pid int) error {
+		killed = append(killed, pid)
+		return nil
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, f, "")
+	err = ph.SetConfig([]byte(`[
+		{"processes": ["test_process1", "test_process1.exe"], "limits": {"*": "0s"}},
+		{"processes": ["test_process2", "test_process2.exe"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	if err := ph.fastCheck(context.Background()); err != nil || len(killed) != 0 {
+		t.Error("fast check before the first check killed", killed, err)
+	}
+
+	if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+		t.Error("checkProcesses failed", err)
+	}
+	if !slices.Equal(killed, []int{cmds[0].Process.Pid}) {
+		t.Error("expected to kill", cmds[0].Process.Pid, "killed", killed)
+	}
+
+	// the process is still running (the killer is fake), as if it was started again
+	killed = nil
+	if err := ph.fastCheck(context.Background()); err != nil {
+		t.Error("fastCheck failed", err)
+	}
+	if !slices.Equal(killed, []int{cmds[0].Process.Pid}) {
+		t.Error("expected the fast check to kill", cmds[0].Process.Pid, "killed", killed)
+	}
+}
+
+func TestFastCheckWithoutBalance(t *testing.T) {
+	var killed []int
+	f := func(pid int) error {
+		killed = append(killed, pid)
+		return nil
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, f, "")
+	err := ph.SetConfig([]byte(`[{"id": "games", "processes": ["test_process1", "test_process1.exe"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	if err := ph.Block("games", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("Block failed", err)
+	}
+	// the group is blocked before the process runs for the first time today
+	if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+		t.Error("checkProcesses failed", err)
+	}
+
+	cmds, err := startTestProcesses(t, testProcess1)
+	if err != nil {
+		t.Error("Cannot start test processes", err)
+	}
+	defer stopTestProcesses(t, cmds)
+
+	if err := ph.fastCheck(context.Background()); err != nil {
+		t.Error("fastCheck failed", err)
+	}
+	if !slices.Equal(killed, []int{cmds[0].Process.Pid}) {
+		t.Error("expected the fast check to kill", cmds[0].Process.Pid, "without balance, killed", killed)
+	}
+}
+
+func TestParseConfigFastCheck(t *testing.T) {
+	tests := []struct {
+		cfg   string
+		valid bool
+	}{
+		{`{"groups": [], "fast_check": "2s"}`, true},
+		{`{"groups": [], "fast_check": "0s"}`, true},
+		{`{"groups": [], "fast_check": "2"}`, false},
+		{`{"groups": [], "fast_check": "-1s"}`, false},
+		{`{"groups": [], "netlink": true}`, true},
+	}
+	for _, tc := range tests {
+		if _, err := parseConfig([]byte(tc.cfg)); (err == nil) != tc.valid {
+			t.Error("config", tc.cfg, "expected valid", tc.valid, "error", err)
+		}
+	}
+}
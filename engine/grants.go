@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Grant lets the processes of a process group (and of its child groups) run until the grant expires,
+// regardless of the limits and downtime of the group and of its parent groups
+type Grant struct {
+	Group   string    `json:"group"`            // Group is the ID of the process group
+	Expires time.Time `json:"expires"`          // Expires is when the grant ends
+	Reason  string    `json:"reason,omitempty"` // Reason describes why the grant was given
+}
+
+// AddGrant grants the process group with ID group d more time from now, and forces a process check.
+// A grant of a group that has an active grant extends it.
+func (ph *ProcessHunter) AddGrant(group string, d time.Duration, reason string) (Grant, error) {
+	if d <= 0 {
+		return Grant{}, errors.New("grant duration must be positive")
+	}
+
+	ph.balanceRWM.Lock()
+	defer ph.balanceRWM.Unlock()
+
+	gr, err := ph.addGrant(group, d, reason, time.Now())
+	if err != nil {
+		return Grant{}, err
+	}
+
+	if ph.balancePath != "" {
+		if err := ph.saveBalance(); err != nil {
+			log.Println("error saving balance to", ph.balancePath, ":", err)
+		}
+	}
+	ph.force()
+	ph.publish(UpdateGrant)
+
+	return gr, nil
+}
+
+// addGrant grants the process group with ID group d more time from now. ph.balanceRWM must be locked by the caller.
+func (ph *ProcessHunter) addGrant(group string, d time.Duration, reason string, now time.Time) (Grant, error) {
+	if !ph.hasGroup(group) {
+		return Grant{}, fmt.Errorf("process group %s not found", group)
+	}
+
+	gr := Grant{Group: group, Expires: now.Add(d), Reason: reason}
+	if e, ok := activeGrants(ph.grants, now)[group]; ok {
+		gr.Expires = e.Add(d)
+	}
+	ph.grants = append(ph.grants, gr)
+	log.Println("granted", group, "until", gr.Expires.Format(time.DateTime), reason)
+
+	return gr, nil
+}
+
+// GetGrants returns the active grants
+func (ph *ProcessHunter) GetGrants() []Grant {
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+
+	now := time.Now()
+	grants := []Grant{}
+	for _, gr := range ph.grants {
+		if gr.Expires.After(now) {
+			grants = append(grants, gr)
+		}
+	}
+	return grants
+}
+
+// activeGrants returns when the grants of the groups that have active grants (as of now) expire, by group ID
+func activeGrants(grants []Grant, now time.Time) map[string]time.Time {
+	active := make(map[string]time.Time)
+	for _, gr := range grants {
+		if gr.Expires.After(now) && gr.Expires.After(active[gr.Group]) {
+			active[gr.Group] = gr.Expires
+		}
+	}
+	return active
+}
+
+// hasGroup returns whether the process group with ID group is configured
+func (ph *ProcessHunter) hasGroup(group string) bool {
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+
+	return slices.ContainsFunc(ph.limits, func(g ProcessGroupDayLimit) bool { return g.GroupID() == group })
+}
+
+// pruneGrants removes the expired grants
+func (ph *ProcessHunter) pruneGrants(now time.Time) {
+	ph.grants = slices.DeleteFunc(ph.grants, func(gr Grant) bool { return !gr.Expires.After(now) })
+}
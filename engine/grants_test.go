@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvaluateGroupsGrants(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "screen", DL: DayLimits{"*": time.Hour}},
+		{ID: "games", Parent: "screen", PG: []string{"game"}, DT: Downtime{"*": {"11:00..13:00"}}},
+		{ID: "video", Parent: "screen", PG: []string{"player"}, PL: map[string]ProcessDayLimit{"player": {DL: DayLimits{"*": time.Minute}}}},
+	}
+	tb := TimeBalance{"game": time.Hour, "player": time.Hour}
+
+	grants := map[string]time.Time{"games": now.Add(time.Minute * 30), "video": now.Add(time.Minute * 10)}
+	pgbs := evaluateGroups(groups, dayBalance{active: tb}, overrides{grants: grants}, now)
+
+	for i, e := range []string{"screen", "", ""} {
+		if pgbs[i].BlockedBy != e {
+			t.Error("group", pgbs[i].ID, "blocked by", pgbs[i].BlockedBy, "expected", e)
+		}
+	}
+	if len(pgbs[2].BlockedPG) != 0 {
+		t.Error("blocked processes of a group with a grant", pgbs[2].BlockedPG)
+	}
+	if pgbs[1].GrantedUntil == nil || !pgbs[1].GrantedUntil.Equal(grants["games"]) {
+		t.Error("unexpected grant expiry", pgbs[1].GrantedUntil)
+	}
+}
+
+func TestAddGrant(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balance.json")
+	ph := NewProcessHunter(time.Hour, path, time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`[{"id": "games", "processes": ["game"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	if _, err := ph.AddGrant("movies", time.Hour, ""); err == nil {
+		t.Error("granted time to a group that doesn't exist")
+	}
+	if _, err := ph.AddGrant("games", 0, ""); err == nil {
+		t.Error("accepted a grant without duration")
+	}
+
+	g1, err := ph.AddGrant("games", time.Minute*30, "homework done")
+	if err != nil {
+		t.Fatal("AddGrant failed", err)
+	}
+	g2, err := ph.AddGrant("games", time.Minute*15, "")
+	if err != nil {
+		t.Fatal("AddGrant failed", err)
+	}
+	if !g2.Expires.Equal(g1.Expires.Add(time.Minute * 15)) {
+		t.Error("the second grant didn't extend the first one", g1.Expires, g2.Expires)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Error("grants were not saved", err)
+	}
+	ph = NewProcessHunter(time.Hour, path, time.Hour, nil, "")
+	if err := ph.LoadBalance(); err != nil {
+		t.Fatal("LoadBalance failed", err)
+	}
+	if grants := ph.GetGrants(); len(grants) != 2 || grants[0].Reason != "homework done" {
+		t.Error("unexpected grants after loading the balance", grants)
+	}
+}
+
+func TestBlock(t *testing.T) {
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`[
+		{"id": "screen", "processes": [], "limits": {"*": "1h"}},
+		{"id": "games", "parent": "screen", "processes": ["non.existing.game"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	if err := ph.Block("movies", time.Now().Add(time.Hour)); err == nil {
+		t.Error("blocked a group that doesn't exist")
+	}
+	if err := ph.Block("screen", time.Now().Add(-time.Hour)); err == nil {
+		t.Error("accepted a block that ends in the past")
+	}
+	if err := ph.Block("screen", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("Block failed", err)
+	}
+	// a grant doesn't lift a manual block
+	if _, err := ph.AddGrant("games", time.Hour, ""); err != nil {
+		t.Fatal("AddGrant failed", err)
+	}
+
+	if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+		t.Error("checkProcesses failed", err)
+	}
+	for _, pgb := range ph.GetLatestPGroupsBalance() {
+		if pgb.BlockedBy != "screen" {
+			t.Error("group", pgb.ID, "blocked by", pgb.BlockedBy, "expected screen")
+		}
+	}
+
+	if err := ph.Unblock("screen"); err != nil {
+		t.Fatal("Unblock failed", err)
+	}
+	if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+		t.Error("checkProcesses failed", err)
+	}
+	for _, pgb := range ph.GetLatestPGroupsBalance() {
+		if pgb.BlockedBy != "" {
+			t.Error("group", pgb.ID, "blocked by", pgb.BlockedBy, "after unblock")
+		}
+	}
+	if len(ph.GetBlocks()) != 0 {
+		t.Error("unexpected blocks", ph.GetBlocks())
+	}
+}
+
+func TestEvaluateGroupsReasons(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "screen", DL: DayLimits{"*": time.Hour}},
+		{ID: "games", Parent: "screen", PG: []string{"game"}},
+		{ID: "video", PG: []string{"player"}, DT: Downtime{"*": {"11:00..13:00"}}},
+		{ID: "music", PG: []string{"radio"}},
+	}
+	tb := TimeBalance{"game": time.Hour * 2}
+
+	pgbs := evaluateGroups(groups, dayBalance{active: tb}, overrides{blocks: map[string]time.Time{"music": now.Add(time.Hour)}}, now)
+	for i, e := range []string{BlockLimit, BlockLimit, BlockDowntime, BlockManual} {
+		if pgbs[i].BlockReason != e {
+			t.Error("group", pgbs[i].ID, "blocked for", pgbs[i].BlockReason, "expected", e)
+		}
+	}
+
+	lockdown := now.Add(time.Hour * 2)
+	pgbs = evaluateGroups(groups, dayBalance{active: tb}, overrides{lockdown: lockdown, grants: map[string]time.Time{"games": now.Add(time.Hour)}}, now)
+	for _, pgb := range pgbs {
+		if pgb.BlockedBy != pgb.ID || pgb.BlockReason != BlockLockdown || pgb.BlockedUntil == nil || !pgb.BlockedUntil.Equal(lockdown) {
+			t.Error("group", pgb.ID, "not locked down:", pgb.BlockedBy, pgb.BlockReason, pgb.BlockedUntil)
+		}
+	}
+
+	// a manual block that outlasts the lockdown is reported as manual
+	block := now.Add(time.Hour * 3)
+	pgbs = evaluateGroups(groups, dayBalance{active: tb}, overrides{lockdown: lockdown, blocks: map[string]time.Time{"music": block}}, now)
+	for i, e := range []string{BlockLockdown, BlockLockdown, BlockLockdown, BlockManual} {
+		until := lockdown
+		if e == BlockManual {
+			until = block
+		}
+		if pgbs[i].BlockReason != e || pgbs[i].BlockedUntil == nil || !pgbs[i].BlockedUntil.Equal(until) {
+			t.Error("group", pgbs[i].ID, "blocked for", pgbs[i].BlockReason, "until", pgbs[i].BlockedUntil, "expected", e, until)
+		}
+	}
+
+	vacation := now.Add(time.Hour * 3)
+	pgbs = evaluateGroups(groups, dayBalance{active: tb}, overrides{vacation: vacation, blocks: map[string]time.Time{"music": now.Add(time.Hour)}}, now)
+	for _, pgb := range pgbs {
+		if pgb.BlockedBy != "" || pgb.SuspendedUntil == nil || !pgb.SuspendedUntil.Equal(vacation) {
+			t.Error("group", pgb.ID, "enforced during vacation:", pgb.BlockedBy, pgb.SuspendedUntil)
+		}
+	}
+	if next := predictBlocking(groups, pgbs, dayBalance{active: tb}, nil, nil, nil, overrides{vacation: vacation}, now); !next.Equal(vacation) {
+		t.Error("next check at", next, "expected at the end of the vacation", vacation)
+	}
+}
+
+func TestLockdownAndVacation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balance.json")
+	ph := NewProcessHunter(time.Hour, path, time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`[
+		{"id": "screen", "processes": [], "limits": {"*": "1h"}},
+		{"id": "games", "parent": "screen", "processes": ["non.existing.game"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	if err := ph.Lockdown(time.Now().Add(-time.Hour)); err == nil {
+		t.Error("accepted a lockdown that ends in the past")
+	}
+	if err := ph.Vacation(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("Vacation failed", err)
+	}
+	until := time.Now().Add(time.Hour).Round(time.Second)
+	if err := ph.Lockdown(until); err != nil {
+		t.Fatal("Lockdown failed", err)
+	}
+	if c := ph.GetControls(); c.Lockdown == nil || !c.Lockdown.Equal(until) || c.Vacation != nil {
+		t.Error("lockdown didn't end the vacation", c)
+	}
+
+	if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+		t.Error("checkProcesses failed", err)
+	}
+	for _, pgb := range ph.GetLatestPGroupsBalance() {
+		if pgb.BlockedBy != pgb.ID || pgb.BlockReason != BlockLockdown {
+			t.Error("group", pgb.ID, "blocked by", pgb.BlockedBy, "for", pgb.BlockReason, "expected a lockdown")
+		}
+	}
+
+	// the lockdown survives a restart
+	ph2 := NewProcessHunter(time.Hour, path, time.Hour, nil, "")
+	if err := ph2.LoadBalance(); err != nil {
+		t.Fatal("LoadBalance failed", err)
+	}
+	if c := ph2.GetControls(); c.Lockdown == nil || !c.Lockdown.Equal(until) {
+		t.Error("unexpected controls after loading the balance", c)
+	}
+
+	ph.EndLockdown()
+	if err := ph.Vacation(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("Vacation failed", err)
+	}
+	if err := ph.Block("screen", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal("Block failed", err)
+	}
+	if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+		t.Error("checkProcesses failed", err)
+	}
+	for _, pgb := range ph.GetLatestPGroupsBalance() {
+		if pgb.BlockedBy != "" || pgb.SuspendedUntil == nil {
+			t.Error("group", pgb.ID, "blocked by", pgb.BlockedBy, "during vacation")
+		}
+	}
+
+	ph.EndVacation()
+	if c := ph.GetControls(); c.Lockdown != nil || c.Vacation != nil || len(c.Blocks) != 1 {
+		t.Error("unexpected controls", c)
+	}
+}
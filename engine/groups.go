@@ -0,0 +1,265 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// reNotInID is a compiled regex of the character sequences that are not allowed in derived group IDs
+var reNotInID = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// GroupID returns the ID of the group.
+// The groups of a parsed configuration always have an ID (see Config.assignIDs); otherwise the ID is derived (see deriveID).
+func (g ProcessGroupDayLimit) GroupID() string {
+	if g.ID != "" {
+		return g.ID
+	}
+	return g.deriveID()
+}
+
+// deriveID derives an ID from the Name, or from the first process name of the group.
+// Names without any letters or digits that are allowed in IDs (e.g. names in Cyrillic) derive a hash of the name.
+func (g ProcessGroupDayLimit) deriveID() string {
+	n := g.Name
+	if n == "" && len(g.PG) > 0 {
+		n = g.PG[0]
+	}
+
+	id := strings.Trim(reNotInID.ReplaceAllString(strings.ToLower(n), "-"), "-")
+	if id == "" {
+		sum := sha256.Sum256([]byte(n))
+		id = "group-" + hex.EncodeToString(sum[:4])
+	}
+	return id
+}
+
+// assignIDs sets the IDs of the groups that have none (see deriveID), made unique with a numeric suffix.
+// It returns whether any ID was set.
+func assignIDs(groups []ProcessGroupDayLimit) bool {
+	taken := make(map[string]bool)
+	for _, g := range groups {
+		if g.ID != "" {
+			taken[g.ID] = true
+		}
+	}
+
+	assigned := false
+	for i, g := range groups {
+		if g.ID != "" {
+			continue
+		}
+		base := g.deriveID()
+		id := base
+		for n := 2; taken[id]; n++ {
+			id = fmt.Sprint(base, "-", n)
+		}
+		groups[i].ID = id
+		taken[id] = true
+		assigned = true
+	}
+	return assigned
+}
+
+// assignIDs sets the IDs of the groups of cfg, and of its profiles, that have none (see assignIDs),
+// and returns whether any ID was set. The IDs are saved in the config file (see ProcessHunter.LoadConfig),
+// so that the history of a group is kept when its name or processes change.
+func (cfg *Config) assignIDs() bool {
+	assigned := assignIDs(cfg.Groups)
+	for _, pr := range cfg.Profiles {
+		if assignIDs(pr.Groups) {
+			assigned = true
+		}
+	}
+	return assigned
+}
+
+// isEnabled returns whether limits and downtime of the group are enforced
+func (g ProcessGroupDayLimit) isEnabled() bool {
+	return g.Enabled == nil || *g.Enabled
+}
+
+// includes returns whether the processes of user belong to the group
+func (g ProcessGroupDayLimit) includes(user string) bool {
+	return len(g.Users) == 0 || slices.Contains(g.Users, user)
+}
+
+// sharesUsers returns whether the processes of some user belong to both g and o
+func (g ProcessGroupDayLimit) sharesUsers(o ProcessGroupDayLimit) bool {
+	return len(g.Users) == 0 || len(o.Users) == 0 || slices.ContainsFunc(g.Users, o.includes)
+}
+
+// processBalance returns the time balance of the process p in the group: the running time of the process
+// of the group's users (or of all users), excluding the time the users were idle, unless the group counts idle time,
+// and, with CPU accounting, the time the process didn't use enough CPU time (regardless of CountIdle)
+func (g ProcessGroupDayLimit) processBalance(p string, db dayBalance) time.Duration {
+	d := db.of(p, g.Users, g.CountIdle)
+	if low := db.cpuIdle[g.GroupID()][p]; low > 0 {
+		d = max(d-low, 0)
+	}
+	return d
+}
+
+// balance returns the total time balance of the processes of the group (see processBalance)
+func (g ProcessGroupDayLimit) balance(db dayBalance) time.Duration {
+	d := time.Duration(0)
+	for _, p := range g.PG {
+		d = d + g.processBalance(p, db)
+	}
+	return d
+}
+
+// reGroupID is a compiled regex of a valid group ID
+var reGroupID = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// reColor is a compiled regex of a valid color - #rgb, #rrggbb or a color name
+var reColor = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+
+// Reasons of the enforcement of the groups (see ProcessGroupDayBalance.BlockReason)
+const (
+	BlockManual   = "manual"   // the group, or a parent group, is blocked manually
+	BlockLockdown = "lockdown" // all the groups are blocked (see ProcessHunter.Lockdown)
+	BlockLimit    = "limit"    // the daily limit of the group, or of a parent group, ran out
+	BlockDowntime = "downtime" // the group, or a parent group, is in downtime
+)
+
+// evaluateGroups evaluates the time balance, limit and downtime of the groups for the day of now,
+// using the time balance of the processes for the day db, and the active grants, manual blocks, lockdown and vacation ov.
+// The balance of a group includes the balance of its child groups (recursively),
+// and a group is enforced (BlockedBy is set) when the group or any of its parent groups is blocked manually or locked down,
+// or when its own limit or downtime applies, or when the limit or downtime of any of its parent groups applies,
+// unless the group, or a parent group closer than the one that applies, has a grant.
+// Processes with their own limits or downtime (see ProcessDayLimit) are listed in BlockedPG when these apply,
+// unless the group or a parent group has a grant.
+// Nothing is enforced during a vacation.
+func evaluateGroups(groups []ProcessGroupDayLimit, db dayBalance, ov overrides, now time.Time) []ProcessGroupDayBalance {
+	date := toText(now)
+	weekDay := weekDays[now.Weekday()]
+
+	pgbs := make([]ProcessGroupDayBalance, len(groups))
+	index := make(map[string]int, len(groups))
+	for i, g := range groups {
+		index[g.GroupID()] = i
+	}
+	locked, suspended := ov.lockdown.After(now), ov.vacation.After(now)
+
+	for i, g := range groups {
+		pgbs[i] = ProcessGroupDayBalance{
+			ID:          g.GroupID(),
+			Name:        g.Name,
+			Description: g.Description,
+			Enabled:     g.isEnabled(),
+			Color:       g.Color,
+			Users:       g.Users,
+			Parent:      g.Parent,
+			PG:          g.PG,
+			TimeStamp:   now.Format(dtTimeFormat),
+		}
+		if e, ok := ov.grants[g.GroupID()]; ok {
+			pgbs[i].GrantedUntil = &e
+		}
+		if u, ok := ov.blocks[g.GroupID()]; ok && g.isEnabled() {
+			pgbs[i].BlockedUntil = &u
+		}
+		if locked && g.isEnabled() && (pgbs[i].BlockedUntil == nil || ov.lockdown.After(*pgbs[i].BlockedUntil)) {
+			l := ov.lockdown
+			pgbs[i].BlockedUntil = &l
+		}
+		if suspended {
+			v := ov.vacation
+			pgbs[i].SuspendedUntil = &v
+		}
+	}
+
+	// whether the group or any of its parents has a grant
+	granted := make([]bool, len(groups))
+	for i := range groups {
+		visited := make(map[int]bool)
+		for j, ok := i, true; ok && !visited[j] && !granted[i]; j, ok = index[groups[j].Parent] {
+			visited[j] = true
+			_, granted[i] = ov.grants[groups[j].GroupID()]
+		}
+	}
+
+	// add the balance of each group to the group itself and to all of its parents
+	for i, g := range groups {
+		own := g.balance(db)
+
+		visited := make(map[int]bool)
+		for j, ok := i, true; ok && !visited[j]; j, ok = index[groups[j].Parent] {
+			visited[j] = true
+			pgbs[j].Balance.Duration = pgbs[j].Balance.Duration + own
+		}
+
+		if p, ok := index[g.Parent]; ok {
+			pgbs[p].Children = append(pgbs[p].Children, pgbs[i].ID)
+		}
+	}
+
+	triggered := make([]bool, len(groups))
+	for i, g := range groups {
+		pgb := &pgbs[i]
+		pgb.Overtime, pgb.Limit.Duration, pgb.LimitDefined = isOvertime(pgb.Balance.Duration, date, weekDay, g.DL)
+		pgb.Blocked, pgb.Downtime = isBlocked(now, date, weekDay, g.DT)
+		pgb.Balance.Duration = pgb.Balance.Round(time.Second)
+		triggered[i] = g.isEnabled() && (pgb.Overtime || pgb.Blocked)
+
+		// processes with their own limits or downtime
+		for _, p := range g.PG {
+			pl, ok := g.PL[p]
+			if !ok || !g.isEnabled() || granted[i] || suspended {
+				continue
+			}
+			overtime, _, _ := isOvertime(g.processBalance(p, db), date, weekDay, pl.DL)
+			blocked, _ := isBlocked(now, date, weekDay, pl.DT)
+			if overtime || blocked {
+				pgb.BlockedPG = append(pgb.BlockedPG, p)
+			}
+		}
+	}
+
+	if suspended {
+		return pgbs
+	}
+
+	// the closest group (the group itself, its parent, the parent's parent...) that is blocked manually,
+	// or else that triggers enforcement
+	for i := range groups {
+		visited := make(map[int]bool)
+		for j, ok := i, true; ok && !visited[j]; j, ok = index[groups[j].Parent] {
+			visited[j] = true
+			if pgbs[j].BlockedUntil != nil {
+				pgbs[i].BlockedBy, pgbs[i].BlockReason = pgbs[j].ID, BlockManual
+				// the block ends with the lockdown, unless the manual block lasts longer
+				if locked && pgbs[j].BlockedUntil.Equal(ov.lockdown) {
+					pgbs[i].BlockReason = BlockLockdown
+				}
+				break
+			}
+		}
+		if pgbs[i].BlockedBy != "" {
+			continue
+		}
+
+		visited = make(map[int]bool)
+		for j, ok := i, true; ok && !visited[j]; j, ok = index[groups[j].Parent] {
+			visited[j] = true
+			if _, ok := ov.grants[groups[j].GroupID()]; ok {
+				break
+			}
+			if triggered[j] {
+				pgbs[i].BlockedBy, pgbs[i].BlockReason = pgbs[j].ID, BlockDowntime
+				if pgbs[j].Overtime {
+					pgbs[i].BlockReason = BlockLimit
+				}
+				break
+			}
+		}
+	}
+
+	return pgbs
+}
@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEvaluateGroupsHierarchy(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "screen", DL: DayLimits{"*": time.Hour*2 + time.Minute*30}},
+		{ID: "games", Parent: "screen", PG: []string{"game1", "game2"}, DL: DayLimits{"*": time.Hour * 2}},
+		{ID: "video", Parent: "screen", PG: []string{"player"}, DL: DayLimits{"*": time.Hour}},
+		{ID: "movies", Parent: "video", PG: []string{"movie"}, DT: Downtime{"*": {"11:00..13:00"}}},
+	}
+	tb := TimeBalance{
+		"game1":  time.Hour,
+		"game2":  time.Minute * 30,
+		"player": time.Minute * 40,
+		"movie":  time.Minute * 10,
+	}
+
+	pgbs := evaluateGroups(groups, dayBalance{active: tb}, overrides{}, now)
+
+	expected := []struct {
+		balance   time.Duration
+		blockedBy string
+	}{
+		{time.Hour*2 + time.Minute*20, ""},
+		{time.Hour + time.Minute*30, ""},
+		{time.Minute * 50, ""},
+		{time.Minute * 10, "movies"},
+	}
+	for i, e := range expected {
+		if pgbs[i].Balance.Duration != e.balance || pgbs[i].BlockedBy != e.blockedBy {
+			t.Error("group", pgbs[i].ID, "balance", pgbs[i].Balance, "blocked by", pgbs[i].BlockedBy,
+				"expected", e.balance, "blocked by", e.blockedBy)
+		}
+	}
+	if len(pgbs[0].Children) != 2 || len(pgbs[2].Children) != 1 {
+		t.Error("wrong child groups:", pgbs[0].Children, pgbs[2].Children)
+	}
+
+	// exceed the limit of the top group
+	tb["game1"] = time.Hour + time.Minute*20
+	pgbs = evaluateGroups(groups, dayBalance{active: tb}, overrides{}, now)
+
+	for i, e := range []string{"screen", "screen", "screen", "movies"} {
+		if pgbs[i].BlockedBy != e {
+			t.Error("group", pgbs[i].ID, "blocked by", pgbs[i].BlockedBy, "expected", e)
+		}
+	}
+	if pgbs[1].Overtime {
+		t.Error("child group overtime, while within its own limit")
+	}
+}
+
+func TestParseConfigHierarchy(t *testing.T) {
+	_, err := parseConfig([]byte(`[
+		{"id": "screen", "processes": [], "limits": {"*": "2h30m"}},
+		{"id": "games", "parent": "screen", "processes": ["g1"], "limits": {"*": "2h"}},
+		{"id": "video", "parent": "screen", "processes": ["v1"]}
+	]`))
+	if err != nil {
+		t.Error("Could not parse config with group hierarchy:", err)
+	}
+
+	// unrelated groups, and groups of different users, may share processes
+	_, err = parseConfig([]byte(`[
+		{"id": "games", "processes": ["browser"], "limits": {"*": "2h"}},
+		{"id": "video", "processes": ["browser"], "limits": {"*": "1h"}},
+		{"id": "screen", "processes": [], "limits": {"*": "4h"}},
+		{"id": "alice.games", "parent": "screen", "processes": ["game"], "users": ["alice"]},
+		{"id": "bob.games", "parent": "screen", "processes": ["game"], "users": ["bob"]}
+	]`))
+	if err != nil {
+		t.Error("Could not parse config with processes shared by unrelated groups:", err)
+	}
+
+	invalid := []string{
+		`[{"id": "games", "parent": "screen", "processes": ["g1"], "limits": {"*": "2h"}}]`,
+		`[{"id": "a", "parent": "b", "processes": ["p1"]}, {"id": "b", "parent": "a", "processes": ["p2"]}]`,
+		`[{"id": "screen", "processes": [], "limits": {"*": "2h30m"}}]`,
+		// a process shared with a parent, a grandparent or a sibling group would be counted twice
+		`[{"id": "screen", "processes": ["g1"], "limits": {"*": "2h"}}, {"id": "games", "parent": "screen", "processes": ["g1"]}]`,
+		`[{"id": "screen", "processes": ["g1"], "limits": {"*": "2h"}}, {"id": "games", "parent": "screen", "processes": ["g2"]},
+			{"id": "rpg", "parent": "games", "processes": ["g1"]}]`,
+		`[{"id": "screen", "processes": [], "limits": {"*": "2h"}}, {"id": "games", "parent": "screen", "processes": ["browser"]},
+			{"id": "video", "parent": "screen", "processes": ["browser"]}]`,
+		`[{"id": "screen", "processes": [], "limits": {"*": "2h"}}, {"id": "games", "parent": "screen", "processes": ["browser"], "users": ["alice"]},
+			{"id": "video", "parent": "screen", "processes": ["browser"], "users": ["alice", "bob"]}]`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
+
+func TestProcessDayLimitConfig(t *testing.T) {
+	const cfg = `[{"processes": ["p1", {"name": "p2", "limits": {"*": "30m"}}], "limits": {"*": "2h"}}]`
+
+	c, err := parseConfig([]byte(cfg))
+	if err != nil {
+		t.Fatal("Could not parse config:", err)
+	}
+
+	g := c.Groups[0]
+	if len(g.PG) != 2 || g.PG[0] != "p1" || g.PG[1] != "p2" || len(g.PL) != 1 || g.PL["p2"].DL["*"] != time.Minute*30 {
+		t.Error("process limits not parsed correctly:", g)
+	}
+
+	b, err := g.MarshalJSON()
+	if err != nil {
+		t.Error("Cannot marshal process group:", err)
+	}
+	var g2 ProcessGroupDayLimit
+	err = g2.UnmarshalJSON(b)
+	if err != nil || !reflect.DeepEqual(g, g2) {
+		t.Error("process group not marshaled correctly:", string(b))
+	}
+
+	invalid := []string{
+		`[{"processes": [{"limits": {"*": "30m"}}], "limits": {"*": "2h"}}]`,
+		`[{"processes": [{"name": "p1"}], "limits": {"*": "2h"}}]`,
+		`[{"processes": [{"name": "p1", "downtime": {"*": ["25:00.."]}}], "limits": {"*": "2h"}}]`,
+		`[{"processes": [1], "limits": {"*": "2h"}}]`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
+
+func TestEvaluateGroupsProcessDayLimit(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "games", PG: []string{"game1", "game2", "game3"}, DL: DayLimits{"*": time.Hour * 2}, PL: map[string]ProcessDayLimit{
+			"game1": {Name: "game1", DL: DayLimits{"*": time.Minute * 30}},
+			"game2": {Name: "game2", DT: Downtime{"*": {"11:00.."}}},
+			"game3": {Name: "game3", DL: DayLimits{"*": time.Hour}},
+		}},
+	}
+	tb := TimeBalance{"game1": time.Minute * 40, "game2": time.Minute, "game3": time.Minute}
+
+	pgbs := evaluateGroups(groups, dayBalance{active: tb}, overrides{}, now)
+
+	if pgbs[0].BlockedBy != "" || !reflect.DeepEqual(pgbs[0].BlockedPG, []string{"game1", "game2"}) {
+		t.Error("wrong processes blocked by their own limits:", pgbs[0].BlockedPG)
+	}
+}
+
+func TestEvaluateGroupsUsers(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "games", PG: []string{"game"}, DL: DayLimits{"*": time.Hour * 2}},
+		{ID: "alice.games", PG: []string{"game"}, Users: []string{"alice"}, DL: DayLimits{"*": time.Hour}},
+		{ID: "bob.games", PG: []string{"game"}, Users: []string{"bob"}, DL: DayLimits{"*": time.Hour}},
+	}
+	tb := TimeBalance{"game": time.Hour + time.Minute*30}
+	ub := map[string]TimeBalance{
+		"alice": {"game": time.Hour + time.Minute*10},
+		"bob":   {"game": time.Minute * 20},
+	}
+
+	pgbs := evaluateGroups(groups, dayBalance{active: tb, users: ub}, overrides{}, now)
+
+	expected := []struct {
+		balance   time.Duration
+		blockedBy string
+	}{
+		{time.Hour + time.Minute*30, ""},
+		{time.Hour + time.Minute*10, "alice.games"},
+		{time.Minute * 20, ""},
+	}
+	for i, e := range expected {
+		if pgbs[i].Balance.Duration != e.balance || pgbs[i].BlockedBy != e.blockedBy {
+			t.Error("group", pgbs[i].ID, "balance", pgbs[i].Balance, "blocked by", pgbs[i].BlockedBy,
+				"expected", e.balance, "blocked by", e.blockedBy)
+		}
+	}
+}
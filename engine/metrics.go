@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkBuckets are the upper bounds (in seconds) of the buckets of the check duration histogram
+var checkBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics are the counters of ph, exposed in the Prometheus text format by WriteMetrics,
+// and the latest results of the checks, saves and loads, reported by GetStatus
+type metrics struct {
+	mu             sync.Mutex
+	processSeconds map[string]float64 // running time of the processes of the groups, by process name
+	kills          map[string]uint64  // kill attempts, by group ID
+	killFailures   map[string]uint64  // failed kill attempts, by group ID
+	checkCounts    []uint64           // check duration histogram counts, by bucket (not cumulative); the last is +Inf
+	checkSum       float64            // total duration of the checks in seconds
+	checkCount     uint64             // number of checks
+	scanned        int                // number of processes scanned by the latest check
+	lastSave       time.Time          // when the balance was last saved successfully
+	reloadErrors   uint64             // number of failed reloads of the config file
+
+	lastCheck         time.Time     // when the latest successful check finished
+	lastCheckDuration time.Duration // how long the latest successful check took
+	saveErr           error         // the error of the latest save of the balance
+	loadErr           error         // the error of the latest load of the config file
+}
+
+// newMetrics returns empty metrics
+func newMetrics() *metrics {
+	return &metrics{
+		processSeconds: make(map[string]float64),
+		kills:          make(map[string]uint64),
+		killFailures:   make(map[string]uint64),
+		checkCounts:    make([]uint64, len(checkBuckets)+1),
+	}
+}
+
+// addProcessTime adds dt to the running time of process name
+func (m *metrics) addProcessTime(name string, dt time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.processSeconds[name] += dt.Seconds()
+}
+
+// killed counts a kill attempt of a process of group, and whether it failed
+func (m *metrics) killed(group string, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.kills[group]++
+	if failed {
+		m.killFailures[group]++
+	}
+}
+
+// checked records a check of scanned processes, that took d
+func (m *metrics) checked(d time.Duration, scanned int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, _ := slices.BinarySearch(checkBuckets, d.Seconds())
+	m.checkCounts[i]++
+	m.checkSum += d.Seconds()
+	m.checkCount++
+	m.scanned = scanned
+	m.lastCheck = time.Now()
+	m.lastCheckDuration = d
+}
+
+// saved records a save of the balance at t, that failed if err is not nil
+func (m *metrics) saved(t time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.saveErr = err
+	if err == nil {
+		m.lastSave = t
+	}
+}
+
+// loaded records a load of the config file, that failed if err is not nil
+func (m *metrics) loaded(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.loadErr = err
+}
+
+// reloadFailed counts a failed reload of the config file
+func (m *metrics) reloadFailed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.reloadErrors++
+}
+
+// labelEscaper escapes label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricWriter writes metrics in the Prometheus text format
+type metricWriter struct {
+	w *bufio.Writer
+}
+
+// family writes the HELP and TYPE lines of metric name
+func (mw metricWriter) family(name, typ, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample of metric name, with labels given as name and value pairs
+func (mw metricWriter) sample(name string, v float64, labels ...string) {
+	mw.w.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			mw.w.WriteByte('{')
+		} else {
+			mw.w.WriteByte(',')
+		}
+		fmt.Fprintf(mw.w, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		if i+2 >= len(labels) {
+			mw.w.WriteByte('}')
+		}
+	}
+	fmt.Fprintf(mw.w, " %g\n", v)
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// boolValue returns 1 if b is true, and 0 otherwise
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// WriteMetrics writes the metrics of ph to w, in the Prometheus text exposition format
+func (ph *ProcessHunter) WriteMetrics(w io.Writer) error {
+	mw := metricWriter{bufio.NewWriter(w)}
+
+	pgbs := ph.GetLatestPGroupsBalance()
+	groupLabels := func(pgb ProcessGroupDayBalance) []string {
+		name := pgb.Name
+		if name == "" {
+			name = pgb.ID
+		}
+		return []string{"group", pgb.ID, "name", name}
+	}
+
+	mw.family("ph_group_balance_seconds", "gauge", "Time used by the process group (and its child groups) today.")
+	for _, pgb := range pgbs {
+		mw.sample("ph_group_balance_seconds", pgb.Balance.Seconds(), groupLabels(pgb)...)
+	}
+	mw.family("ph_group_limit_seconds", "gauge", "Daily time limit of the process group, if defined for today.")
+	for _, pgb := range pgbs {
+		if pgb.LimitDefined {
+			mw.sample("ph_group_limit_seconds", pgb.Limit.Seconds(), groupLabels(pgb)...)
+		}
+	}
+	mw.family("ph_group_blocked", "gauge", "Whether the processes of the group are blocked, by its own limit or downtime, or by those of a parent group.")
+	for _, pgb := range pgbs {
+		mw.sample("ph_group_blocked", boolValue(pgb.BlockedBy != ""), groupLabels(pgb)...)
+	}
+	mw.family("ph_group_overtime", "gauge", "Whether the balance of the group exceeds its limit.")
+	for _, pgb := range pgbs {
+		mw.sample("ph_group_overtime", boolValue(pgb.Overtime), groupLabels(pgb)...)
+	}
+
+	m := ph.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mw.family("ph_process_seconds_total", "counter", "Running time of the processes of the process groups.")
+	for _, name := range sortedKeys(m.processSeconds) {
+		mw.sample("ph_process_seconds_total", m.processSeconds[name], "process", name)
+	}
+	mw.family("ph_kill_attempts_total", "counter", "Attempts to kill the processes of the process group.")
+	for _, g := range sortedKeys(m.kills) {
+		mw.sample("ph_kill_attempts_total", float64(m.kills[g]), "group", g)
+	}
+	mw.family("ph_kill_failures_total", "counter", "Failed attempts to kill the processes of the process group.")
+	for _, g := range sortedKeys(m.kills) {
+		mw.sample("ph_kill_failures_total", float64(m.killFailures[g]), "group", g)
+	}
+
+	mw.family("ph_check_duration_seconds", "histogram", "Duration of the checks of the processes.")
+	var cumulative uint64
+	for i, le := range checkBuckets {
+		cumulative += m.checkCounts[i]
+		mw.sample("ph_check_duration_seconds_bucket", float64(cumulative), "le", fmt.Sprint(le))
+	}
+	mw.sample("ph_check_duration_seconds_bucket", float64(m.checkCount), "le", "+Inf")
+	mw.sample("ph_check_duration_seconds_sum", m.checkSum)
+	mw.sample("ph_check_duration_seconds_count", float64(m.checkCount))
+
+	mw.family("ph_processes_scanned", "gauge", "Number of processes scanned by the latest check.")
+	mw.sample("ph_processes_scanned", float64(m.scanned))
+	mw.family("ph_last_save_timestamp_seconds", "gauge", "Time of the last successful save of the balance, in seconds since the epoch (0 if never saved).")
+	lastSave := 0.0
+	if !m.lastSave.IsZero() {
+		lastSave = float64(m.lastSave.Unix())
+	}
+	mw.sample("ph_last_save_timestamp_seconds", lastSave)
+	mw.family("ph_config_reload_errors_total", "counter", "Failed reloads of the config file.")
+	mw.sample("ph_config_reload_errors_total", float64(m.reloadErrors))
+
+	return mw.w.Flush()
+}
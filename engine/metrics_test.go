@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	if err := ph.SetConfig([]byte(`[{"id": "games", "name": "Games \"A\"", "processes": ["game"], "limits": {"*": "1h"}}]`)); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	ph.pgroups = evaluateGroups(ph.limits, dayBalance{active: TimeBalance{"game": time.Hour * 2}}, overrides{}, time.Now())
+
+	ph.metrics.addProcessTime("game", time.Minute)
+	ph.metrics.killed("games", false)
+	ph.metrics.killed("games", true)
+	ph.metrics.checked(time.Millisecond*200, 42)
+	ph.metrics.checked(time.Second*20, 40)
+	ph.metrics.reloadFailed()
+
+	var b strings.Builder
+	if err := ph.WriteMetrics(&b); err != nil {
+		t.Fatal("Could not write metrics:", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		`ph_group_balance_seconds{group="games",name="Games \"A\""} 7200`,
+		`ph_group_limit_seconds{group="games",name="Games \"A\""} 3600`,
+		`ph_group_blocked{group="games",name="Games \"A\""} 1`,
+		`ph_group_overtime{group="games",name="Games \"A\""} 1`,
+		`ph_process_seconds_total{process="game"} 60`,
+		`ph_kill_attempts_total{group="games"} 2`,
+		`ph_kill_failures_total{group="games"} 1`,
+		`ph_check_duration_seconds_bucket{le="0.1"} 0`,
+		`ph_check_duration_seconds_bucket{le="0.25"} 1`,
+		`ph_check_duration_seconds_bucket{le="10"} 1`,
+		`ph_check_duration_seconds_bucket{le="+Inf"} 2`,
+		`ph_check_duration_seconds_count 2`,
+		`ph_processes_scanned 40`,
+		`ph_last_save_timestamp_seconds 0`,
+		`ph_config_reload_errors_total 1`,
+		"# TYPE ph_check_duration_seconds histogram",
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Error("metrics do not contain", want)
+		}
+	}
+}
+
+func TestReloadErrorMetric(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, filepath.Join(t.TempDir(), "cfg.json"))
+	if err := os.WriteFile(ph.cfgPath, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+		t.Error("check failed:", err)
+	}
+	if ph.metrics.reloadErrors != 1 {
+		t.Error("reload error not counted", ph.metrics.reloadErrors)
+	}
+	if len(ph.GetEvents()) != 0 {
+		t.Error("failed reload emitted events", ph.GetEvents())
+	}
+}
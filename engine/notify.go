@@ -0,0 +1,248 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of notifications
+const (
+	NotifyWarning = "warning" // the processes of a group are about to be terminated
+	NotifyKill    = "kill"    // processes were terminated
+	NotifyRequest = "request" // a request of the user for more time was approved or denied
+)
+
+// defaultWarnings are the default thresholds of the warnings before enforcement
+var defaultWarnings = []time.Duration{10 * time.Minute, 2 * time.Minute}
+
+// Notification is a message to a user whose processes are about to be, or were, terminated
+type Notification struct {
+	Type      string        // Type is the type of the notification, e.g. NotifyWarning
+	Group     string        // Group is the ID of the process group
+	User      string        // User is the user to notify
+	Process   string        // Process is the comma-separated names of the terminated processes (NotifyKill only)
+	Remaining time.Duration // Remaining is the time left before enforcement (NotifyWarning only)
+	Message   string        // Message is a human friendly description of the notification
+}
+
+// Notifier notifies users about enforcement
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// LogNotifier is a Notifier that logs the notifications
+type LogNotifier struct{}
+
+// Notify logs n
+func (LogNotifier) Notify(n Notification) error {
+	log.Println("notify", n.User, ":", n.Message)
+	return nil
+}
+
+// SetNotifier sets the notifier of the users. The users are not notified when n is nil.
+func (ph *ProcessHunter) SetNotifier(n Notifier) {
+	ph.limitsRWM.Lock()
+	defer ph.limitsRWM.Unlock()
+
+	ph.notifier = n
+}
+
+// notifications queues the notifications, to send them outside of the locks of the ProcessHunter (see runNotify)
+type notifications struct {
+	mu    sync.Mutex
+	queue []Notification
+	ready chan struct{} // signals that notifications are queued
+}
+
+func newNotifications() *notifications {
+	return &notifications{ready: make(chan struct{}, 1)}
+}
+
+// push queues n
+func (ns *notifications) push(n Notification) {
+	ns.mu.Lock()
+	ns.queue = append(ns.queue, n)
+	ns.mu.Unlock()
+
+	select {
+	case ns.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take removes and returns the queued notifications
+func (ns *notifications) take() []Notification {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	q := ns.queue
+	ns.queue = nil
+	return q
+}
+
+// notify queues n to be sent with ph.notifier, if any. ph.limitsRWM must be locked by the caller.
+func (ph *ProcessHunter) notify(n Notification) {
+	if ph.notifier == nil {
+		return
+	}
+	ph.pending.push(n)
+}
+
+// sendNotifications sends the queued notifications with ph.notifier.
+// It must be called without holding the locks of ph, as the notifier may block, e.g. on a desktop session bus.
+func (ph *ProcessHunter) sendNotifications() {
+	ph.limitsRWM.RLock()
+	notifier := ph.notifier
+	ph.limitsRWM.RUnlock()
+
+	for _, n := range ph.pending.take() {
+		if notifier == nil {
+			continue
+		}
+		if err := notifier.Notify(n); err != nil {
+			log.Println("error notifying", n.User, ":", err)
+		}
+	}
+}
+
+// runNotify is a goroutine that sends the queued notifications until ctx is cancelled
+func (ph *ProcessHunter) runNotify(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ph.pending.ready:
+			ph.sendNotifications()
+		}
+	}
+}
+
+// killKey identifies the kill notifications of a check: one per group and user
+type killKey struct {
+	group string
+	user  string
+}
+
+// killed records that process p of the process group with ID group was killed, to notify its user (see notifyKills).
+// ph.balanceRWM must be locked by the caller.
+func (ph *ProcessHunter) killed(group string, p processInfo) {
+	if ph.kills == nil {
+		ph.kills = make(map[killKey][]string)
+	}
+	k := killKey{group: group, user: p.user}
+	if !slices.Contains(ph.kills[k], p.name) {
+		ph.kills[k] = append(ph.kills[k], p.name)
+	}
+}
+
+// notifyKills notifies the users about the processes killed since the last call, once per group and user.
+// ph.balanceRWM and ph.limitsRWM must be locked by the caller.
+func (ph *ProcessHunter) notifyKills() {
+	keys := make([]killKey, 0, len(ph.kills))
+	for k := range ph.kills {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b killKey) int {
+		if c := strings.Compare(a.group, b.group); c != 0 {
+			return c
+		}
+		return strings.Compare(a.user, b.user)
+	})
+
+	for _, k := range keys {
+		names := ph.kills[k]
+		verb := " was closed"
+		if len(names) > 1 {
+			verb = " were closed"
+		}
+		process := strings.Join(names, ", ")
+		ph.notify(Notification{Type: NotifyKill, Group: k.group, User: k.user, Process: process, Message: process + verb})
+	}
+	clear(ph.kills)
+}
+
+// warningThresholds returns the configured warning thresholds (see Settings.Warnings), longest first
+func warningThresholds(warnings []string) []time.Duration {
+	if warnings == nil {
+		return defaultWarnings
+	}
+
+	var ths []time.Duration
+	for _, w := range warnings {
+		if d, err := time.ParseDuration(w); err == nil && d > 0 {
+			ths = append(ths, d)
+		}
+	}
+	slices.Sort(ths)
+	slices.Reverse(ths)
+	return ths
+}
+
+// warn notifies the users with running processes in the groups that are about to be blocked (see predictBlocking),
+// once for each warning threshold the time left crosses, per group per day.
+// It returns when the next warning is due, or the zero time if none is.
+// ph.balanceRWM and ph.limitsRWM must be locked by the caller.
+func (ph *ProcessHunter) warn(groups []ProcessGroupDayLimit, pgbs []ProcessGroupDayBalance, running []processInfo, now time.Time) time.Time {
+	date := toText(now)
+	if _, ok := ph.notified[date]; !ok {
+		ph.notified = map[string]map[string]bool{date: {}}
+	}
+	sent := ph.notified[date]
+
+	ths := warningThresholds(ph.config.Warnings)
+
+	var next time.Time
+	for i, g := range groups {
+		pgb := pgbs[i]
+		if pgb.BlockedAt == nil {
+			continue
+		}
+		remaining := pgb.BlockedAt.Sub(now)
+
+		var users []string
+		for _, p := range running {
+			if g.includes(p.user) && slices.Contains(g.PG, p.name) && !slices.Contains(users, p.user) {
+				users = append(users, p.user)
+			}
+		}
+
+		crossed := false
+		for _, th := range ths {
+			key := pgb.ID + "/" + th.String()
+			if remaining > th {
+				if !sent[key] && len(users) > 0 {
+					next = earliest(next, pgb.BlockedAt.Add(-th))
+				}
+				continue
+			}
+			if !sent[key] {
+				crossed = true
+			}
+			// the thresholds are marked as sent once the users with running processes are notified
+			if len(users) > 0 {
+				sent[key] = true
+			}
+		}
+		if !crossed || len(users) == 0 {
+			continue
+		}
+
+		name := pgb.Name
+		if name == "" {
+			name = pgb.ID
+		}
+		msg := name + " will be closed in " + remaining.Round(time.Minute).String()
+		for _, u := range users {
+			ph.emit(Event{Type: EventWarning, Group: pgb.ID, User: u, Message: msg})
+			ph.notify(Notification{Type: NotifyWarning, Group: pgb.ID, User: u, Remaining: remaining, Message: msg})
+		}
+	}
+
+	return next
+}
@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// desktopNotifier is a Notifier that shows freedesktop notifications in the session of the user, over D-Bus (using gdbus)
+type desktopNotifier struct{}
+
+// defaultNotifier returns a desktopNotifier, or LogNotifier if gdbus is not available
+func defaultNotifier() Notifier {
+	if _, err := exec.LookPath("gdbus"); err != nil {
+		return LogNotifier{}
+	}
+	return desktopNotifier{}
+}
+
+// Notify shows n in the session bus of n.User, running gdbus as the user when ph runs as root
+func (desktopNotifier) Notify(n Notification) error {
+	if n.User == "" {
+		return errors.New("no user to notify")
+	}
+	u, err := user.Lookup(n.User)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("gdbus", notifyArgs("Process Hunter", n.Message)...)
+	cmd.Env = append(os.Environ(), "DBUS_SESSION_BUS_ADDRESS=unix:path=/run/user/"+u.Uid+"/bus")
+	if os.Geteuid() == 0 && uid != 0 {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}}
+	} else if os.Geteuid() != uid {
+		return errors.New("cannot notify user " + n.User + " without root privileges")
+	}
+
+	return cmd.Run()
+}
+
+// notifyArgs returns the gdbus arguments that call the Notify method of org.freedesktop.Notifications
+func notifyArgs(summary string, body string) []string {
+	return []string{
+		"call", "--session", "--timeout", "5",
+		"--dest", "org.freedesktop.Notifications",
+		"--object-path", "/org/freedesktop/Notifications",
+		"--method", "org.freedesktop.Notifications.Notify",
+		gvariantString("ph"), "0", gvariantString("dialog-warning"), gvariantString(summary), gvariantString(body),
+		"[]", "{}", "10000",
+	}
+}
+
+// gvariantString returns s in the GVariant text format
+func gvariantString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,16 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNotifyArgs(t *testing.T) {
+	args := notifyArgs("Process Hunter", `Kid's game \o/`)
+	if !slices.Contains(args, `'Kid\'s game \\o/'`) || !slices.Contains(args, "'Process Hunter'") {
+		t.Error("unexpected gdbus arguments", args)
+	}
+}
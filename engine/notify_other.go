@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package engine
+
+// defaultNotifier returns LogNotifier, since desktop notifications are not supported
+func defaultNotifier() Notifier {
+	return LogNotifier{}
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeNotifier records the notifications
+type fakeNotifier struct {
+	notifications []Notification
+}
+
+func (f *fakeNotifier) Notify(n Notification) error {
+	f.notifications = append(f.notifications, n)
+	return nil
+}
+
+func TestWarn(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	f := &fakeNotifier{}
+	ph.SetNotifier(f)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "games", PG: []string{"game"}, Users: []string{"alice"}},
+		{ID: "video", PG: []string{"player"}},
+	}
+	blockedAt := now.Add(time.Minute * 9)
+	pgbs := []ProcessGroupDayBalance{{ID: "games", BlockedAt: &blockedAt}, {ID: "video", BlockedAt: &blockedAt}}
+	running := []processInfo{{pid: 1, name: "game", user: "alice"}, {pid: 2, name: "game", user: "bob"}}
+
+	next := ph.warn(groups, pgbs, running, now)
+	ph.sendNotifications()
+	if len(f.notifications) != 1 || f.notifications[0].User != "alice" || f.notifications[0].Group != "games" {
+		t.Error("unexpected notifications", f.notifications)
+	}
+	if !next.Equal(blockedAt.Add(-time.Minute * 2)) {
+		t.Error("next warning at", next, "expected", blockedAt.Add(-time.Minute*2))
+	}
+
+	// the same threshold is not warned again
+	ph.warn(groups, pgbs, running, now.Add(time.Minute))
+	ph.sendNotifications()
+	if len(f.notifications) != 1 {
+		t.Error("warned twice", f.notifications)
+	}
+
+	next = ph.warn(groups, pgbs, running, now.Add(time.Minute*8))
+	ph.sendNotifications()
+	if len(f.notifications) != 2 || f.notifications[1].Remaining != time.Minute {
+		t.Error("unexpected notifications", f.notifications)
+	}
+	if !next.IsZero() {
+		t.Error("unexpected next warning", next)
+	}
+
+	// no warnings without thresholds
+	ph.config.Warnings = []string{}
+	ph.warn(groups, pgbs, running, now.Add(time.Minute*8))
+	ph.sendNotifications()
+	if len(f.notifications) != 2 {
+		t.Error("warned with no thresholds", f.notifications)
+	}
+}
+
+func TestNotifyKill(t *testing.T) {
+	ph := NewProcessHunter(time.Hour, "", time.Hour, func(int) error { return nil }, "")
+	f := &fakeNotifier{}
+	ph.SetNotifier(f)
+
+	// two instances of the game are killed, and the user is notified once
+	g := ProcessGroupDayLimit{ID: "games", PG: []string{"game"}}
+	db := dayBalance{active: TimeBalance{"game": time.Hour}}
+	tree := append(slices.Clone(testTree), processInfo{pid: 60, ppid: 1, name: "game"})
+	if err := ph.killProcesses(context.Background(), g, g.PG, db, newProcessTable(tree, nil)); err != nil {
+		t.Error("killProcesses failed", err)
+	}
+	ph.sendNotifications()
+	if len(f.notifications) != 0 {
+		t.Error("notified before the end of the check", f.notifications)
+	}
+
+	ph.notifyKills()
+	ph.sendNotifications()
+	if len(f.notifications) != 1 || f.notifications[0].Type != NotifyKill || f.notifications[0].Process != "game" {
+		t.Error("unexpected notifications", f.notifications)
+	}
+
+	ph.notifyKills()
+	ph.sendNotifications()
+	if len(f.notifications) != 1 {
+		t.Error("notified twice", f.notifications)
+	}
+}
+
+func TestParseConfigWarnings(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"groups": [], "warnings": ["15m", "1m"]}`)); err != nil {
+		t.Error("rejected warnings", err)
+	}
+	if _, err := parseConfig([]byte(`{"groups": [], "warnings": ["15"]}`)); err == nil {
+		t.Error("accepted a bad warning threshold")
+	}
+	if ths := warningThresholds([]string{"1m", "15m"}); len(ths) != 2 || ths[0] != time.Minute*15 {
+		t.Error("unexpected thresholds", ths)
+	}
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"time"
+)
+
+// overrides are the grants, the manual blocks, the lockdown and the vacation that apply to the groups, besides their limits and downtime
+type overrides struct {
+	grants   map[string]time.Time // when the active grants expire, by group ID
+	blocks   map[string]time.Time // when the active manual blocks end, by group ID
+	lockdown time.Time            // when the lockdown of all the groups ends; zero if there is no lockdown
+	vacation time.Time            // when the suspension of the enforcement ends; zero if there is no vacation
+}
+
+// Controls are the manual blocks, the lockdown and the vacation mode, set by a parent
+type Controls struct {
+	Blocks   map[string]time.Time `json:"blocks"`             // Blocks are when the manual blocks of the groups end, by group ID
+	Lockdown *time.Time           `json:"lockdown,omitempty"` // Lockdown is when the lockdown of all the groups ends
+	Vacation *time.Time           `json:"vacation,omitempty"` // Vacation is when the suspension of the enforcement ends
+}
+
+// overrides returns the grants, the manual blocks, the lockdown and the vacation that are active at now,
+// and removes the expired ones. ph.balanceRWM must be locked by the caller.
+func (ph *ProcessHunter) overrides(now time.Time) overrides {
+	ph.pruneGrants(now)
+	maps.DeleteFunc(ph.blocks, func(_ string, until time.Time) bool { return !until.After(now) })
+	if !ph.lockdown.After(now) {
+		ph.lockdown = time.Time{}
+	}
+	if !ph.vacation.After(now) {
+		ph.vacation = time.Time{}
+	}
+
+	return overrides{grants: activeGrants(ph.grants, now), blocks: maps.Clone(ph.blocks), lockdown: ph.lockdown, vacation: ph.vacation}
+}
+
+// Block blocks the process group with ID group (and its child groups) until until, regardless of its limits,
+// downtime and grants, and forces a process check
+func (ph *ProcessHunter) Block(group string, until time.Time) error {
+	if !until.After(time.Now()) {
+		return fmt.Errorf("block of %s ends in the past", group)
+	}
+
+	return ph.setBlock(group, func() {
+		ph.blocks[group] = until
+		log.Println("blocked", group, "until", until.Format(time.DateTime))
+	})
+}
+
+// Unblock removes the manual block of the process group with ID group, and forces a process check
+func (ph *ProcessHunter) Unblock(group string) error {
+	return ph.setBlock(group, func() {
+		delete(ph.blocks, group)
+		log.Println("unblocked", group)
+	})
+}
+
+// GetBlocks returns when the manual blocks of the groups end, by group ID
+func (ph *ProcessHunter) GetBlocks() map[string]time.Time {
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+
+	now := time.Now()
+	blocks := make(map[string]time.Time)
+	for g, until := range ph.blocks {
+		if until.After(now) {
+			blocks[g] = until
+		}
+	}
+	return blocks
+}
+
+// Lockdown blocks all the process groups until until, regardless of their limits, downtime and grants,
+// ends the vacation, if any, and forces a process check
+func (ph *ProcessHunter) Lockdown(until time.Time) error {
+	if !until.After(time.Now()) {
+		return errors.New("lockdown ends in the past")
+	}
+
+	ph.setControl(func() {
+		ph.lockdown, ph.vacation = until, time.Time{}
+		log.Println("lockdown until", until.Format(time.DateTime))
+	})
+	return nil
+}
+
+// EndLockdown ends the lockdown, and forces a process check
+func (ph *ProcessHunter) EndLockdown() {
+	ph.setControl(func() {
+		ph.lockdown = time.Time{}
+		log.Println("lockdown ended")
+	})
+}
+
+// Vacation suspends the enforcement of the limits and downtime of all the process groups, of their manual blocks,
+// and of the session limits, until until. It ends the lockdown, if any, and forces a process check.
+func (ph *ProcessHunter) Vacation(until time.Time) error {
+	if !until.After(time.Now()) {
+		return errors.New("vacation ends in the past")
+	}
+
+	ph.setControl(func() {
+		ph.vacation, ph.lockdown = until, time.Time{}
+		log.Println("vacation until", until.Format(time.DateTime))
+	})
+	return nil
+}
+
+// EndVacation ends the vacation, and forces a process check
+func (ph *ProcessHunter) EndVacation() {
+	ph.setControl(func() {
+		ph.vacation = time.Time{}
+		log.Println("vacation ended")
+	})
+}
+
+// GetControls returns the active manual blocks, lockdown and vacation
+func (ph *ProcessHunter) GetControls() Controls {
+	blocks := ph.GetBlocks()
+
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+
+	now := time.Now()
+	c := Controls{Blocks: blocks}
+	if ph.lockdown.After(now) {
+		c.Lockdown = timeRef(ph.lockdown)
+	}
+	if ph.vacation.After(now) {
+		c.Vacation = timeRef(ph.vacation)
+	}
+	return c
+}
+
+// setBlock checks that the process group with ID group exists, and calls setControl with set
+func (ph *ProcessHunter) setBlock(group string, set func()) error {
+	if !ph.hasGroup(group) {
+		return fmt.Errorf("process group %s not found", group)
+	}
+
+	ph.setControl(set)
+	return nil
+}
+
+// setControl calls set, saves the balance and forces a process check
+func (ph *ProcessHunter) setControl(set func()) {
+	ph.balanceRWM.Lock()
+	defer ph.balanceRWM.Unlock()
+
+	set()
+
+	if ph.balancePath != "" {
+		if err := ph.saveBalance(); err != nil {
+			log.Println("error saving balance to", ph.balancePath, ":", err)
+		}
+	}
+	ph.force()
+	ph.publish(UpdateBlock)
+}
@@ -1,12 +1,18 @@
 package engine
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/mail"
+	"net/url"
 	"os"
+	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
@@ -16,6 +22,18 @@ func (pd prettyDuration) MarshalJSON() ([]byte, error) {
 	return json.Marshal(pd.String())
 }
 
+// UnmarshalJSON unmarshals pd using 12h35m46s duration format
+func (pd *prettyDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	d, err := time.ParseDuration(s)
+	pd.Duration = d
+	return err
+}
+
 // MarshalJSON marshals tb using 12h35m46s duration format
 func (tb TimeBalance) MarshalJSON() ([]byte, error) {
 	aux := make(map[string]string)
@@ -84,6 +102,72 @@ func (dtl *DayLimits) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON marshals g, representing the processes with their own limits or downtime as ProcessDayLimit objects
+func (g ProcessGroupDayLimit) MarshalJSON() ([]byte, error) {
+	type group ProcessGroupDayLimit // avoids recursion
+
+	if len(g.PL) == 0 {
+		return json.Marshal(group(g))
+	}
+
+	aux := struct {
+		group
+		Processes []any `json:"processes"`
+	}{group: group(g)}
+
+	for _, p := range g.PG {
+		if pl, ok := g.PL[p]; ok {
+			aux.Processes = append(aux.Processes, pl)
+		} else {
+			aux.Processes = append(aux.Processes, p)
+		}
+	}
+
+	return json.Marshal(aux)
+}
+
+// UnmarshalJSON unmarshals g, where each entry of "processes" is either a process name or a ProcessDayLimit object
+func (g *ProcessGroupDayLimit) UnmarshalJSON(data []byte) error {
+	type group ProcessGroupDayLimit // avoids recursion
+
+	var aux struct {
+		group
+		Processes []json.RawMessage `json:"processes"`
+	}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	*g = ProcessGroupDayLimit(aux.group)
+
+	if aux.Processes != nil {
+		g.PG = make([]string, 0, len(aux.Processes))
+	}
+
+	for _, raw := range aux.Processes {
+		var name string
+		if json.Unmarshal(raw, &name) == nil {
+			g.PG = append(g.PG, name)
+			continue
+		}
+
+		var pl ProcessDayLimit
+		err := json.Unmarshal(raw, &pl)
+		if err != nil {
+			return err
+		}
+		if g.PL == nil {
+			g.PL = make(map[string]ProcessDayLimit)
+		}
+		g.PG = append(g.PG, pl.Name)
+		g.PL[pl.Name] = pl
+	}
+
+	return nil
+}
+
 // reDate is a compiled regex for dates yyyy-mm-dd
 var reDate = regexp.MustCompile(`^\d{1,4}-\d{1,2}-\d{1,2}$`)
 
@@ -156,36 +240,297 @@ func isValidDowntimeFormat(dnt Downtime) bool {
 	return true
 }
 
-// parseConfig parses configuration from b, represented as JSON
-func parseConfig(b []byte) ([]ProcessGroupDayLimit, error) {
-	var limits []ProcessGroupDayLimit
+// MarshalJSON marshals cfg as a bare array of process groups, when no settings are used,
+// and as an object otherwise
+func (cfg Config) MarshalJSON() ([]byte, error) {
+	if reflect.DeepEqual(cfg, Config{Groups: cfg.Groups}) {
+		return json.Marshal(cfg.Groups)
+	}
+
+	type config Config // avoids recursion
+	return json.Marshal(config(cfg))
+}
+
+// UnmarshalJSON unmarshals cfg either from a bare array of process groups, or from an object
+func (cfg *Config) UnmarshalJSON(data []byte) error {
+	if b := bytes.TrimSpace(data); len(b) > 0 && b[0] == '[' {
+		*cfg = Config{}
+		return json.Unmarshal(b, &cfg.Groups)
+	}
+
+	type config Config // avoids recursion
+	var aux config
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	*cfg = Config(aux)
+
+	return nil
+}
+
+// groups returns the process groups of cfg, followed by the process groups of its profiles.
+// The groups of a profile are limited to the user of the profile,
+// and their IDs (and the parents that refer to groups of the same profile) are prefixed with the user name.
+func (cfg Config) groups() []ProcessGroupDayLimit {
+	if len(cfg.Profiles) == 0 {
+		return cfg.Groups
+	}
+
+	groups := slices.Clone(cfg.Groups)
+	for _, pr := range cfg.Profiles {
+		ids := make(map[string]bool)
+		for _, g := range pr.Groups {
+			ids[g.GroupID()] = true
+		}
+
+		for _, g := range pr.Groups {
+			g.ID = pr.User + "." + g.GroupID()
+			if ids[g.Parent] {
+				g.Parent = pr.User + "." + g.Parent
+			}
+			g.Users = []string{pr.User}
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+// parseConfig parses configuration from b, represented as JSON (see decodeConfig)
+func parseConfig(b []byte) (Config, error) {
+	cfg, _, err := decodeConfig(b)
+	return cfg, err
+}
+
+// decodeConfig parses and validates configuration from b, represented as JSON,
+// and sets the IDs of the groups that have none (see Config.assignIDs). It returns whether any ID was set.
+func decodeConfig(b []byte) (Config, bool, error) {
+	var cfg Config
 
-	err := json.Unmarshal(b, &limits)
+	err := json.Unmarshal(b, &cfg)
 	if err != nil {
-		return nil, err
+		return Config{}, false, err
+	}
+	assigned := cfg.assignIDs()
+
+	cfg, err = validateConfig(cfg)
+	return cfg, assigned, err
+}
+
+// validateConfig validates cfg, and returns it
+func validateConfig(cfg Config) (Config, error) {
+	if r := cfg.Retention; r != nil {
+		if r.DetailDays < 0 || r.TopUnmatched < 0 {
+			return Config{}, errors.New(fmt.Sprintln("Retention settings cannot be negative"))
+		}
+	}
+
+	users := make(map[string]bool)
+	for _, pr := range cfg.Profiles {
+		if pr.User == "" {
+			return Config{}, errors.New(fmt.Sprintln("User required in profile"))
+		}
+		if users[pr.User] {
+			return Config{}, errors.New(fmt.Sprintln("Duplicate profile of user", pr.User))
+		}
+		users[pr.User] = true
+		for _, g := range pr.Groups {
+			if len(g.Users) > 0 {
+				return Config{}, errors.New(fmt.Sprintln("Process group", g.GroupID(), "in the profile of", pr.User, "cannot set users"))
+			}
+		}
+		if !isValidDayLimitsFormat(pr.SessionLimit) {
+			return Config{}, errors.New(fmt.Sprintln("Bad date or days of the week format in session limit of", pr.User, ":", pr.SessionLimit))
+		}
+		if !isValidDowntimeFormat(pr.SessionDowntime) {
+			return Config{}, errors.New(fmt.Sprintln("Bad format of session downtime of", pr.User, ":", pr.SessionDowntime))
+		}
+	}
+	if cfg.SessionCommand != nil && len(cfg.SessionCommand) == 0 {
+		return Config{}, errors.New(fmt.Sprintln("Session command cannot be empty"))
+	}
+	for _, h := range cfg.Webhooks {
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return Config{}, errors.New(fmt.Sprintln("Bad webhook URL", h.URL))
+		}
+	}
+	if m := cfg.MQTT; m != nil {
+		if _, _, err := net.SplitHostPort(m.Broker); err != nil {
+			return Config{}, errors.New(fmt.Sprintln("Bad MQTT broker address", m.Broker))
+		}
+	}
+	if e := cfg.Email; e != nil {
+		if _, _, err := net.SplitHostPort(e.Server); err != nil {
+			return Config{}, errors.New(fmt.Sprintln("Bad SMTP server address", e.Server))
+		}
+		if _, err := mail.ParseAddress(e.From); err != nil {
+			return Config{}, errors.New(fmt.Sprintln("Bad email sender address", e.From))
+		}
+		if len(e.To) == 0 {
+			return Config{}, errors.New(fmt.Sprintln("No email recipients"))
+		}
+		for _, to := range e.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return Config{}, errors.New(fmt.Sprintln("Bad email recipient address", to))
+			}
+		}
+		if _, err := time.Parse(dtTimeFormat, e.Digest); e.Digest != "" && err != nil {
+			return Config{}, errors.New(fmt.Sprintln("Bad daily digest time", e.Digest))
+		}
+	}
+	for _, w := range cfg.Warnings {
+		if d, err := time.ParseDuration(w); err != nil || d <= 0 {
+			return Config{}, errors.New(fmt.Sprintln("Bad warning threshold", w))
+		}
+	}
+	if cfg.RequestExpiry != "" {
+		if d, err := time.ParseDuration(cfg.RequestExpiry); err != nil || d <= 0 {
+			return Config{}, errors.New(fmt.Sprintln("Bad request expiry", cfg.RequestExpiry))
+		}
+	}
+	if cfg.RequestsPerDay < 0 {
+		return Config{}, errors.New(fmt.Sprintln("Bad number of requests per day", cfg.RequestsPerDay))
+	}
+	if cfg.FastCheck != "" {
+		if d, err := time.ParseDuration(cfg.FastCheck); err != nil || d < 0 {
+			return Config{}, errors.New(fmt.Sprintln("Bad fast check period", cfg.FastCheck))
+		}
+	}
+
+	limits := cfg.groups()
+	ids := make(map[string]bool)
+	parents := make(map[string]string)
+	for _, l := range limits {
+		if l.Parent != "" {
+			parents[l.GroupID()] = l.Parent
+		}
+	}
+	hasChildren := make(map[string]bool)
+	for _, p := range parents {
+		hasChildren[p] = true
 	}
 
 	for _, l := range limits {
-		if len(l.PG) == 0 {
-			return nil, errors.New(fmt.Sprintln("Process list required"))
+		id := l.GroupID()
+		if len(l.PG) == 0 && !hasChildren[id] {
+			return Config{}, errors.New(fmt.Sprintln("Process list required (unless the group is a parent of other groups)"))
 		}
-		if len(l.DL) == 0 && len(l.DT) == 0 {
-			return nil, errors.New(fmt.Sprintln("Both Day limits and Downtime configurations are missing. At least one of them should be configured"))
+		if !reGroupID.MatchString(id) {
+			return Config{}, errors.New(fmt.Sprintln("Bad process group id:", id))
+		}
+		if ids[id] {
+			return Config{}, errors.New(fmt.Sprintln("Duplicate process group id:", id))
+		}
+		ids[id] = true
+		switch l.Type {
+		case "":
+			if l.Enforce {
+				return Config{}, errors.New(fmt.Sprintln("enforce is a setting of allowlist groups only, in process group", id))
+			}
+		case GroupTypeAllowlist:
+			if len(l.Users) == 0 {
+				return Config{}, errors.New(fmt.Sprintln("Target users required in allowlist group", id))
+			}
+			if l.Unprotect {
+				return Config{}, errors.New(fmt.Sprintln("Allowlist group", id, "cannot allow protected processes"))
+			}
+		default:
+			return Config{}, errors.New(fmt.Sprintln("Bad type of process group", id, ":", l.Type))
+		}
+		if !l.Unprotect {
+			for _, p := range l.PG {
+				if isProtectedName(p, cfg.Protected) {
+					return Config{}, errors.New(fmt.Sprintln("Process", p, "in process group", id, "is protected (set allow_protected to override)"))
+				}
+			}
+			if l.Launcher != "" && isProtectedName(l.Launcher, cfg.Protected) {
+				return Config{}, errors.New(fmt.Sprintln("Launcher", l.Launcher, "of process group", id, "is protected (set allow_protected to override)"))
+			}
+		}
+		switch l.Accounting {
+		case "":
+			if l.CPUThreshold != 0 {
+				return Config{}, errors.New(fmt.Sprintln("cpu_threshold is a setting of groups with cpu accounting only, in process group", id))
+			}
+		case AccountingCPU:
+			if l.CPUThreshold < 0 {
+				return Config{}, errors.New(fmt.Sprintln("Negative cpu_threshold in process group", id))
+			}
+		default:
+			return Config{}, errors.New(fmt.Sprintln("Bad accounting of process group", id, ":", l.Accounting))
+		}
+		if l.Color != "" && !reColor.MatchString(l.Color) {
+			return Config{}, errors.New(fmt.Sprintln("Bad color of process group", id, ":", l.Color))
+		}
+		if len(l.DL) == 0 && len(l.DT) == 0 && l.Parent == "" {
+			return Config{}, errors.New(fmt.Sprintln("Both Day limits and Downtime configurations are missing. At least one of them should be configured (unless the group has a parent)"))
 		}
 		if !isValidDayLimitsFormat(l.DL) {
-			return nil, errors.New(fmt.Sprintln("Bad date or days of the week format in Day limits:", l.DL))
+			return Config{}, errors.New(fmt.Sprintln("Bad date or days of the week format in Day limits:", l.DL))
 		}
 		if !isValidDowntimeFormat(l.DT) {
-			return nil, errors.New(fmt.Sprintln("Bad format of Downtime settings:", l.DT))
+			return Config{}, errors.New(fmt.Sprintln("Bad format of Downtime settings:", l.DT))
+		}
+		for _, pl := range l.PL {
+			if pl.Name == "" {
+				return Config{}, errors.New(fmt.Sprintln("Process name required in process group", id))
+			}
+			if len(pl.DL) == 0 && len(pl.DT) == 0 {
+				return Config{}, errors.New(fmt.Sprintln("Both Day limits and Downtime configurations of process", pl.Name, "are missing"))
+			}
+			if !isValidDayLimitsFormat(pl.DL) {
+				return Config{}, errors.New(fmt.Sprintln("Bad date or days of the week format in Day limits of process", pl.Name, ":", pl.DL))
+			}
+			if !isValidDowntimeFormat(pl.DT) {
+				return Config{}, errors.New(fmt.Sprintln("Bad format of Downtime settings of process", pl.Name, ":", pl.DT))
+			}
+		}
+	}
+
+	// parent groups must exist and must not form cycles
+	for id, p := range parents {
+		visited := map[string]bool{id: true}
+		for ; p != ""; p = parents[p] {
+			if !ids[p] {
+				return Config{}, errors.New(fmt.Sprintln("Parent group", p, "of", id, "does not exist"))
+			}
+			if visited[p] {
+				return Config{}, errors.New(fmt.Sprintln("Process group", id, "is its own parent"))
+			}
+			visited[p] = true
+		}
+	}
+
+	// the balance of a group adds up the balance of its child groups, so a process of the same users in two groups
+	// of a subtree would be counted twice in the groups above them
+	owners := make(map[string]map[string][]int) // the groups of each process name in the subtree of a group, by group ID
+	for i, l := range limits {
+		id := l.GroupID()
+		for a := id; a != ""; a = parents[a] {
+			if owners[a] == nil {
+				owners[a] = make(map[string][]int)
+			}
+			for _, name := range l.PG {
+				for _, o := range owners[a][name] {
+					if o != i && limits[o].sharesUsers(l) {
+						return Config{}, errors.New(fmt.Sprintln("Process", name, "is in both process group", limits[o].GroupID(), "and", id, "under process group", a))
+					}
+				}
+				owners[a][name] = append(owners[a][name], i)
+			}
 		}
 	}
 
-	return limits, nil
+	return cfg, nil
 }
 
-// setLimits sets ph.limits, ph.cfgTime
-func (ph *ProcessHunter) setLimits(limits []ProcessGroupDayLimit) error {
-	ph.limits = limits
+// setLimits sets ph.config, ph.limits, ph.cfgTime
+func (ph *ProcessHunter) setLimits(cfg Config) error {
+	ph.config = cfg
+	ph.limits = cfg.groups()
+	ph.webhooks.set(cfg.Webhooks)
+	ph.mailer.set(cfg.Email)
+	ph.publish(UpdateConfig)
 
 	if ph.cfgPath != "" {
 		file, err := os.Stat(ph.cfgPath)
@@ -198,44 +543,98 @@ func (ph *ProcessHunter) setLimits(limits []ProcessGroupDayLimit) error {
 	}
 
 	// trigger process check
-	select {
-	case ph.forceCheck <- struct{}{}:
-	default:
-	}
+	ph.force()
 
 	return nil
 }
 
-// SetConfig sets configuration b (represented as JSON) and saves it to the ph.cfgPath
+// SetConfig sets configuration b (represented as JSON) and saves it to the ph.cfgPath, readable by the owner only
 // if ph.cfgPath is "", then the call succeeds without saving config file
 // if ph.cfgPath cannot be written, the call fails and new config is not set.
+// The secrets that are SecretPlaceholder keep their current values (see GetRedactedConfig),
+// and the groups without an ID are saved with the ID they get (see Config.assignIDs).
 func (ph *ProcessHunter) SetConfig(b []byte) error {
-	limits, err := parseConfig(b)
+	ph.limitsRWM.Lock()
+	defer ph.limitsRWM.Unlock()
+
+	return ph.setConfig(b)
+}
+
+// updateConfig applies update to a copy of the current configuration, and sets (and saves) the result like SetConfig.
+// ph.limitsRWM is locked throughout, so that the configuration doesn't change in between.
+// update must copy the slices and maps of the configuration it modifies.
+func (ph *ProcessHunter) updateConfig(update func(cfg *Config) error) error {
+	ph.limitsRWM.Lock()
+	defer ph.limitsRWM.Unlock()
+
+	cfg := ph.config
+	if err := update(&cfg); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(cfg, "", "    ")
 	if err != nil {
 		return err
 	}
+	return ph.setConfig(b)
+}
 
-	ph.limitsRWM.Lock()
-	defer ph.limitsRWM.Unlock()
+// setConfig implements SetConfig. ph.limitsRWM must be locked by the caller.
+func (ph *ProcessHunter) setConfig(b []byte) error {
+	cfg, assigned, err := decodeConfig(b)
+	if err != nil {
+		return err
+	}
+
+	err = ph.checkAllowlists(cfg)
+	if err != nil {
+		return err
+	}
+
+	cfg, restored := cfg.withSecrets(ph.config)
+	if restored || assigned {
+		if b, err = json.MarshalIndent(cfg, "", "    "); err != nil {
+			return err
+		}
+	}
 
 	if ph.cfgPath != "" {
-		err = os.WriteFile(ph.cfgPath, b, 0644)
+		err = os.WriteFile(ph.cfgPath, b, 0600)
 		if err != nil {
 			return err
 		}
+		// the file may have been created readable by others
+		if err = os.Chmod(ph.cfgPath, 0600); err != nil {
+			return err
+		}
 	}
 
-	return ph.setLimits(limits)
+	if err = ph.setLimits(cfg); err != nil {
+		return err
+	}
+	ph.metrics.loaded(nil) // the config file is valid again, if it was written
+	ph.emit(Event{Type: EventConfig, Message: "config changed"})
+
+	return nil
 }
 
-// LoadConfig loads ProcessHunter configuration from path
-func (ph *ProcessHunter) LoadConfig() error {
+// LoadConfig loads ProcessHunter configuration from path.
+// The groups without an ID get one (see Config.assignIDs), which is saved to the config file.
+// Load the balance first (see LoadBalance), since it holds the audits of the allowlist groups.
+func (ph *ProcessHunter) LoadConfig() (err error) {
+	defer func() { ph.metrics.loaded(err) }()
+
 	b, err := os.ReadFile(ph.cfgPath)
 	if err != nil {
 		return err
 	}
 
-	limits, err := parseConfig(b)
+	cfg, assigned, err := decodeConfig(b)
+	if err != nil {
+		return err
+	}
+
+	err = ph.checkAllowlists(cfg)
 	if err != nil {
 		return err
 	}
@@ -243,33 +642,138 @@ func (ph *ProcessHunter) LoadConfig() error {
 	ph.limitsRWM.Lock()
 	defer ph.limitsRWM.Unlock()
 
-	return ph.setLimits(limits)
+	if assigned {
+		log.Println("saving the ids of the process groups to", ph.cfgPath)
+		if b, err = json.MarshalIndent(cfg, "", "    "); err != nil {
+			return err
+		}
+		if err = os.WriteFile(ph.cfgPath, b, 0600); err != nil {
+			log.Println("error saving the ids of the process groups:", err)
+		}
+	}
+
+	return ph.setLimits(cfg)
+}
+
+// balanceFile is the representation of the balance history in the balance file
+type balanceFile struct {
+	Processes dayTimeBalance       `json:"processes"`            // per-process daily balance
+	Groups    dayTimeBalance       `json:"groups,omitempty"`     // per-group daily totals of compacted days
+	Users     userTimeBalance      `json:"users,omitempty"`      // per-user daily balance
+	Idle      dayTimeBalance       `json:"idle,omitempty"`       // per-process daily time while the owner was idle
+	UsersIdle userTimeBalance      `json:"users_idle,omitempty"` // per-user daily time while the user was idle
+	CPU       dayTimeBalance       `json:"cpu,omitempty"`        // per-process daily CPU time
+	CPUIdle   userTimeBalance      `json:"cpu_idle,omitempty"`   // per-group daily time the processes didn't use enough CPU time
+	Sessions  dayTimeBalance       `json:"sessions,omitempty"`   // per-user daily session time
+	Grants    []Grant              `json:"grants,omitempty"`     // grants that were active when the balance was saved
+	Blocks    map[string]time.Time `json:"blocks,omitempty"`     // manual blocks of the groups: when they end, by group ID
+	Requests  []TimeRequest        `json:"requests,omitempty"`   // requests for more time: the pending ones, and the history
+	Lockdown  *time.Time           `json:"lockdown,omitempty"`   // when the lockdown of all the groups ends
+	Vacation  *time.Time           `json:"vacation,omitempty"`   // when the suspension of the enforcement ends
+
+	Audits []AllowlistPreview `json:"audits,omitempty"` // audit previews of the allowlist groups
 }
 
-// LoadBalance loads the balance from ph.balancePath, represented as JSON
+// LoadBalance loads the balance from ph.balancePath, represented as JSON.
+// Balance files that contain only the per-process daily balance (older format) are supported too.
 func (ph *ProcessHunter) LoadBalance() error {
 	ph.balanceRWM.Lock()
 	defer ph.balanceRWM.Unlock()
 
 	ph.balance = make(dayTimeBalance)
+	ph.groupsHist = make(dayTimeBalance)
+	ph.users = make(userTimeBalance)
+	ph.idle = make(dayTimeBalance)
+	ph.usersIdle = make(userTimeBalance)
+	ph.cpu = make(dayTimeBalance)
+	ph.cpuIdle = make(userTimeBalance)
+	ph.sessions = make(dayTimeBalance)
+	ph.compacted = compaction{}
+	ph.grants = nil
+	ph.requests = nil
+	ph.blocks = make(map[string]time.Time)
+	ph.lockdown, ph.vacation = time.Time{}, time.Time{}
 
 	b, err := os.ReadFile(ph.balancePath)
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(b, &ph.balance)
+	var keys map[string]json.RawMessage
+	err = json.Unmarshal(b, &keys)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := keys["processes"]; !ok { // older format
+		return json.Unmarshal(b, &ph.balance)
+	}
+
+	bf := balanceFile{Processes: ph.balance, Groups: ph.groupsHist}
+	err = json.Unmarshal(b, &bf)
+	if err != nil {
+		return err
+	}
+
+	if bf.Processes != nil {
+		ph.balance = bf.Processes
+	}
+	if bf.Groups != nil {
+		ph.groupsHist = bf.Groups
+	}
+	if bf.Users != nil {
+		ph.users = bf.Users
+	}
+	if bf.Idle != nil {
+		ph.idle = bf.Idle
+	}
+	if bf.UsersIdle != nil {
+		ph.usersIdle = bf.UsersIdle
+	}
+	if bf.CPU != nil {
+		ph.cpu = bf.CPU
+	}
+	if bf.CPUIdle != nil {
+		ph.cpuIdle = bf.CPUIdle
+	}
+	if bf.Sessions != nil {
+		ph.sessions = bf.Sessions
+	}
+	ph.grants = bf.Grants
+	ph.requests = bf.Requests
+	if bf.Blocks != nil {
+		ph.blocks = bf.Blocks
+	}
+	if bf.Lockdown != nil {
+		ph.lockdown = *bf.Lockdown
+	}
+	if bf.Vacation != nil {
+		ph.vacation = *bf.Vacation
+	}
+
+	ph.auditsRWM.Lock()
+	defer ph.auditsRWM.Unlock()
+
+	ph.audits = make(map[string]AllowlistPreview)
+	for _, ap := range bf.Audits {
+		ph.audits[ap.Group] = ap
+	}
+
+	return nil
 }
 
 // saveBalance saves balance to ph.balancePath in JSON format
 func (ph *ProcessHunter) saveBalance() error {
-	d, err := json.MarshalIndent(ph.balance, "", "\t")
+	d, err := json.MarshalIndent(balanceFile{Processes: ph.balance, Groups: ph.groupsHist, Users: ph.users, Idle: ph.idle, UsersIdle: ph.usersIdle, CPU: ph.cpu, CPUIdle: ph.cpuIdle, Sessions: ph.sessions, Grants: ph.grants, Blocks: ph.blocks, Requests: ph.requests, Lockdown: timeRef(ph.lockdown), Vacation: timeRef(ph.vacation), Audits: ph.GetAllowlistPreviews()}, "", "\t")
 
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(ph.balancePath, d, 0644)
+	err = os.WriteFile(ph.balancePath, d, 0644)
+	ph.metrics.saved(time.Now(), err)
+
+	return err
 }
 
 // SaveBalance saves balance in a thread-safe way
@@ -8,8 +8,6 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/mitchellh/go-ps"
 )
 
 // time format used in downtime specs
@@ -34,10 +32,106 @@ type Downtime map[string][]string
 
 // ProcessGroupDayLimit specifies day time limit DL and downtime periods DT
 // for one or more processes in PG
+// ID, Name, Description, Enabled and Color are optional.
+// When ID is not set, the group gets an ID derived from Name or from the first process name, which is saved to the config file (see GroupID).
 type ProcessGroupDayLimit struct {
-	PG []string  `json:"processes"` // PG is the list of process names in this group
-	DL DayLimits `json:"limits"`    // DL defines the daily time limits for this group
-	DT Downtime  `json:"downtime"`  // DT specifies downtime periods when processes are blocked
+	ID              string    `json:"id,omitempty"`               // ID identifies the group; the group history is stored by ID
+	Name            string    `json:"name,omitempty"`             // Name is a human friendly name of the group
+	Description     string    `json:"description,omitempty"`      // Description describes the group
+	Enabled         *bool     `json:"enabled,omitempty"`          // Enabled indicates whether limits and downtime are enforced (true if not set)
+	Color           string    `json:"color,omitempty"`            // Color is used to present the group in the UI
+	PG              []string  `json:"processes"`                  // PG is the list of process names in this group
+	DL              DayLimits `json:"limits"`                     // DL defines the daily time limits for this group
+	DT              Downtime  `json:"downtime"`                   // DT specifies downtime periods when processes are blocked
+	Parent          string    `json:"parent,omitempty"`           // Parent is the ID of the parent group, whose limit and downtime apply to this group too
+	Unprotect       bool      `json:"allow_protected,omitempty"`  // Unprotect allows the group to list (and kill) protected executables
+	KillTree        bool      `json:"kill_tree,omitempty"`        // KillTree kills the descendants of the killed processes too
+	Launcher        string    `json:"launcher,omitempty"`         // Launcher is the name of an ancestor of the processes, that is killed with them
+	EscalateRespawn bool      `json:"escalate_respawn,omitempty"` // EscalateRespawn kills the parent of a process that respawned after a kill
+	Type            string    `json:"type,omitempty"`             // Type is "" for a regular group, or GroupTypeAllowlist
+	Accounting      string    `json:"accounting,omitempty"`       // Accounting is "" to count the running time of the processes, or AccountingCPU
+	CPUThreshold    float64   `json:"cpu_threshold,omitempty"`    // CPUThreshold is the CPU time (percent of the running time) above which a process is in use, with AccountingCPU
+	CountIdle       bool      `json:"count_idle,omitempty"`       // CountIdle counts the running time of the processes while their owners are idle
+	Users           []string  `json:"users,omitempty"`            // Users limits the group to the processes of these users (all users if not set); required in allowlist groups
+	Enforce         bool      `json:"enforce,omitempty"`          // Enforce turns an allowlist group from audit mode to enforcement
+
+	PL map[string]ProcessDayLimit `json:"-"` // PL maps process names in PG to their own limits, see ProcessDayLimit
+}
+
+// ProcessDayLimit specifies day time limit DL and downtime periods DT of a single process within a process group.
+// They apply in addition to the limits and downtime of the group, and only the process is killed when they apply.
+// In the configuration, an entry of "processes" can be either a process name, or a ProcessDayLimit object.
+type ProcessDayLimit struct {
+	Name string    `json:"name"`               // Name is the process name
+	DL   DayLimits `json:"limits,omitempty"`   // DL defines the daily time limits for the process
+	DT   Downtime  `json:"downtime,omitempty"` // DT specifies downtime periods when the process is blocked
+}
+
+// Retention controls how much balance history is kept and which processes are tracked
+type Retention struct {
+	DetailDays   int  `json:"detail_days,omitempty"`   // DetailDays is how many days of per-process history to keep (0 keeps it forever)
+	OnlyGroups   bool `json:"only_groups,omitempty"`   // OnlyGroups limits the history to processes matched by a group
+	TopUnmatched int  `json:"top_unmatched,omitempty"` // TopUnmatched is how many unmatched processes are kept per day when OnlyGroups is set
+}
+
+// Settings holds the configuration that is not specific to a process group
+type Settings struct {
+	Retention     *Retention `json:"retention,omitempty"`      // Retention controls the balance history
+	Protected     []string   `json:"protected,omitempty"`      // Protected extends the built-in list of executables that are never killed
+	ProtectedPIDs []int      `json:"protected_pids,omitempty"` // ProtectedPIDs lists PIDs that are never killed, in addition to PID 1, ph and its parents
+
+	// SessionCommand is the command (the program followed by its arguments) that ends or locks a session,
+	// when the session limit or downtime of a profile applies. {user}, {tty} and {pid} are replaced with those of the session.
+	SessionCommand []string `json:"session_command,omitempty"`
+
+	// FastCheck is how often the processes of the blocked process groups are checked (e.g. "5s"), between the regular checks.
+	// The default is 5 seconds, and "0s" disables the fast checks.
+	FastCheck string `json:"fast_check,omitempty"`
+	// Netlink enables exec notifications of the Linux process connector, to check new processes as soon as they start
+	Netlink bool `json:"netlink,omitempty"`
+	// Warnings lists how long before enforcement the users are warned (e.g. "10m").
+	// The default is 10 and 2 minutes, and an empty list disables the warnings.
+	Warnings []string `json:"warnings"`
+	// Webhooks lists the HTTP endpoints that receive the events
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// MQTT configures publishing the balance of the groups to an MQTT broker
+	MQTT *MQTT `json:"mqtt,omitempty"`
+	// Email configures the email notifications and the daily digest
+	Email *Email `json:"email,omitempty"`
+	// RequestExpiry is how long a request for more time waits for a decision (e.g. "30m"); the default is 1 hour
+	RequestExpiry string `json:"request_expiry,omitempty"`
+	// RequestsPerDay is how many requests for more time a user can make per day; the default is 3
+	RequestsPerDay int `json:"requests_per_day,omitempty"`
+}
+
+// MQTT describes the connection to an MQTT broker, and the topics ph uses
+type MQTT struct {
+	Broker    string `json:"broker"`              // Broker is the address of the broker (host:port), e.g. "localhost:1883"
+	ClientID  string `json:"client_id,omitempty"` // ClientID identifies ph to the broker ("ph" by default)
+	Username  string `json:"username,omitempty"`  // Username is the user name to connect with, if any
+	Password  string `json:"password,omitempty"`  // Password is the password to connect with, if any
+	Topic     string `json:"topic,omitempty"`     // Topic is the prefix of the state and command topics ("ph" by default)
+	Discovery string `json:"discovery,omitempty"` // Discovery is the prefix of the Home Assistant discovery topics ("homeassistant" by default)
+	Commands  bool   `json:"commands,omitempty"`  // Commands enables the commands that grant time to, block and unblock the groups
+}
+
+// Profile holds the process groups of a single user.
+// The groups of a profile apply only to the processes of the user, and their IDs are prefixed with the user name,
+// e.g. group "games" of user "alice" has ID "alice.games" (see Config.groups).
+type Profile struct {
+	User            string                 `json:"user"`                       // User is the name of the user
+	Groups          []ProcessGroupDayLimit `json:"groups"`                     // Groups lists the process groups of the user
+	SessionLimit    DayLimits              `json:"session_limit,omitempty"`    // SessionLimit defines the daily limits of the time the user is logged in
+	SessionDowntime Downtime               `json:"session_downtime,omitempty"` // SessionDowntime specifies periods when the user cannot be logged in
+}
+
+// Config is the complete ProcessHunter configuration.
+// It is represented as a JSON object with the process groups in "groups" and the settings next to them,
+// or as a bare JSON array of process groups, when no settings are used.
+type Config struct {
+	Groups   []ProcessGroupDayLimit `json:"groups"`             // Groups lists the monitored process groups
+	Profiles []Profile              `json:"profiles,omitempty"` // Profiles lists the process groups of particular users
+	Settings
 }
 
 // prettyDuration only purpose is to override MarshalJSON to present time.Duration in more human friendly format
@@ -47,13 +141,29 @@ type prettyDuration struct {
 
 // ProcessGroupDayBalance describes day limits and monitored properties of a process group PG
 type ProcessGroupDayBalance struct {
-	PG           []string       `json:"processes"`      // PG is the list of process names in this group
-	Limit        prettyDuration `json:"limit"`          // Limit is the active daily time limit for the group
-	LimitDefined bool           `json:"limit_defined"`  // LimitDefined indicates whether a limit is defined for today
-	Balance      prettyDuration `json:"balance"`        // Balance is the total time used by the group today
-	Downtime     []string       `json:"downtime"`       // Downtime lists the active downtime periods for today
-	Blocked      bool           `json:"blocked"`        // Blocked indicates whether the group is currently in downtime
-	TimeStamp    string         `json:"timestamp"`      // TimeStamp is when this balance was calculated (HH:MM format)
+	ID             string         `json:"id"`                          // ID identifies the group
+	Name           string         `json:"name,omitempty"`              // Name is a human friendly name of the group
+	Description    string         `json:"description,omitempty"`       // Description describes the group
+	Enabled        bool           `json:"enabled"`                     // Enabled indicates whether limits and downtime are enforced
+	Color          string         `json:"color,omitempty"`             // Color is used to present the group in the UI
+	Users          []string       `json:"users,omitempty"`             // Users lists the users whose processes are in the group (all users if empty)
+	Parent         string         `json:"parent,omitempty"`            // Parent is the ID of the parent group
+	Children       []string       `json:"children,omitempty"`          // Children lists the IDs of the child groups
+	PG             []string       `json:"processes"`                   // PG is the list of process names in this group
+	Limit          prettyDuration `json:"limit"`                       // Limit is the active daily time limit for the group
+	LimitDefined   bool           `json:"limit_defined"`               // LimitDefined indicates whether a limit is defined for today
+	Balance        prettyDuration `json:"balance"`                     // Balance is the total time used by the group (and its child groups) today
+	Overtime       bool           `json:"overtime"`                    // Overtime indicates whether the balance exceeds the limit
+	Downtime       []string       `json:"downtime"`                    // Downtime lists the active downtime periods for today
+	Blocked        bool           `json:"blocked"`                     // Blocked indicates whether the group is currently in downtime
+	BlockedBy      string         `json:"blocked_by,omitempty"`        // BlockedBy is the ID of the group (this one or a parent) whose limit or downtime is enforced
+	BlockReason    string         `json:"block_reason,omitempty"`      // BlockReason is why the group is enforced, e.g. BlockLimit
+	BlockedPG      []string       `json:"blocked_processes,omitempty"` // BlockedPG lists the processes blocked by their own limits or downtime
+	BlockedAt      *time.Time     `json:"blocked_at,omitempty"`        // BlockedAt is when the group is predicted to be blocked, if it's not blocked
+	GrantedUntil   *time.Time     `json:"granted_until,omitempty"`     // GrantedUntil is when the active grant of the group expires
+	BlockedUntil   *time.Time     `json:"blocked_until,omitempty"`     // BlockedUntil is when the manual block (or the lockdown) of the group ends
+	SuspendedUntil *time.Time     `json:"suspended_until,omitempty"`   // SuspendedUntil is when the vacation, that suspends the enforcement, ends
+	TimeStamp      string         `json:"timestamp"`                   // TimeStamp is when this balance was calculated (HH:MM format)
 }
 
 // TimeBalance maps process name to running time
@@ -62,20 +172,49 @@ type TimeBalance map[string]time.Duration
 // dayTimeBalance maps date to process running time
 type dayTimeBalance map[string]TimeBalance
 
+// userTimeBalance maps user name to the user's balance history
+type userTimeBalance map[string]dayTimeBalance
+
 // ProcessHunter is monitoring and killing processes that go overtime, and during downtime
 // for particular day
 type ProcessHunter struct {
 	limitsRWM sync.RWMutex
-	limits    []ProcessGroupDayLimit // configuration
+	config    Config                 // configuration, as loaded
+	limits    []ProcessGroupDayLimit // process groups of the configuration
 
 	balanceRWM  sync.RWMutex
-	balance     dayTimeBalance // balance history
-	checkPeriod time.Duration  // how often to check processes
-	forceCheck  chan struct{}  // channel that forces balance check (outside of checkPeriod)
-	balancePath string         // where balance is periodically stored
-	savePeriod  time.Duration  // how often to save balance to balancePath
-
-	killer func(pid int) error
+	balance     dayTimeBalance             // balance history
+	groupsHist  dayTimeBalance             // per-group daily totals of days that are no longer kept in balance
+	compacted   compaction                 // when and how the balance history was last compacted
+	users       userTimeBalance            // per-user balance history
+	idle        dayTimeBalance             // balance history of the time the owners were idle
+	usersIdle   userTimeBalance            // per-user balance history of the time the user was idle
+	cpuIdle     userTimeBalance            // per-group balance history of the time the processes didn't use enough CPU time (see AccountingCPU)
+	sessions    dayTimeBalance             // session time history, by user
+	cpu         dayTimeBalance             // CPU time history of the processes
+	lastKills   map[string]time.Time       // when a process was last killed, by group and process name (see respawnKey)
+	cpuTimes    map[int]time.Duration      // CPU time of the running processes, by PID, as of the last check
+	warned      map[string]string          // the date when a session warning was emitted, by user
+	ended       map[string]map[string]bool // the sessions ended today (see sessionKey), and the users without a session command, by date
+	notified    map[string]map[string]bool // the warnings sent today (by group ID and threshold), by date
+	kills       map[killKey][]string       // the names of the processes killed since the last notifyKills, by group and user
+	grants      []Grant                    // grants, including the expired ones until the next check
+	requests    []TimeRequest              // requests for more time: the pending ones, and the history
+	blocks      map[string]time.Time       // manual blocks: when they end, by group ID
+	lockdown    time.Time                  // when the lockdown of all the groups ends
+	vacation    time.Time                  // when the suspension of the enforcement ends
+	wakeup      *time.Timer                // forces the next process check when enforcement is predicted to change (see wakeAt)
+	checkPeriod time.Duration              // how often to check processes
+	forceCheck  chan struct{}              // channel that forces balance check (outside of checkPeriod)
+	balancePath string                     // where balance is periodically stored
+	savePeriod  time.Duration              // how often to save balance to balancePath
+
+	killer         func(pid int) error
+	runCommand     func(ctx context.Context, cmd []string) error // runs the session command
+	sessionSource  SessionSource                                 // lists the login sessions; nil if not supported
+	activitySource ActivitySource                                // tells whether users are idle; nil if not supported
+	notifier       Notifier                                      // notifies the users about enforcement; nil if disabled
+	pending        *notifications                                // the notifications to send (see runNotify)
 
 	cfgPath string    // path to the config file
 	cfgTime time.Time // write time stamp of the cfgPath. populated when config file is loaded
@@ -83,10 +222,25 @@ type ProcessHunter struct {
 	pgroupsRWM   sync.RWMutex
 	pgroups      []ProcessGroupDayBalance // latest balance of monitored process groups
 	processesRWM sync.RWMutex
-	processes    TimeBalance // latest balance of monitored processes
+	processes    TimeBalance            // latest balance of monitored processes
+	userProcs    map[string]TimeBalance // latest balance of monitored processes, by user
+
+	sessionsBalance []SessionDayBalance // latest session balance of the users (guarded by pgroupsRWM)
 
 	lastSavedRWM sync.RWMutex
 	lastSaved    time.Time // when the balance was last saved
+
+	auditsRWM sync.RWMutex
+	audits    map[string]AllowlistPreview // audit previews of the allowlist groups, by group ID
+
+	eventsRWM sync.RWMutex
+	events    []Event   // latest events
+	webhooks  *webhooks // sends the events to the webhooks
+	mailer    *mailer   // emails the events and the daily digest
+
+	updates subscribers // receive the updates of the snapshot
+	metrics *metrics    // counters exposed by WriteMetrics
+	started time.Time   // when ph was created
 }
 
 // NewProcessHunter initializes and returns a new ProcessHunter
@@ -97,14 +251,34 @@ func NewProcessHunter(
 	killer func(int) error,
 	cfgPath string) *ProcessHunter {
 	return &ProcessHunter{
-		checkPeriod: checkPeriod,
-		forceCheck:  make(chan struct{}),
-		balance:     make(dayTimeBalance),
-		balancePath: balancePath,
-		savePeriod:  savePeriod,
-		killer:      killer,
-		cfgPath:     cfgPath,
-		lastSaved:   time.Now(),
+		checkPeriod:    checkPeriod,
+		forceCheck:     make(chan struct{}, 1),
+		balance:        make(dayTimeBalance),
+		groupsHist:     make(dayTimeBalance),
+		users:          make(userTimeBalance),
+		idle:           make(dayTimeBalance),
+		usersIdle:      make(userTimeBalance),
+		cpuIdle:        make(userTimeBalance),
+		sessions:       make(dayTimeBalance),
+		cpu:            make(dayTimeBalance),
+		lastKills:      make(map[string]time.Time),
+		blocks:         make(map[string]time.Time),
+		warned:         make(map[string]string),
+		audits:         make(map[string]AllowlistPreview),
+		balancePath:    balancePath,
+		savePeriod:     savePeriod,
+		killer:         killer,
+		runCommand:     runCommand,
+		sessionSource:  defaultSessionSource(),
+		activitySource: defaultActivitySource(),
+		notifier:       defaultNotifier(),
+		pending:        newNotifications(),
+		cfgPath:        cfgPath,
+		lastSaved:      time.Now(),
+		webhooks:       newWebhooks(outboxPath(balancePath)),
+		mailer:         newMailer(),
+		metrics:        newMetrics(),
+		started:        time.Now(),
 	}
 }
 
@@ -116,6 +290,14 @@ func (ph *ProcessHunter) GetLimits() []ProcessGroupDayLimit {
 	return ph.limits
 }
 
+// GetConfig returns the current configuration
+func (ph *ProcessHunter) GetConfig() Config {
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+
+	return ph.config
+}
+
 // GetLatestPGroupsBalance returns the latest balance information for all monitored process groups
 func (ph *ProcessHunter) GetLatestPGroupsBalance() []ProcessGroupDayBalance {
 	ph.pgroupsRWM.RLock()
@@ -132,6 +314,55 @@ func (ph *ProcessHunter) GetLatestProcessesBalance() TimeBalance {
 	return ph.processes
 }
 
+// GetLatestUserProcessesBalance returns the latest time balance of the monitored processes of user
+func (ph *ProcessHunter) GetLatestUserProcessesBalance(user string) TimeBalance {
+	ph.processesRWM.RLock()
+	defer ph.processesRWM.RUnlock()
+
+	if tb, ok := ph.userProcs[user]; ok {
+		return tb
+	}
+	return TimeBalance{}
+}
+
+// GetLatestUserPGroupsBalance returns the latest balance information of the process groups that apply to user:
+// the groups of the user, and the groups that are not limited to particular users
+func (ph *ProcessHunter) GetLatestUserPGroupsBalance(user string) []ProcessGroupDayBalance {
+	ph.pgroupsRWM.RLock()
+	defer ph.pgroupsRWM.RUnlock()
+
+	pgbs := make([]ProcessGroupDayBalance, 0, len(ph.pgroups))
+	for _, pgb := range ph.pgroups {
+		if len(pgb.Users) == 0 || slices.Contains(pgb.Users, user) {
+			pgbs = append(pgbs, pgb)
+		}
+	}
+	return pgbs
+}
+
+// GetUsers returns the sorted names of the users that are known to ph:
+// the users in the configuration and the users whose processes ran today
+func (ph *ProcessHunter) GetUsers() []string {
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+
+	var users []string
+	for _, g := range ph.limits {
+		users = append(users, g.Users...)
+	}
+	today := toText(time.Now())
+	for u, dtb := range ph.users {
+		if len(dtb[today]) > 0 {
+			users = append(users, u)
+		}
+	}
+
+	slices.Sort(users)
+	return slices.Compact(users)
+}
+
 // GetBalance returns the complete balance history mapping dates to process time balances
 func (ph *ProcessHunter) GetBalance() dayTimeBalance {
 	ph.balanceRWM.RLock()
@@ -140,6 +371,14 @@ func (ph *ProcessHunter) GetBalance() dayTimeBalance {
 	return ph.balance
 }
 
+// GetGroupsHistory returns the per-group daily totals of the days that are no longer kept in the balance history
+func (ph *ProcessHunter) GetGroupsHistory() dayTimeBalance {
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+
+	return ph.groupsHist
+}
+
 var weekDays = [...]string{
 	"sun",
 	"mon",
@@ -360,14 +599,19 @@ func (ph *ProcessHunter) checkProcesses(ctx context.Context, dt time.Duration) e
 
 	// 0. reload config file, if necessary
 	// ---------------
+	start := time.Now()
 	reloaded, err := ph.reloadConfigIfNeeded()
 	if err != nil {
 		log.Println("error attempting to reload config:", err)
+		if reloaded {
+			ph.metrics.reloadFailed()
+		}
 	}
 
-	if reloaded {
+	if reloaded && err == nil {
 		log.Println("config reloaded:")
 		log.Println(ph.GetLimits())
+		ph.emit(Event{Type: EventConfig, Message: "config file reloaded"})
 	}
 
 	// check if context is cancelled
@@ -379,92 +623,156 @@ func (ph *ProcessHunter) checkProcesses(ctx context.Context, dt time.Duration) e
 
 	// 1. get all processes and update their time balance for the day
 	// ---------------
-	pss, err := ps.Processes()
+	processes, err := listProcesses()
 
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
+	idle := ph.idleUsers(processes)
+	idlePIDs := make(map[int]bool)
+
+	sessions, err := ph.listSessions()
+	if err != nil {
+		log.Println("error listing sessions:", err)
+	}
+
 	now := time.Now()
 	date := toText(now)
-	weekDay := weekDays[now.Weekday()]
+
+	// the sessions are ended after the locks below are released, as the session command may take a while
+	var ends []sessionEnd
+	defer func() { ph.endSessions(ctx, ends) }()
 
 	ph.balanceRWM.Lock()
 	defer ph.balanceRWM.Unlock()
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+	defer ph.notifyKills()
 
-	// Build a map of process names to PIDs for efficient lookup
-	processPidMap := make(map[string][]int)
-	for _, p := range pss {
-		processName := p.Executable()
-		ph.balance.add(date, processName, dt)
-		processPidMap[processName] = append(processPidMap[processName], p.Pid())
+	retention := Retention{}
+	if ph.config.Retention != nil {
+		retention = *ph.config.Retention
+	}
+	matched := groupedProcesses(ph.limits)
+	growth := ph.cpuGrowth(processes)
+	low := lowCPU(ph.limits, processes, dt, growth)
+
+	// Build a process table for efficient lookup
+	pt := newProcessTable(processes, protectedPIDs(processes, ph.config.ProtectedPIDs))
+	for _, p := range processes {
+		processName := p.name
+		if !retention.OnlyGroups || matched[processName] || retention.TopUnmatched > 0 {
+			if g, ok := growth[p.pid]; ok {
+				ph.cpu.add(date, processName, g)
+			}
+			// the time of idle users is idle time
+			if idle[p.user] {
+				idlePIDs[p.pid] = true
+				ph.idle.add(date, processName, dt)
+				ph.usersIdle.add(p.user, date, processName, dt)
+			} else {
+				ph.balance.add(date, processName, dt)
+				if matched[processName] {
+					ph.metrics.addProcessTime(processName, dt)
+				}
+				if p.user != "" {
+					ph.users.add(p.user, date, processName, dt)
+				}
+			}
+		}
 	}
 
+	// the groups with CPU accounting don't count the time their processes didn't use enough CPU time.
+	// It is kept apart from the idle time, so that count_idle doesn't count it either.
+	for _, g := range ph.limits {
+		for _, p := range processes {
+			if low[g.GroupID()][p.pid] && (g.CountIdle || !idle[p.user]) {
+				ph.cpuIdle.add(g.GroupID(), date, p.name, dt)
+			}
+		}
+	}
+
+	ph.compactBalance(date, retention)
+
 	// 2. check which processes are overtime and kill them
 	// ---------------
-	ph.limitsRWM.RLock()
-	defer ph.limitsRWM.RUnlock()
 	ph.pgroupsRWM.Lock()
 	defer ph.pgroupsRWM.Unlock()
 	ph.processesRWM.Lock()
 	defer ph.processesRWM.Unlock()
 
+	prev := make(map[string]string)
+	for _, pgb := range ph.pgroups {
+		prev[pgb.ID] = pgb.BlockedBy
+	}
 	ph.pgroups = make([]ProcessGroupDayBalance, len(ph.limits))
 	ph.processes = make(TimeBalance)
+	ph.userProcs = make(map[string]TimeBalance)
+
+	todayBalance := ph.dayBalance(date)
+	ph.pruneGrants(now)
+	ov := ph.overrides(now)
+	ph.pgroups = evaluateGroups(ph.limits, todayBalance, ov, now)
+	for _, pgb := range ph.pgroups {
+		if by, ok := prev[pgb.ID]; pgb.BlockedBy != "" && by != pgb.BlockedBy {
+			ph.emit(Event{Type: EventBlock, Group: pgb.ID, Message: "blocked by " + pgb.BlockedBy})
+		} else if ok && by != "" && pgb.BlockedBy == "" {
+			ph.emit(Event{Type: EventUnblock, Group: pgb.ID})
+		}
+	}
+	next := predictBlocking(ph.limits, ph.pgroups, todayBalance, processes, idlePIDs, low, ov, now)
+	ph.wakeAt(earliest(next, ph.warn(ph.limits, ph.pgroups, processes, now)))
 
-	todayBalance := ph.balance[date]
 	for groupIdx, groupLimit := range ph.limits { // iterate all processes day limits
-		groupBalance := time.Duration(0)
 		for _, processName := range groupLimit.PG { // iterate all processes in the process group
-			groupBalance = groupBalance + todayBalance[processName]
-			ph.processes[processName] = todayBalance[processName].Round(time.Second)
+			ph.processes[processName] = todayBalance.active[processName].Round(time.Second)
+			for user, tb := range todayBalance.users {
+				if _, ok := ph.userProcs[user]; !ok {
+					ph.userProcs[user] = make(TimeBalance)
+				}
+				ph.userProcs[user][processName] = tb[processName].Round(time.Second)
+			}
 		}
 
-		isOvertime, limit, defined := isOvertime(groupBalance, date, weekDay, groupLimit.DL)
-		now = time.Now()
-		isBlocked, activeDowntime := isBlocked(now, date, weekDay, groupLimit.DT)
-
-		ph.pgroups[groupIdx] = ProcessGroupDayBalance{
-			PG:           groupLimit.PG,
-			Limit:        prettyDuration{limit},
-			LimitDefined: defined,
-			Balance:      prettyDuration{groupBalance.Round(time.Second)},
-			Downtime:     activeDowntime,
-			Blocked:      isBlocked,
-			TimeStamp:    now.Format(dtTimeFormat),
-		}
+		pgb := ph.pgroups[groupIdx]
 
-		// if overtime or blocked - kill the processes
-		if isOvertime || isBlocked {
-			log.Println(groupLimit.PG, ":", groupBalance, "/", limit)
-			for _, processName := range groupLimit.PG { // iterate all processes in the process group
-				if todayBalance[processName] > 0 {
-					log.Println(processName, ":", todayBalance[processName])
-					// Use the PID map for efficient lookup instead of iterating all processes
-					if pids, exists := processPidMap[processName]; exists {
-						for _, pid := range pids {
-							// check if context is cancelled before attempting to kill
-							select {
-							case <-ctx.Done():
-								return ctx.Err()
-							default:
-								log.Println("killing", pid)
-								err := ph.killer(pid)
-								if err != nil {
-									log.Println("error killing", pid, ":", err.Error())
-								}
-							}
-						}
-					}
+		// if overtime or blocked (by the group or by a parent group) - kill the processes
+		if !groupLimit.isEnabled() {
+			log.Println(pgb.ID, "is disabled")
+		} else if groupLimit.isAllowlist() {
+			// kill the processes that are not in the allowlist
+			if err := ph.enforceAllowlist(ctx, groupLimit, pgb, processes, pt.protected, now); err != nil {
+				return err
+			}
+			if pgb.BlockedBy == "" && len(pgb.BlockedPG) > 0 {
+				if err := ph.killProcesses(ctx, groupLimit, pgb.BlockedPG, todayBalance, pt); err != nil {
+					return err
 				}
 			}
+		} else if pgb.BlockedBy != "" {
+			log.Println(pgb.ID, groupLimit.PG, ":", pgb.Balance, "/", pgb.Limit, "blocked by", pgb.BlockedBy)
+			if err := ph.killProcesses(ctx, groupLimit, groupLimit.PG, todayBalance, pt); err != nil {
+				return err
+			}
 		} else {
-			log.Println(groupLimit.PG, "remaining:", limit-groupBalance)
+			log.Println(pgb.ID, groupLimit.PG, "remaining:", pgb.Limit.Duration-pgb.Balance.Duration)
+			// processes that are overtime or blocked by their own limits or downtime
+			if len(pgb.BlockedPG) > 0 {
+				log.Println(pgb.ID, "processes blocked by their own limits or downtime:", pgb.BlockedPG)
+				if err := ph.killProcesses(ctx, groupLimit, pgb.BlockedPG, todayBalance, pt); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
-	// 3. Save time balance
+	// 3. check the session time of the users and end their sessions, if necessary
+	// ---------------
+	ph.sessionsBalance, ends = ph.checkSessions(sessions, dt, now)
+
+	// 4. Save time balance
 	// ---------------
 	ph.lastSavedRWM.RLock()
 	shouldSave := ph.lastSaved.Add(ph.savePeriod).Before(time.Now())
@@ -485,12 +793,105 @@ func (ph *ProcessHunter) checkProcesses(ctx context.Context, dt time.Duration) e
 		}
 	}
 
+	ph.metrics.checked(time.Since(start), len(processes))
+	ph.publish(UpdateCheck)
+
+	return nil
+}
+
+// killProcesses kills the processes of group g with names in processNames, that ran today (as per todayBalance),
+// using the process table pt to find them, and the other processes that g requires to kill with them (see processTable.victims).
+// It returns ctx.Err() if ctx is cancelled.
+// It refuses to kill the protected PIDs, and the protected executables unless g allows them.
+func (ph *ProcessHunter) killProcesses(ctx context.Context, g ProcessGroupDayLimit, processNames []string, todayBalance dayBalance, pt *processTable) error {
+	for _, processName := range processNames {
+		if b := todayBalance.of(processName, g.Users, true); b > 0 {
+			log.Println(processName, ":", b)
+			if err := ph.killNamed(ctx, g, processName, pt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// killNamed kills the running processes of group g named processName, using the process table pt to find them,
+// and the other processes that g requires to kill with them (see processTable.victims), regardless of their time balance.
+// It returns ctx.Err() if ctx is cancelled.
+// It refuses to kill the protected PIDs, and the protected executables unless g allows them.
+func (ph *ProcessHunter) killNamed(ctx context.Context, g ProcessGroupDayLimit, processName string, pt *processTable) error {
+	if !g.Unprotect && isProtectedName(processName, ph.config.Protected) {
+		log.Println("refusing to kill protected process", processName)
+		return nil
+	}
+
+	// Use the process table for efficient lookup instead of iterating all processes
+	for _, p := range pt.byName[processName] {
+		if !g.includes(p.user) || pt.killed[p.pid] {
+			continue
+		}
+		respawned := ph.checkRespawn(g.GroupID(), p, time.Now())
+		for _, v := range pt.victims(g, p, respawned) {
+			if pt.killed[v.pid] {
+				continue
+			}
+			if pt.protected[v.pid] || (!g.Unprotect && isProtectedName(v.name, ph.config.Protected)) {
+				log.Println("refusing to kill protected process", v.name, v.pid)
+				continue
+			}
+			if err := ph.kill(ctx, g.GroupID(), v); err != nil {
+				return err
+			}
+			pt.killed[v.pid] = true
+		}
+	}
+
+	return nil
+}
+
+// kill kills process p of the process group with ID group, and emits an event. It returns ctx.Err() if ctx is cancelled.
+func (ph *ProcessHunter) kill(ctx context.Context, group string, p processInfo) error {
+	// check if context is cancelled before attempting to kill
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	e := Event{Type: EventKill, Group: group, User: p.user, Process: p.name, PID: p.pid}
+	err := ph.killer(p.pid)
+	ph.metrics.killed(group, err != nil)
+	if err != nil {
+		e.Type, e.Message = EventKillFailed, err.Error()
+	} else {
+		ph.lastKills[respawnKey(group, p.name)] = time.Now()
+		ph.killed(group, p)
+		ph.publish(UpdateKill)
+	}
+	ph.emit(e)
+
 	return nil
 }
 
-// Run is a goroutine that periodically checks running processes
+// Run is a goroutine that periodically checks running processes,
+// and, while any process group is blocked, the processes of the blocked groups (see fastCheck)
 func (ph *ProcessHunter) Run(ctx context.Context, wg *sync.WaitGroup) {
-	scheduler(ctx, wg, ph.checkPeriod, ph.forceCheck, ph.checkProcesses)
+	defer func() {
+		if wg != nil {
+			wg.Done()
+		}
+	}()
+
+	var fwg sync.WaitGroup
+	fwg.Add(4)
+	go ph.runFast(ctx, &fwg)
+	go ph.runNotify(ctx, &fwg)
+	go ph.webhooks.run(ctx, &fwg)
+	go ph.runEmail(ctx, &fwg)
+
+	scheduler(ctx, nil, ph.checkPeriod, ph.forceCheck, ph.checkProcesses)
+	fwg.Wait()
 }
 
 // scheduler runs the work function periodically (every period seconds)
@@ -535,6 +936,28 @@ func (dtb *dayTimeBalance) add(day string, processName string, duration time.Dur
 	(*dtb)[day][processName] = (*dtb)[day][processName] + duration
 }
 
+// add adds duration to the balance of the process processName of user for the day
+func (utb userTimeBalance) add(user string, day string, processName string, duration time.Duration) {
+	dtb, ok := utb[user]
+	if !ok {
+		dtb = make(dayTimeBalance)
+		utb[user] = dtb
+	}
+
+	dtb.add(day, processName, duration)
+}
+
+// day returns the time balance of each user for the day
+func (utb userTimeBalance) day(day string) map[string]TimeBalance {
+	m := make(map[string]TimeBalance)
+	for user, dtb := range utb {
+		if tb, ok := dtb[day]; ok {
+			m[user] = tb
+		}
+	}
+	return m
+}
+
 // toText returns string representation of the date of t
 func toText(t time.Time) string {
 	return t.Format("2006-01-02")
@@ -5,7 +5,9 @@ import (
 	"context"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -56,7 +58,9 @@ func stopTestProcesses(t *testing.T, cmds [](*exec.Cmd)) (err error) {
 		if e != nil {
 			t.Error("Cannot stop test process", cmd)
 			err = e
+			continue
 		}
+		cmd.Wait() // reap the process, so that it isn't listed by the next tests
 	}
 	return
 }
@@ -282,6 +286,108 @@ func TestKillProcess(t *testing.T) {
 	}
 }
 
+func TestKillProcessOverOwnLimit(t *testing.T) {
+	cmds, err := startTestProcesses(t, testProcess1, testProcess2)
+	if err != nil {
+		t.Error("Cannot start test processes", err)
+	}
+	defer stopTestProcesses(t, cmds)
+
+	var killed []int
+	var killedMu sync.Mutex
+
+	f := func(pid int) error {
+		killedMu.Lock()
+		defer killedMu.Unlock()
+		killed = append(killed, pid)
+		return nil
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, f, "")
+	err = ph.SetConfig([]byte(`[{"processes": [
+		{"name": "test_process1", "limits": {"*": "1s"}},
+		{"name": "test_process1.exe", "limits": {"*": "1s"}},
+		"test_process2", "test_process2.exe"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*4)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	ph.Run(ctx, &wg)
+	wg.Wait()
+
+	killedMu.Lock()
+	defer killedMu.Unlock()
+	if !slices.Contains(killed, cmds[0].Process.Pid) {
+		t.Error("process over its own limit was not killed")
+	}
+	if slices.Contains(killed, cmds[1].Process.Pid) {
+		t.Error("killed a process within the limit of its group")
+	}
+}
+
+func TestParseConfigProtected(t *testing.T) {
+	invalid := []string{
+		`[{"processes": ["game", "systemd"], "limits": {"*": "1h"}}]`,
+		`[{"processes": ["Explorer.EXE"], "limits": {"*": "1h"}}]`,
+		`{"groups": [{"processes": ["tool"], "limits": {"*": "1h"}}], "protected": ["tool"]}`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted config with protected process", inv)
+		}
+	}
+
+	_, err := parseConfig([]byte(`[{"processes": ["sshd"], "limits": {"*": "1h"}, "allow_protected": true}]`))
+	if err != nil {
+		t.Error("rejected protected process with override", err)
+	}
+}
+
+func TestKillProcessesProtected(t *testing.T) {
+	var killed []int
+	f := func(pid int) error {
+		killed = append(killed, pid)
+		return nil
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, f, "")
+	ph.config.Protected = []string{"tool"}
+
+	tb := TimeBalance{"game": time.Hour, "systemd": time.Hour, "tool": time.Hour}
+	processes := []processInfo{
+		{pid: 1, name: "game"}, {pid: 100, name: "game"}, {pid: 101, name: "game"},
+		{pid: 200, name: "systemd"},
+		{pid: 300, name: "tool"},
+	}
+	pt := newProcessTable(processes, protectedPIDs(nil, []int{101}))
+
+	err := ph.killProcesses(context.Background(), ProcessGroupDayLimit{}, []string{"game", "systemd", "tool"}, dayBalance{active: tb}, pt)
+	if err != nil {
+		t.Error("killProcesses failed", err)
+	}
+	if !reflect.DeepEqual(killed, []int{100}) {
+		t.Error("expected to kill only unprotected PID 100, killed", killed)
+	}
+
+	killed = nil
+	err = ph.killProcesses(context.Background(), ProcessGroupDayLimit{Unprotect: true}, []string{"systemd"}, dayBalance{active: tb}, pt)
+	if err != nil {
+		t.Error("killProcesses failed", err)
+	}
+	if !reflect.DeepEqual(killed, []int{200}) {
+		t.Error("protected executable not killed with override, killed", killed)
+	}
+
+	if !protectedPIDs(nil, nil)[os.Getpid()] {
+		t.Error("own PID is not protected")
+	}
+}
+
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	if os.IsNotExist(err) {
@@ -415,6 +521,7 @@ func TestSetConfig(t *testing.T) {
 	const cfg = `
 [
     {
+        "id": "p1",
         "processes": [
             "p1",
             "p2"
@@ -424,6 +531,7 @@ func TestSetConfig(t *testing.T) {
         }
     },
     {
+        "id": "p3",
         "processes": [
             "p3"
         ],
@@ -486,10 +594,10 @@ func TestSetConfig(t *testing.T) {
 func TestLoadConfig(t *testing.T) {
 	ph := NewProcessHunter(time.Second, "", time.Hour, nil, configPath)
 	ph.limits = []ProcessGroupDayLimit{
-		{[]string{"1"}, DayLimits{"*": time.Minute}, Downtime{"mon": {"..08:00"}}},
-		{[]string{"2"}, DayLimits{"*": time.Minute}, Downtime{"tue wed": {"12:00..14:00"}}},
-		{[]string{"3"}, DayLimits{"*": time.Minute}, Downtime{"*": {"22:00..", "..12:00"}, "tue": {"06:00..12:00"}}},
-		{[]string{"4"}, DayLimits{"*": time.Minute}, Downtime{}},
+		{PG: []string{"1"}, DL: DayLimits{"*": time.Minute}, DT: Downtime{"mon": {"..08:00"}}},
+		{PG: []string{"2"}, DL: DayLimits{"*": time.Minute}, DT: Downtime{"tue wed": {"12:00..14:00"}}},
+		{PG: []string{"3"}, DL: DayLimits{"*": time.Minute}, DT: Downtime{"*": {"22:00..", "..12:00"}, "tue": {"06:00..12:00"}}},
+		{PG: []string{"4"}, DL: DayLimits{"*": time.Minute}, DT: Downtime{}},
 	}
 
 	err := ph.LoadConfig()
@@ -617,6 +725,79 @@ func TestSchedulerPeriod(t *testing.T) {
 	wg.Wait()
 }
 
+func TestGroupID(t *testing.T) {
+	ids := map[string]ProcessGroupDayLimit{
+		"games":                             {ID: "games", Name: "Video games", PG: []string{"p1"}},
+		"video-games":                       {Name: "Video Games!", PG: []string{"p1"}},
+		"fortniteclient-win64-shipping.exe": {PG: []string{"FortniteClient-Win64-Shipping.exe", "RustClient.exe"}},
+	}
+
+	for id, g := range ids {
+		if g.GroupID() != id {
+			t.Error("wrong group id: got", g.GroupID(), "want", id)
+		}
+	}
+
+	// names without letters or digits allowed in IDs derive a hash
+	g := ProcessGroupDayLimit{Name: "Игри", PG: []string{"p1"}}
+	if id := g.GroupID(); !reGroupID.MatchString(id) || id == (ProcessGroupDayLimit{Name: "Видео"}).GroupID() {
+		t.Error("unexpected id of a non-Latin name", id)
+	}
+}
+
+func TestAssignIDs(t *testing.T) {
+	cfg, assigned, err := decodeConfig([]byte(`{"groups": [
+		{"processes": ["p1"], "limits": {"*": "1h"}},
+		{"processes": ["p1", "p2"], "limits": {"*": "1h"}},
+		{"id": "kept", "processes": ["p3"], "limits": {"*": "1h"}}],
+		"profiles": [{"user": "alice", "groups": [{"name": "Игри", "processes": ["p4"], "limits": {"*": "1h"}}]}]}`))
+	if err != nil {
+		t.Fatal("rejected groups that share the first process", err)
+	}
+	if !assigned || cfg.Groups[0].ID != "p1" || cfg.Groups[1].ID != "p1-2" || cfg.Groups[2].ID != "kept" || cfg.Profiles[0].Groups[0].ID == "" {
+		t.Error("unexpected ids", assigned, cfg.Groups, cfg.Profiles)
+	}
+
+	// the ids are saved, so that they don't change with the group
+	path := filepath.Join(t.TempDir(), "cfg.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "Games", "processes": ["p1"], "limits": {"*": "1h"}}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, path)
+	if err := ph.LoadConfig(); err != nil {
+		t.Fatal("LoadConfig failed", err)
+	}
+	if b, err := os.ReadFile(path); err != nil || !bytes.Contains(b, []byte(`"id": "games"`)) {
+		t.Error("the ids were not saved", string(b), err)
+	}
+	if _, assigned, err := decodeConfig([]byte(`[{"id": "games", "processes": ["p1"], "limits": {"*": "1h"}}]`)); err != nil || assigned {
+		t.Error("assigned ids to groups that have them", assigned, err)
+	}
+}
+
+func TestParseConfigGroupMetadata(t *testing.T) {
+	cfg, err := parseConfig([]byte(`[{"id": "games", "name": "Games", "description": "all games", "enabled": false, "color": "#ff0000", "processes": ["p1"], "limits": {"*": "1h"}}]`))
+	if err != nil {
+		t.Fatal("Could not parse config:", err)
+	}
+
+	g := cfg.Groups[0]
+	if g.ID != "games" || g.Name != "Games" || g.Description != "all games" || g.isEnabled() || g.Color != "#ff0000" {
+		t.Error("group metadata not parsed correctly:", g)
+	}
+
+	invalid := []string{
+		`[{"id": "g", "processes": ["p1"], "limits": {"*": "1h"}}, {"id": "g", "processes": ["p2"], "limits": {"*": "1h"}}]`,
+		`[{"id": "bad id", "processes": ["p1"], "limits": {"*": "1h"}}]`,
+		`[{"color": "rgb(1,2,3)", "processes": ["p1"], "limits": {"*": "1h"}}]`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
+
 func TestMarshalDayLimit(t *testing.T) {
 	d := make(DayLimits)
 
@@ -640,3 +821,114 @@ func TestMarshalDayLimit(t *testing.T) {
 		t.Error("unmarshaled DayLimits is not correct:", d)
 	}
 }
+
+func TestParseConfigProfiles(t *testing.T) {
+	cfg, err := parseConfig([]byte(`{
+		"groups": [{"id": "screen", "limits": {"*": "3h"}, "processes": ["browser"]}],
+		"profiles": [
+			{"user": "alice", "groups": [
+				{"id": "games", "parent": "screen", "processes": ["game"], "limits": {"*": "1h"}},
+				{"id": "video", "parent": "entertainment", "processes": ["player"]},
+				{"id": "entertainment", "processes": ["music"], "limits": {"*": "2h"}}
+			]},
+			{"user": "bob", "groups": [{"id": "games", "processes": ["game"], "limits": {"*": "2h"}}]}
+		]}`))
+	if err != nil {
+		t.Fatal("Could not parse config with profiles:", err)
+	}
+
+	groups := cfg.groups()
+	expected := []struct{ id, parent, user string }{
+		{"screen", "", ""},
+		{"alice.games", "screen", "alice"},
+		{"alice.video", "alice.entertainment", "alice"},
+		{"alice.entertainment", "", "alice"},
+		{"bob.games", "", "bob"},
+	}
+	if len(groups) != len(expected) {
+		t.Fatal("expected", len(expected), "groups, got", len(groups))
+	}
+	for i, e := range expected {
+		g := groups[i]
+		if g.GroupID() != e.id || g.Parent != e.parent || (e.user != "" && !reflect.DeepEqual(g.Users, []string{e.user})) {
+			t.Error("expected group", e, "got", g.GroupID(), g.Parent, g.Users)
+		}
+	}
+	if cfg.Profiles[0].Groups[0].ID != "games" {
+		t.Error("profile groups were modified")
+	}
+
+	invalid := []string{
+		`{"groups": [], "profiles": [{"groups": [{"processes": ["game"], "limits": {"*": "1h"}}]}]}`,
+		`{"groups": [], "profiles": [{"user": "alice", "groups": []}, {"user": "alice", "groups": []}]}`,
+		`{"groups": [], "profiles": [{"user": "alice", "groups": [{"users": ["bob"], "processes": ["game"], "limits": {"*": "1h"}}]}]}`,
+		`{"groups": [{"id": "alice.games", "processes": ["game"], "limits": {"*": "1h"}}], "profiles": [{"user": "alice", "groups": [{"id": "games", "processes": ["game"], "limits": {"*": "1h"}}]}]}`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
+
+func TestKillProcessesUsers(t *testing.T) {
+	var killed []int
+	f := func(pid int) error {
+		killed = append(killed, pid)
+		return nil
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, f, "")
+
+	g := ProcessGroupDayLimit{ID: "alice.games", PG: []string{"game"}, Users: []string{"alice"}}
+	pt := newProcessTable([]processInfo{{pid: 100, name: "game", user: "alice"}, {pid: 200, name: "game", user: "bob"}}, nil)
+	tb := TimeBalance{"game": time.Hour}
+
+	err := ph.killProcesses(context.Background(), g, g.PG, dayBalance{active: tb, users: map[string]TimeBalance{"bob": tb}}, pt)
+	if err != nil {
+		t.Error("killProcesses failed", err)
+	}
+	if len(killed) != 0 {
+		t.Error("killed processes of a user without balance", killed)
+	}
+
+	err = ph.killProcesses(context.Background(), g, g.PG, dayBalance{active: tb, users: map[string]TimeBalance{"alice": tb, "bob": tb}}, pt)
+	if err != nil {
+		t.Error("killProcesses failed", err)
+	}
+	if !reflect.DeepEqual(killed, []int{100}) {
+		t.Error("expected to kill only the process of alice, killed", killed)
+	}
+
+	ev := ph.GetEvents()
+	if len(ev) != 1 || ev[0].Type != EventKill || ev[0].Group != "alice.games" || ev[0].User != "alice" || ev[0].PID != 100 {
+		t.Error("expected a kill event, got", ev)
+	}
+}
+
+func TestBlockEvents(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`[{"id": "games", "processes": ["non.existing.game"], "downtime": {"*": ["00:00..23:59"]}}]`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	blocks := func() int {
+		n := 0
+		for _, e := range ph.GetEvents() {
+			if e.Type == EventBlock && e.Group == "games" {
+				n++
+			}
+		}
+		return n
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ph.checkProcesses(context.Background(), time.Second); err != nil {
+			t.Error("checkProcesses failed", err)
+		}
+	}
+	if n := blocks(); n != 1 {
+		t.Error("expected a single block event, got", n)
+	}
+}
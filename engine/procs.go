@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/mitchellh/go-ps"
+)
+
+// processInfo describes a running process
+type processInfo struct {
+	pid  int    // process ID
+	ppid int    // parent process ID
+	name string // executable name
+	user string // name of the user that owns the process, "" if unknown
+
+	cpu      time.Duration // CPU time (user and system) used by the process so far
+	cpuKnown bool          // whether cpu is known
+	start    time.Time     // when the process started, zero if unknown
+}
+
+// listProcesses returns the running processes
+func listProcesses() ([]processInfo, error) {
+	pss, err := ps.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	processes := make([]processInfo, 0, len(pss))
+	for _, p := range pss {
+		cpu, start, cpuKnown := processTimes(p.Pid())
+		processes = append(processes, processInfo{
+			pid:      p.Pid(),
+			ppid:     p.PPid(),
+			name:     p.Executable(),
+			user:     processOwner(p.Pid()),
+			cpu:      cpu,
+			cpuKnown: cpuKnown,
+			start:    start,
+		})
+	}
+
+	return processes, nil
+}
@@ -0,0 +1,49 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseStat(t *testing.T) {
+	stat := "1234 (my game (x86)) S 1 1234 1234 0 -1 4194560 1000 0 0 0 250 150 0 0 20 0 1 0 100 0 0"
+
+	si, ok := parseStat(stat)
+	if !ok || si.name != "my game (x86)" || si.ppid != 1 || si.cpu != time.Second*4 || si.start != time.Second {
+		t.Error("parseStat returned", si, ok)
+	}
+
+	if _, ok := parseStat("1234 (game"); ok {
+		t.Error("parsed bad stat")
+	}
+
+	_, st, ok := processTimes(os.Getpid())
+	if !ok {
+		t.Error("CPU time of the own process unknown")
+	}
+	if d := time.Since(st); d < 0 || d > time.Hour {
+		t.Error("unexpected start time of the own process", st)
+	}
+}
+
+func TestProtectedTruncatedNames(t *testing.T) {
+	for _, name := range []string{"gnome-session-b", "systemd-journal", "gdm-session-wor", "GNOME-SESSION-BINARY"} {
+		if !isProtectedName(name, nil) {
+			t.Error("truncated name", name, "is not protected")
+		}
+	}
+	if !isProtectedName("my-long-tool-na", []string{"my-long-tool-name"}) {
+		t.Error("truncated name of an extra protected process is not protected")
+	}
+	if !isProtectedName("gnome-session", nil) || isProtectedName("gnome-sess", nil) {
+		t.Error("unexpected protection of short names")
+	}
+
+	if _, err := parseConfig([]byte(`[{"processes": ["systemd-journal"], "limits": {"*": "1h"}}]`)); err == nil {
+		t.Error("accepted config with a truncated protected process")
+	}
+}
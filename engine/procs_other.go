@@ -0,0 +1,24 @@
+//go:build !linux && !windows
+// +build !linux,!windows
+
+package engine
+
+import "time"
+
+// maxNameLength is 0, since the executable names of the processes are not truncated on this OS
+const maxNameLength = 0
+
+// processOwner returns "", since the process owner is not supported on this OS
+func processOwner(pid int) string {
+	return ""
+}
+
+// processTimes returns false, since the CPU and start time of processes are not supported on this OS
+func processTimes(pid int) (time.Duration, time.Time, bool) {
+	return 0, time.Time{}, false
+}
+
+// scanProcesses returns the running processes (see listProcesses)
+func scanProcesses(names map[string]bool) ([]processInfo, error) {
+	return listProcesses()
+}
@@ -0,0 +1,67 @@
+//go:build windows
+// +build windows
+
+package engine
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// maxNameLength is 0, since the executable names of the processes are not truncated on Windows
+const maxNameLength = 0
+
+// processOwner returns the name of the user that owns process pid (from the process token),
+// or "" if it cannot be determined
+func processOwner(pid int) string {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return ""
+	}
+	defer windows.CloseHandle(h)
+
+	var t windows.Token
+	err = windows.OpenProcessToken(h, windows.TOKEN_QUERY, &t)
+	if err != nil {
+		return ""
+	}
+	defer t.Close()
+
+	tu, err := t.GetTokenUser()
+	if err != nil {
+		return ""
+	}
+
+	account, _, _, err := tu.User.Sid.LookupAccount("")
+	if err != nil {
+		return ""
+	}
+
+	return account
+}
+
+// processTimes returns the CPU time (kernel and user) used by process pid, the start time of the process,
+// and whether they could be determined
+func processTimes(pid int) (time.Duration, time.Time, bool) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	defer windows.CloseHandle(h)
+
+	var creation, exit, kernel, user windows.Filetime
+	err = windows.GetProcessTimes(h, &creation, &exit, &kernel, &user)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+
+	// kernel and user times are in 100-nanosecond units
+	ticks := int64(kernel.HighDateTime)<<32 + int64(kernel.LowDateTime) + int64(user.HighDateTime)<<32 + int64(user.LowDateTime)
+	return time.Duration(ticks * 100), time.Unix(0, creation.Nanoseconds()), true
+}
+
+// scanProcesses returns the running processes (see listProcesses)
+func scanProcesses(names map[string]bool) ([]processInfo, error) {
+	return listProcesses()
+}
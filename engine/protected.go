@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// protectedProcesses lists the executables that are never killed, unless a process group explicitly allows it.
+// These are init and session managers, system services and ph itself, on all supported OSs.
+// The list is extended by Settings.Protected.
+var protectedProcesses = []string{
+	// ph
+	"ph", "ph.exe", "phsvc", "phsvc.exe",
+	// Linux
+	"init", "systemd", "systemd-logind", "systemd-journald", "systemd-udevd", "kthreadd",
+	"dbus-daemon", "dbus-broker", "polkitd", "NetworkManager", "sshd", "login", "agetty", "getty",
+	"gdm", "gdm3", "gdm-session-worker", "lightdm", "sddm", "xdm", "Xorg", "Xwayland",
+	"gnome-session", "gnome-session-binary", "gnome-shell", "plasmashell", "ksmserver", "kwin_x11", "kwin_wayland",
+	"xfce4-session",
+	// macOS
+	"kernel_task", "launchd", "loginwindow", "WindowServer", "Dock", "Finder", "SystemUIServer",
+	// Windows
+	"System", "Registry", "smss.exe", "csrss.exe", "wininit.exe", "winlogon.exe", "services.exe", "lsass.exe",
+	"svchost.exe", "explorer.exe", "dwm.exe", "LogonUI.exe", "userinit.exe", "sihost.exe", "fontdrvhost.exe",
+}
+
+// selfName is the executable name of the running ph
+var selfName = func() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(exe)
+}()
+
+// truncateName returns name as the OS reports it for a running process: cut to maxNameLength, if the OS truncates names
+func truncateName(name string) string {
+	if maxNameLength > 0 && len(name) > maxNameLength {
+		return name[:maxNameLength]
+	}
+	return name
+}
+
+// isProtectedName returns whether process name is protected by the built-in list, by extra or is ph itself.
+// Names are compared case-insensitively, and as truncated by the OS (e.g. "gnome-session-b" is "gnome-session-binary" on Linux).
+func isProtectedName(name string, extra []string) bool {
+	name = truncateName(name)
+	eq := func(p string) bool { return strings.EqualFold(truncateName(p), name) }
+	return eq(selfName) || slices.ContainsFunc(protectedProcesses, eq) || slices.ContainsFunc(extra, eq)
+}
+
+// protectedPIDs returns the PIDs that are never killed: PID 1, extra, ph's own PID and the PIDs of its parents,
+// using processes to find the parents
+func protectedPIDs(processes []processInfo, extra []int) map[int]bool {
+	protected := map[int]bool{0: true, 1: true}
+	for _, pid := range extra {
+		protected[pid] = true
+	}
+
+	ppids := make(map[int]int, len(processes))
+	for _, p := range processes {
+		ppids[p.pid] = p.ppid
+	}
+
+	for pid := os.Getpid(); pid > 0 && !protected[pid]; pid = ppids[pid] {
+		protected[pid] = true
+	}
+
+	return protected
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Statuses of the requests for more time
+const (
+	RequestPending  = "pending"  // the request waits for a decision
+	RequestApproved = "approved" // the request was approved, and the time was granted
+	RequestDenied   = "denied"   // the request was denied
+	RequestExpired  = "expired"  // the request was not decided in time
+)
+
+const (
+	defaultRequestExpiry  = time.Hour           // how long a request waits for a decision, unless configured otherwise
+	defaultRequestsPerDay = 3                   // how many requests a user can make per day, unless configured otherwise
+	maxRequestDuration    = 24 * time.Hour      // the most time that can be requested at once
+	requestsHistory       = 30 * 24 * time.Hour // how long the decided requests are kept
+)
+
+// ErrRequestLimit is returned when a user has made as many requests for more time today as allowed
+var ErrRequestLimit = errors.New("too many requests today")
+
+// TimeRequest is a request of a user for more time for a process group, decided by a parent
+type TimeRequest struct {
+	ID        string         `json:"id"`                   // ID identifies the request
+	Group     string         `json:"group"`                // Group is the ID of the process group
+	User      string         `json:"user"`                 // User is the user who made the request
+	Duration  prettyDuration `json:"duration"`             // Duration is the requested time
+	Reason    string         `json:"reason,omitempty"`     // Reason is why the user needs more time
+	Status    string         `json:"status"`               // Status is the status of the request, e.g. RequestPending
+	Created   time.Time      `json:"created"`              // Created is when the request was made
+	Expires   time.Time      `json:"expires"`              // Expires is when the request expires, if not decided
+	Decided   *time.Time     `json:"decided,omitempty"`    // Decided is when the request was approved or denied
+	DecidedBy string         `json:"decided_by,omitempty"` // DecidedBy is who approved or denied the request
+	Note      string         `json:"note,omitempty"`       // Note is the comment of the decision
+}
+
+// requestExpiry returns how long a request waits for a decision (see Settings.RequestExpiry)
+func requestExpiry(cfg Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.RequestExpiry); err == nil && d > 0 {
+		return d
+	}
+	return defaultRequestExpiry
+}
+
+// requestsPerDay returns how many requests a user can make per day (see Settings.RequestsPerDay)
+func requestsPerDay(cfg Config) int {
+	if cfg.RequestsPerDay > 0 {
+		return cfg.RequestsPerDay
+	}
+	return defaultRequestsPerDay
+}
+
+// expireRequests marks the pending requests that expired at now, and removes the old decided requests.
+// ph.balanceRWM must be locked by the caller.
+func (ph *ProcessHunter) expireRequests(now time.Time) {
+	for i, r := range ph.requests {
+		if r.Status == RequestPending && !now.Before(r.Expires) {
+			ph.requests[i].Status = RequestExpired
+		}
+	}
+	ph.requests = slices.DeleteFunc(ph.requests, func(r TimeRequest) bool {
+		return r.Status != RequestPending && now.Sub(r.Created) > requestsHistory
+	})
+}
+
+// RequestTime makes a request of user for d more time for the process group with ID group, to be decided by a parent.
+// The request is saved, and emitted as an EventRequest.
+func (ph *ProcessHunter) RequestTime(user, group string, d time.Duration, reason string) (TimeRequest, error) {
+	if user == "" {
+		return TimeRequest{}, errors.New("user cannot be empty")
+	}
+	if d <= 0 || d > maxRequestDuration {
+		return TimeRequest{}, fmt.Errorf("requested time must be positive, and at most %v", maxRequestDuration)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return TimeRequest{}, err
+	}
+
+	ph.balanceRWM.Lock()
+	defer ph.balanceRWM.Unlock()
+	ph.limitsRWM.RLock()
+	defer ph.limitsRWM.RUnlock()
+
+	i := slices.IndexFunc(ph.limits, func(g ProcessGroupDayLimit) bool { return g.GroupID() == group })
+	if i < 0 || !ph.limits[i].includes(user) {
+		return TimeRequest{}, fmt.Errorf("process group %s not found", group)
+	}
+
+	now := time.Now()
+	ph.expireRequests(now)
+
+	today := 0
+	for _, r := range ph.requests {
+		if r.User == user && toText(r.Created) == toText(now) {
+			today++
+		}
+	}
+	if today >= requestsPerDay(ph.config) {
+		return TimeRequest{}, ErrRequestLimit
+	}
+
+	r := TimeRequest{ID: hex.EncodeToString(id), Group: group, User: user, Duration: prettyDuration{d}, Reason: reason,
+		Status: RequestPending, Created: now, Expires: now.Add(requestExpiry(ph.config))}
+	ph.requests = append(ph.requests, r)
+
+	if ph.balancePath != "" {
+		if err := ph.saveBalance(); err != nil {
+			log.Println("error saving balance to", ph.balancePath, ":", err)
+		}
+	}
+	ph.emit(Event{Type: EventRequest, Group: group, User: user, Message: fmt.Sprint(user, " requests ", d, " more for ", group, ": ", reason)})
+	ph.publish(UpdateRequest)
+
+	return r, nil
+}
+
+// DecideRequest approves or denies the pending request with id, on behalf of by, with note.
+// An approved request grants the requested time to the process group (see AddGrant), i.e. to all its users,
+// not only to the user who made the request. The request stays pending if the time cannot be granted,
+// e.g. when the group was removed. The user who made the request is notified.
+func (ph *ProcessHunter) DecideRequest(id string, approve bool, by, note string) (TimeRequest, error) {
+	ph.balanceRWM.Lock()
+
+	now := time.Now()
+	ph.expireRequests(now)
+
+	i := slices.IndexFunc(ph.requests, func(r TimeRequest) bool { return r.ID == id })
+	if i < 0 {
+		ph.balanceRWM.Unlock()
+		return TimeRequest{}, fmt.Errorf("request %s not found", id)
+	}
+	r := &ph.requests[i]
+	if r.Status != RequestPending {
+		ph.balanceRWM.Unlock()
+		return TimeRequest{}, fmt.Errorf("request %s is %s", id, r.Status)
+	}
+
+	if approve {
+		if _, err := ph.addGrant(r.Group, r.Duration.Duration, fmt.Sprint("request of ", r.User, ": ", r.Reason), now); err != nil {
+			ph.balanceRWM.Unlock()
+			return TimeRequest{}, err
+		}
+	}
+
+	r.Status, r.Decided, r.DecidedBy, r.Note = RequestDenied, &now, by, note
+	if approve {
+		r.Status = RequestApproved
+	}
+	decided := *r
+
+	if ph.balancePath != "" {
+		if err := ph.saveBalance(); err != nil {
+			log.Println("error saving balance to", ph.balancePath, ":", err)
+		}
+	}
+	ph.balanceRWM.Unlock()
+
+	msg := fmt.Sprint("request for ", decided.Duration, " more for ", decided.Group, " was ", decided.Status)
+	if note != "" {
+		msg += ": " + note
+	}
+	if approve {
+		ph.force()
+		ph.publish(UpdateGrant)
+		ph.emit(Event{Type: EventRequestApproved, Group: decided.Group, User: decided.User, Message: msg})
+	} else {
+		ph.emit(Event{Type: EventRequestDenied, Group: decided.Group, User: decided.User, Message: msg})
+	}
+
+	ph.limitsRWM.RLock()
+	ph.notify(Notification{Type: NotifyRequest, Group: decided.Group, User: decided.User, Message: msg})
+	ph.limitsRWM.RUnlock()
+	ph.publish(UpdateRequest)
+
+	return decided, nil
+}
+
+// GetRequests returns the requests for more time, the latest first.
+// If user is not empty, only the requests of the user are returned.
+func (ph *ProcessHunter) GetRequests(user string) []TimeRequest {
+	ph.balanceRWM.RLock()
+	defer ph.balanceRWM.RUnlock()
+
+	now := time.Now()
+	requests := []TimeRequest{}
+	for _, r := range ph.requests {
+		if user != "" && r.User != user {
+			continue
+		}
+		if r.Status == RequestPending && !now.Before(r.Expires) {
+			r.Status = RequestExpired
+		}
+		requests = append(requests, r)
+	}
+	slices.Reverse(requests)
+
+	return requests
+}
@@ -0,0 +1,131 @@
+package engine
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequestTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balance.json")
+	ph := NewProcessHunter(time.Hour, path, time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`{"groups": [
+		{"id": "games", "processes": ["game"], "limits": {"*": "1h"}, "users": ["alice"]},
+		{"id": "video", "processes": ["player"], "limits": {"*": "1h"}}],
+		"requests_per_day": 2}`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	f := &fakeNotifier{}
+	ph.SetNotifier(f)
+
+	if _, err := ph.RequestTime("alice", "movies", time.Hour, ""); err == nil {
+		t.Error("accepted a request for a group that doesn't exist")
+	}
+	if _, err := ph.RequestTime("bob", "games", time.Hour, ""); err == nil {
+		t.Error("accepted a request for a group of another user")
+	}
+	if _, err := ph.RequestTime("alice", "games", 0, ""); err == nil {
+		t.Error("accepted a request without duration")
+	}
+
+	r1, err := ph.RequestTime("alice", "games", time.Minute*30, "one more level")
+	if err != nil {
+		t.Fatal("RequestTime failed", err)
+	}
+	r2, err := ph.RequestTime("alice", "video", time.Minute*15, "")
+	if err != nil {
+		t.Fatal("RequestTime failed", err)
+	}
+	if _, err := ph.RequestTime("alice", "video", time.Minute*15, ""); !errors.Is(err, ErrRequestLimit) {
+		t.Error("expected the daily limit of requests, got", err)
+	}
+	if ev := ph.GetEvents(); len(ev) != 3 || ev[1].Type != EventRequest || ev[1].User != "alice" {
+		t.Error("expected request events, got", ev)
+	}
+
+	if _, err := ph.DecideRequest(r1.ID, true, "parent", "ok"); err != nil {
+		t.Fatal("DecideRequest failed", err)
+	}
+	if _, err := ph.DecideRequest(r1.ID, false, "parent", ""); err == nil {
+		t.Error("decided a request twice")
+	}
+	if _, err := ph.DecideRequest(r2.ID, false, "parent", "not today"); err != nil {
+		t.Fatal("DecideRequest failed", err)
+	}
+	if grants := ph.GetGrants(); len(grants) != 1 || grants[0].Group != "games" {
+		t.Error("unexpected grants after the approval", grants)
+	}
+	ph.sendNotifications()
+	if len(f.notifications) != 2 || f.notifications[0].Type != NotifyRequest || f.notifications[1].User != "alice" {
+		t.Error("unexpected notifications", f.notifications)
+	}
+
+	// the history survives a restart
+	ph = NewProcessHunter(time.Hour, path, time.Hour, nil, "")
+	if err := ph.LoadBalance(); err != nil {
+		t.Fatal("LoadBalance failed", err)
+	}
+	requests := ph.GetRequests("alice")
+	if len(requests) != 2 || requests[0].ID != r2.ID || requests[0].Status != RequestDenied || requests[1].Status != RequestApproved ||
+		requests[1].Duration.Duration != time.Minute*30 || requests[1].DecidedBy != "parent" {
+		t.Error("unexpected requests after loading the balance", requests)
+	}
+	if requests := ph.GetRequests("bob"); len(requests) != 0 {
+		t.Error("unexpected requests of another user", requests)
+	}
+}
+
+func TestExpireRequests(t *testing.T) {
+	now := time.Now()
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	ph.requests = []TimeRequest{
+		{ID: "old", Status: RequestApproved, Created: now.Add(-requestsHistory - time.Hour)},
+		{ID: "expired", Status: RequestPending, Created: now.Add(-time.Hour * 2), Expires: now.Add(-time.Hour)},
+		{ID: "pending", Status: RequestPending, Created: now, Expires: now.Add(time.Hour)},
+	}
+
+	if requests := ph.GetRequests(""); len(requests) != 3 || requests[1].Status != RequestExpired {
+		t.Error("expired request not reported as expired", requests)
+	}
+	if _, err := ph.DecideRequest("expired", true, "parent", ""); err == nil {
+		t.Error("approved an expired request")
+	}
+	if len(ph.requests) != 2 || ph.requests[0].ID != "expired" || ph.requests[0].Status != RequestExpired {
+		t.Error("unexpected requests after expiry", ph.requests)
+	}
+}
+
+func TestDecideRequestOfRemovedGroup(t *testing.T) {
+	now := time.Now()
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	if err := ph.SetConfig([]byte(`{"groups": [{"id": "video", "processes": ["player"], "limits": {"*": "1h"}}]}`)); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	ph.requests = []TimeRequest{{ID: "r", Group: "games", User: "alice", Duration: prettyDuration{time.Hour},
+		Status: RequestPending, Created: now, Expires: now.Add(time.Hour)}}
+
+	if _, err := ph.DecideRequest("r", true, "parent", ""); err == nil {
+		t.Error("approved a request for a group that doesn't exist")
+	}
+	if ph.requests[0].Status != RequestPending || ph.requests[0].Decided != nil {
+		t.Error("request decided without granting the time", ph.requests[0])
+	}
+	if grants := ph.GetGrants(); len(grants) != 0 {
+		t.Error("unexpected grants", grants)
+	}
+}
+
+func TestParseConfigRequests(t *testing.T) {
+	invalid := []string{
+		`{"groups": [], "request_expiry": "soon"}`,
+		`{"groups": [], "request_expiry": "-1h"}`,
+		`{"groups": [], "requests_per_day": -1}`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// migrateGroupsHistory moves the daily totals stored by the older key (the list of process names of the group)
+// to the group's ID
+func (ph *ProcessHunter) migrateGroupsHistory() {
+	for _, g := range ph.limits {
+		old, key := strings.Join(g.PG, ","), g.GroupID()
+		if old == key {
+			continue
+		}
+		for _, tb := range ph.groupsHist {
+			if d, ok := tb[old]; ok {
+				tb[key] = tb[key] + d
+				delete(tb, old)
+			}
+		}
+	}
+}
+
+// groupedProcesses returns the set of process names that belong to at least one of the groups
+func groupedProcesses(groups []ProcessGroupDayLimit) map[string]bool {
+	m := make(map[string]bool)
+	for _, g := range groups {
+		for _, p := range g.PG {
+			m[p] = true
+		}
+	}
+	return m
+}
+
+// pruneUnmatched removes from tb the processes that are not in matched,
+// except for the top processes with the highest time balance
+func (tb TimeBalance) pruneUnmatched(matched map[string]bool, top int) {
+	var unmatched []string
+	for p := range tb {
+		if !matched[p] {
+			unmatched = append(unmatched, p)
+		}
+	}
+
+	if len(unmatched) <= top {
+		return
+	}
+
+	// highest balance first; names break ties to keep the result stable
+	slices.SortFunc(unmatched, func(a, b string) int {
+		if tb[a] != tb[b] {
+			if tb[a] > tb[b] {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	for _, p := range unmatched[top:] {
+		delete(tb, p)
+	}
+}
+
+// compaction is the day and the retention settings of a compaction of the balance history (see compactBalance)
+type compaction struct {
+	day string
+	r   Retention
+}
+
+// days returns the days of the balance histories of ph: the per-process, per-user, idle and CPU time history
+func (ph *ProcessHunter) days() []string {
+	set := make(map[string]bool)
+	for _, dtb := range []dayTimeBalance{ph.balance, ph.idle, ph.cpu} {
+		for day := range dtb {
+			set[day] = true
+		}
+	}
+	for _, utb := range []userTimeBalance{ph.users, ph.usersIdle, ph.cpuIdle} {
+		for _, dtb := range utb {
+			for day := range dtb {
+				set[day] = true
+			}
+		}
+	}
+	return sortedKeys(set)
+}
+
+// compactBalance applies the retention settings r to the balance histories of all days before today (see days):
+// it drops the unmatched processes (keeping the top r.TopUnmatched ones) when r.OnlyGroups is set,
+// and rolls the days older than r.DetailDays up into per-group daily totals in ph.groupsHist, by group ID.
+// The session time history is kept. The roll-up uses the current process groups. Days that are not valid dates are left untouched.
+// The past days don't change during the day, so the history is compacted once a day, and again when r changes.
+func (ph *ProcessHunter) compactBalance(today string, r Retention) {
+	c := compaction{day: today, r: r}
+	if ph.compacted == c {
+		return
+	}
+	ph.compacted = c
+
+	ph.migrateGroupsHistory()
+
+	if !r.OnlyGroups && r.DetailDays <= 0 {
+		return
+	}
+
+	t, err := time.ParseInLocation(time.DateOnly, today, time.Local)
+	if err != nil {
+		return
+	}
+	oldest := t.AddDate(0, 0, -r.DetailDays)
+
+	matched := groupedProcesses(ph.limits)
+
+	for _, day := range ph.days() {
+		if day == today {
+			continue
+		}
+
+		db := ph.dayBalance(day)
+
+		if r.OnlyGroups {
+			db.active.pruneUnmatched(matched, r.TopUnmatched)
+			db.idle.pruneUnmatched(matched, r.TopUnmatched)
+			ph.cpu[day].pruneUnmatched(matched, r.TopUnmatched)
+			for _, utb := range db.users {
+				utb.pruneUnmatched(matched, r.TopUnmatched)
+			}
+			for _, utb := range db.usersIdle {
+				utb.pruneUnmatched(matched, r.TopUnmatched)
+			}
+		}
+
+		if r.DetailDays <= 0 {
+			continue
+		}
+
+		d, err := time.ParseInLocation(time.DateOnly, day, time.Local)
+		if err != nil || !d.Before(oldest) {
+			continue
+		}
+
+		for _, g := range ph.limits {
+			total := g.balance(db)
+			if total > 0 {
+				ph.groupsHist.add(day, g.GroupID(), total)
+			}
+		}
+		for _, dtb := range []dayTimeBalance{ph.balance, ph.idle, ph.cpu} {
+			delete(dtb, day)
+		}
+		for _, utb := range []userTimeBalance{ph.users, ph.usersIdle, ph.cpuIdle} {
+			for _, dtb := range utb {
+				delete(dtb, day)
+			}
+		}
+	}
+
+	for _, utb := range []userTimeBalance{ph.users, ph.usersIdle, ph.cpuIdle} {
+		for user, dtb := range utb {
+			if len(dtb) == 0 {
+				delete(utb, user)
+			}
+		}
+	}
+}
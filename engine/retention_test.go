@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPruneUnmatched(t *testing.T) {
+	tb := TimeBalance{
+		"game":    time.Hour,
+		"kworker": time.Minute,
+		"systemd": time.Hour * 2,
+		"bash":    time.Second,
+	}
+
+	tb.pruneUnmatched(map[string]bool{"game": true}, 1)
+
+	if len(tb) != 2 {
+		t.Error("expected the matched and one unmatched process, got", tb)
+	}
+	if _, ok := tb["game"]; !ok {
+		t.Error("matched process was pruned")
+	}
+	if _, ok := tb["systemd"]; !ok {
+		t.Error("the unmatched process with the highest balance was pruned")
+	}
+}
+
+func TestCompactBalance(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	ph.limits = []ProcessGroupDayLimit{
+		{PG: []string{"p1", "p2"}, DL: DayLimits{"*": time.Hour}},
+	}
+
+	ph.balance.add("2024-01-01", "p1", time.Minute)
+	ph.balance.add("2024-01-01", "p2", time.Minute)
+	ph.balance.add("2024-01-01", "other", time.Minute)
+	ph.balance.add("2024-01-09", "p1", time.Minute)
+	ph.balance.add("2024-01-09", "other", time.Minute)
+	ph.balance.add("2024-01-10", "other", time.Minute)
+
+	ph.compactBalance("2024-01-10", Retention{DetailDays: 7, OnlyGroups: true})
+
+	if _, ok := ph.balance["2024-01-01"]; ok {
+		t.Error("day older than the retention period was not compacted")
+	}
+	if ph.groupsHist["2024-01-01"]["p1"] != time.Minute*2 {
+		t.Error("wrong group total of a compacted day:", ph.groupsHist["2024-01-01"])
+	}
+	if _, ok := ph.balance["2024-01-09"]["other"]; ok {
+		t.Error("unmatched process was not pruned from a past day")
+	}
+	if ph.balance["2024-01-09"]["p1"] != time.Minute {
+		t.Error("matched process was pruned from a day within the retention period")
+	}
+	if _, ok := ph.balance["2024-01-10"]["other"]; !ok {
+		t.Error("today's balance was pruned")
+	}
+}
+
+func TestCompactBalanceDays(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	ph.limits = []ProcessGroupDayLimit{
+		{ID: "games", PG: []string{"p1"}, DL: DayLimits{"*": time.Hour}, Users: []string{"alice"}},
+	}
+
+	// days that are missing from the per-process balance are compacted too
+	ph.users.add("alice", "2024-01-01", "p1", time.Minute)
+	ph.idle.add("2024-01-02", "p1", time.Minute)
+	ph.cpu.add("2024-01-02", "p1", time.Second)
+	ph.cpuIdle.add("games", "2024-01-02", "p1", time.Minute)
+	ph.sessions.add("2024-01-02", "alice", time.Hour)
+
+	ph.compactBalance("2024-01-10", Retention{DetailDays: 7})
+
+	if ph.groupsHist["2024-01-01"]["games"] != time.Minute {
+		t.Error("wrong group total of a compacted day:", ph.groupsHist)
+	}
+	if len(ph.users) != 0 || len(ph.idle) != 0 || len(ph.cpu) != 0 || len(ph.cpuIdle) != 0 {
+		t.Error("days older than the retention period were not compacted:", ph.users, ph.idle, ph.cpu, ph.cpuIdle)
+	}
+	if ph.sessions["2024-01-02"]["alice"] != time.Hour {
+		t.Error("session time history was dropped:", ph.sessions)
+	}
+}
+
+func TestCompactBalanceOnceADay(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	ph.limits = []ProcessGroupDayLimit{{ID: "games", PG: []string{"p1"}, DL: DayLimits{"*": time.Hour}}}
+	r := Retention{DetailDays: 7}
+
+	// nothing is compacted without retention
+	ph.balance.add("2024-01-01", "p1", time.Minute)
+	ph.compactBalance("2024-01-10", Retention{})
+	if _, ok := ph.balance["2024-01-01"]; !ok {
+		t.Error("compacted without retention")
+	}
+
+	// the history is compacted again when the retention changes, but not again the same day
+	ph.compactBalance("2024-01-10", r)
+	if _, ok := ph.balance["2024-01-01"]; ok {
+		t.Error("not compacted when the retention changed")
+	}
+	ph.balance.add("2024-01-02", "p1", time.Minute)
+	ph.compactBalance("2024-01-10", r)
+	if _, ok := ph.balance["2024-01-02"]; !ok {
+		t.Error("compacted twice the same day")
+	}
+	ph.compactBalance("2024-01-11", r)
+	if _, ok := ph.balance["2024-01-02"]; ok {
+		t.Error("not compacted the next day")
+	}
+}
+
+func TestLoadBalanceOlderFormat(t *testing.T) {
+	const path = "tmp.old.balance.json"
+
+	err := os.WriteFile(path, []byte(`{"2024-01-01": {"p1": "1m0s"}}`), 0644)
+	if err != nil {
+		t.Fatal("cannot write", path, err)
+	}
+	defer os.Remove(path)
+
+	ph := NewProcessHunter(time.Second, path, time.Hour, nil, "")
+	err = ph.LoadBalance()
+	if err != nil {
+		t.Error("Error loading balance from file", path, err)
+	}
+
+	if ph.balance["2024-01-01"]["p1"] != time.Minute {
+		t.Error("balance in the older format was not loaded correctly:", ph.balance)
+	}
+}
+
+func TestConfigFormats(t *testing.T) {
+	cfg, err := parseConfig([]byte(`{"groups": [{"processes": ["p1"], "limits": {"*": "1h"}}], "retention": {"detail_days": 30}}`))
+	if err != nil {
+		t.Fatal("Could not parse config:", err)
+	}
+	if len(cfg.Groups) != 1 || cfg.Retention == nil || cfg.Retention.DetailDays != 30 {
+		t.Error("config object not parsed correctly:", cfg)
+	}
+
+	b, err := Config{Groups: cfg.Groups}.MarshalJSON()
+	if err != nil {
+		t.Error("Cannot marshal config", err)
+	}
+	if len(b) == 0 || b[0] != '[' {
+		t.Error("config without settings is not marshaled as an array of process groups:", string(b))
+	}
+
+	_, err = parseConfig([]byte(`{"groups": [], "retention": {"detail_days": -1}}`))
+	if err == nil {
+		t.Error("accepted negative retention")
+	}
+}
+
+func TestMigrateGroupsHistory(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	ph.limits = []ProcessGroupDayLimit{
+		{ID: "games", PG: []string{"p1", "p2"}, DL: DayLimits{"*": time.Hour}},
+	}
+	ph.groupsHist.add("2024-01-01", "p1,p2", time.Minute)
+
+	ph.migrateGroupsHistory()
+
+	if len(ph.groupsHist["2024-01-01"]) != 1 || ph.groupsHist["2024-01-01"]["games"] != time.Minute {
+		t.Error("groups history not migrated to group id:", ph.groupsHist)
+	}
+}
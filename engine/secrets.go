@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"slices"
+)
+
+// SecretPlaceholder replaces the secrets of the configuration (e.g. the passwords) when it's served.
+// A configuration set with the placeholder keeps the secret that is already stored.
+const SecretPlaceholder = "********"
+
+// redact returns SecretPlaceholder instead of secret s, unless s is empty
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	return SecretPlaceholder
+}
+
+// restore sets *s to stored, if *s is SecretPlaceholder, and reports whether it did
+func restore(s *string, stored string) bool {
+	if *s != SecretPlaceholder {
+		return false
+	}
+	*s = stored
+	return true
+}
+
+// redacted returns a copy of cfg with the secrets replaced by SecretPlaceholder
+func (cfg Config) redacted() Config {
+	cfg.Webhooks = slices.Clone(cfg.Webhooks)
+	for i := range cfg.Webhooks {
+		cfg.Webhooks[i].Secret = redact(cfg.Webhooks[i].Secret)
+	}
+	if cfg.MQTT != nil {
+		m := *cfg.MQTT
+		m.Password = redact(m.Password)
+		cfg.MQTT = &m
+	}
+	if cfg.Email != nil {
+		e := *cfg.Email
+		e.Password = redact(e.Password)
+		cfg.Email = &e
+	}
+
+	return cfg
+}
+
+// withSecrets returns cfg with the secrets that are SecretPlaceholder replaced by the ones of stored,
+// and whether any was replaced. The secret of a webhook is the one of the stored webhook with the same URL.
+func (cfg Config) withSecrets(stored Config) (Config, bool) {
+	restored := false
+
+	cfg.Webhooks = slices.Clone(cfg.Webhooks)
+	for i := range cfg.Webhooks {
+		j := slices.IndexFunc(stored.Webhooks, func(h Webhook) bool { return h.URL == cfg.Webhooks[i].URL })
+		if j >= 0 && restore(&cfg.Webhooks[i].Secret, stored.Webhooks[j].Secret) {
+			restored = true
+		}
+	}
+	if cfg.MQTT != nil && stored.MQTT != nil {
+		m := *cfg.MQTT
+		if restore(&m.Password, stored.MQTT.Password) {
+			cfg.MQTT, restored = &m, true
+		}
+	}
+	if cfg.Email != nil && stored.Email != nil {
+		e := *cfg.Email
+		if restore(&e.Password, stored.Email.Password) {
+			cfg.Email, restored = &e, true
+		}
+	}
+
+	return cfg, restored
+}
+
+// GetRedactedConfig returns the configuration, with the secrets replaced by SecretPlaceholder
+func (ph *ProcessHunter) GetRedactedConfig() Config {
+	return ph.GetConfig().redacted()
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMQTTPassword(t *testing.T) {
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	if err := ph.SetConfig([]byte(`{"groups": [], "mqtt": {"broker": "localhost:1883", "password": "s3cr3t"}}`)); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	if p := ph.GetRedactedConfig().MQTT.Password; p != SecretPlaceholder || ph.GetConfig().MQTT.Password != "s3cr3t" {
+		t.Error("unexpected redacted password", p)
+	}
+	if err := ph.SetConfig([]byte(`{"groups": [], "mqtt": {"broker": "localhost:1883", "password": "********"}}`)); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	if ph.GetConfig().MQTT.Password != "s3cr3t" {
+		t.Error("password not kept", ph.GetConfig().MQTT)
+	}
+}
+
+func TestEmailPassword(t *testing.T) {
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	cfg := `{"groups": [], "email": {"server": "smtp.example.com:587", "username": "ph", "password": "%s",
+		"from": "ph@example.com", "to": ["parent@example.com"]}}`
+	if err := ph.SetConfig([]byte(fmt.Sprintf(cfg, "s3cr3t"))); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	if p := ph.GetRedactedConfig().Email.Password; p != SecretPlaceholder || ph.GetConfig().Email.Password != "s3cr3t" {
+		t.Error("unexpected redacted password", p)
+	}
+	if err := ph.SetConfig([]byte(fmt.Sprintf(cfg, SecretPlaceholder))); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	if ph.GetConfig().Email.Password != "s3cr3t" {
+		t.Error("password not kept", ph.GetConfig().Email)
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cfg.json")
+	if err := os.WriteFile(path, []byte(`[]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, path)
+	err := ph.SetConfig([]byte(`{"groups": [], "webhooks": [{"url": "https://example.com/ph", "secret": "s3cr3t"}]}`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	if fi, err := os.Stat(path); err != nil || (runtime.GOOS != "windows" && fi.Mode().Perm() != 0600) {
+		t.Error("config file is readable by others", fi.Mode(), err)
+	}
+
+	redacted := ph.GetRedactedConfig()
+	if redacted.Webhooks[0].Secret != SecretPlaceholder {
+		t.Error("secret not redacted", redacted.Webhooks)
+	}
+	if s := ph.Snapshot(UpdateCheck, ""); s.Config.Webhooks[0].Secret != SecretPlaceholder {
+		t.Error("secret not redacted in the snapshot", s.Config.Webhooks)
+	}
+	if ph.GetConfig().Webhooks[0].Secret != "s3cr3t" {
+		t.Error("redaction changed the stored secret", ph.GetConfig().Webhooks)
+	}
+
+	// setting the served configuration keeps the secret
+	b, _ := json.Marshal(redacted)
+	if err := ph.SetConfig(b); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	if ph.GetConfig().Webhooks[0].Secret != "s3cr3t" {
+		t.Error("secret not kept", ph.GetConfig().Webhooks)
+	}
+	if saved, _ := os.ReadFile(path); !strings.Contains(string(saved), "s3cr3t") {
+		t.Error("secret not saved", string(saved))
+	}
+
+	// a new secret replaces the stored one
+	err = ph.SetConfig([]byte(`{"groups": [], "webhooks": [{"url": "https://example.com/ph", "secret": "n3w"}]}`))
+	if err != nil || ph.GetConfig().Webhooks[0].Secret != "n3w" {
+		t.Error("secret not changed", ph.GetConfig().Webhooks, err)
+	}
+}
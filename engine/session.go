@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sessionWarning is how long before the session limit runs out a warning event is emitted
+const sessionWarning = 10 * time.Minute
+
+// sessionCommandTimeout is how long the session command may run
+const sessionCommandTimeout = 30 * time.Second
+
+// Session describes a login session of a user
+type Session struct {
+	User  string    // User is the name of the user
+	TTY   string    // TTY is the terminal (or display) of the session
+	PID   int       // PID is the ID of the session's login process
+	Start time.Time // Start is when the session started
+}
+
+// SessionSource lists the login sessions of the users
+type SessionSource interface {
+	Sessions() ([]Session, error)
+}
+
+// SessionDayBalance describes the session time of a user for the day, and its limit and downtime
+type SessionDayBalance struct {
+	User         string         `json:"user"`          // User is the name of the user
+	Sessions     int            `json:"sessions"`      // Sessions is the number of the current sessions of the user
+	Limit        prettyDuration `json:"limit"`         // Limit is the active daily session limit
+	LimitDefined bool           `json:"limit_defined"` // LimitDefined indicates whether a session limit is defined for today
+	Balance      prettyDuration `json:"balance"`       // Balance is the session time of the user today
+	Overtime     bool           `json:"overtime"`      // Overtime indicates whether the balance exceeds the limit
+	Downtime     []string       `json:"downtime"`      // Downtime lists the active session downtime periods for today
+	Blocked      bool           `json:"blocked"`       // Blocked indicates whether the user is currently in session downtime
+	TimeStamp    string         `json:"timestamp"`     // TimeStamp is when this balance was calculated (HH:MM format)
+}
+
+// SetSessionSource sets the source of the login sessions. Session time is not tracked when s is nil.
+func (ph *ProcessHunter) SetSessionSource(s SessionSource) {
+	ph.limitsRWM.Lock()
+	defer ph.limitsRWM.Unlock()
+
+	ph.sessionSource = s
+}
+
+// GetLatestSessionsBalance returns the latest session balance of the users with a session limit or downtime
+func (ph *ProcessHunter) GetLatestSessionsBalance() []SessionDayBalance {
+	ph.pgroupsRWM.RLock()
+	defer ph.pgroupsRWM.RUnlock()
+
+	return ph.sessionsBalance
+}
+
+// listSessions returns the sessions of ph.sessionSource, if any
+func (ph *ProcessHunter) listSessions() ([]Session, error) {
+	ph.limitsRWM.RLock()
+	s := ph.sessionSource
+	ph.limitsRWM.RUnlock()
+
+	if s == nil {
+		return nil, nil
+	}
+	return s.Sessions()
+}
+
+// sessionCommand returns the command that ends session s, by replacing {user}, {tty} and {pid} in cmd
+func sessionCommand(cmd []string, s Session) []string {
+	r := strings.NewReplacer("{user}", s.User, "{tty}", s.TTY, "{pid}", strconv.Itoa(s.PID))
+
+	c := make([]string, len(cmd))
+	for i, a := range cmd {
+		c[i] = r.Replace(a)
+	}
+	return c
+}
+
+// sessionKey identifies the session s: its login process and when it started
+func sessionKey(s Session) string {
+	return s.User + "/" + strconv.Itoa(s.PID) + "/" + s.Start.Format(time.RFC3339)
+}
+
+// runCommand runs the command cmd (the name of the program followed by the arguments)
+func runCommand(ctx context.Context, cmd []string) error {
+	return exec.CommandContext(ctx, cmd[0], cmd[1:]...).Run()
+}
+
+// sessionEnd is a session command to run, to end a session of a user
+type sessionEnd struct {
+	user   string
+	pid    int      // the login process of the session
+	cmd    []string // the session command, as returned by sessionCommand
+	reason string
+}
+
+// checkSessions adds dt to the session time of each user with sessions, for the day of now,
+// evaluates the session limits and downtime of the profiles, and warns the users whose session limit is about to run out.
+// It returns the session balance of the users with a session limit or downtime, and the session commands to run
+// to end the sessions of the users the limits or downtime apply to, unless it's vacation (see ProcessHunter.Vacation).
+// The command of each session is returned once, so a user who logs in again is ended again (see sessionKey).
+// ph.balanceRWM and ph.limitsRWM must be locked by the caller.
+func (ph *ProcessHunter) checkSessions(sessions []Session, dt time.Duration, now time.Time) ([]SessionDayBalance, []sessionEnd) {
+	date := toText(now)
+	weekDay := weekDays[now.Weekday()]
+
+	byUser := make(map[string][]Session)
+	for _, s := range sessions {
+		byUser[s.User] = append(byUser[s.User], s)
+	}
+	for u := range byUser {
+		ph.sessions.add(date, u, dt)
+	}
+
+	cmd := ph.config.SessionCommand
+	if cmd == nil {
+		cmd = defaultSessionCommand
+	}
+
+	if _, ok := ph.ended[date]; !ok {
+		ph.ended = map[string]map[string]bool{date: {}}
+	}
+	ended := ph.ended[date]
+
+	var sdbs []SessionDayBalance
+	var ends []sessionEnd
+	for _, pr := range ph.config.Profiles {
+		if len(pr.SessionLimit) == 0 && len(pr.SessionDowntime) == 0 {
+			continue
+		}
+
+		sdb := SessionDayBalance{User: pr.User, Sessions: len(byUser[pr.User]), TimeStamp: now.Format(dtTimeFormat)}
+		sdb.Balance.Duration = ph.sessions[date][pr.User]
+		sdb.Overtime, sdb.Limit.Duration, sdb.LimitDefined = isOvertime(sdb.Balance.Duration, date, weekDay, pr.SessionLimit)
+		sdb.Blocked, sdb.Downtime = isBlocked(now, date, weekDay, pr.SessionDowntime)
+		sdb.Balance.Duration = sdb.Balance.Round(time.Second)
+		sdbs = append(sdbs, sdb)
+
+		if sdb.Sessions == 0 {
+			continue
+		}
+
+		if !sdb.Overtime && !sdb.Blocked {
+			if remaining := sdb.Limit.Duration - sdb.Balance.Duration; sdb.LimitDefined && remaining <= sessionWarning && ph.warned[pr.User] != date {
+				ph.warned[pr.User] = date
+				msg := "session time remaining: " + remaining.String()
+				ph.emit(Event{Type: EventSessionWarning, User: pr.User, Message: msg})
+				ph.notify(Notification{Type: NotifyWarning, User: pr.User, Remaining: remaining, Message: msg})
+			}
+			continue
+		}
+
+		if ph.vacation.After(now) {
+			continue
+		}
+
+		reason := "session downtime"
+		if sdb.Overtime {
+			reason = "session limit " + sdb.Limit.String() + " exceeded"
+		}
+		if len(cmd) == 0 {
+			if !ended[pr.User] {
+				ended[pr.User] = true
+				ph.emit(Event{Type: EventSessionEnd, User: pr.User, Message: reason + ", but no session command is configured"})
+			}
+			continue
+		}
+		for _, s := range byUser[pr.User] {
+			if key := sessionKey(s); !ended[key] {
+				ended[key] = true
+				ends = append(ends, sessionEnd{user: pr.User, pid: s.PID, cmd: sessionCommand(cmd, s), reason: reason})
+			}
+		}
+	}
+
+	return sdbs, ends
+}
+
+// endSessions runs the session commands of ends, each with a timeout (see sessionCommandTimeout), and emits an event each.
+// It must be called without holding the locks of ph. It returns ctx.Err() if ctx is cancelled.
+func (ph *ProcessHunter) endSessions(ctx context.Context, ends []sessionEnd) error {
+	for _, se := range ends {
+		// check if context is cancelled before ending the session
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		e := Event{Type: EventSessionEnd, User: se.user, PID: se.pid, Message: se.reason + ": " + strings.Join(se.cmd, " ")}
+		cctx, cancel := context.WithTimeout(ctx, sessionCommandTimeout)
+		if err := ph.runCommand(cctx, se.cmd); err != nil {
+			e.Message = e.Message + ": " + err.Error()
+		}
+		cancel()
+		ph.emit(e)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// utmpPath is the path of the utmp file, that lists the current login sessions
+const utmpPath = "/var/run/utmp"
+
+// utmpUserProcess is the type of the utmp records of the login sessions (USER_PROCESS)
+const utmpUserProcess = 7
+
+// defaultSessionCommand is the command that ends the sessions of a user, when Settings.SessionCommand is not set
+var defaultSessionCommand = []string{"loginctl", "terminate-user", "{user}"}
+
+// utmpRecord is a record of the utmp file (struct utmp of glibc, on 64-bit little-endian platforms)
+type utmpRecord struct {
+	Type    int16
+	_       [2]byte
+	PID     int32
+	Line    [32]byte
+	ID      [4]byte
+	User    [32]byte
+	Host    [256]byte
+	Exit    [2]int16
+	Session int32
+	Sec     int32
+	Usec    int32
+	Addr    [4]int32
+	_       [20]byte
+}
+
+// utmpSource is a SessionSource that reads the login sessions from a utmp file
+type utmpSource struct {
+	path string
+}
+
+// defaultSessionSource returns the SessionSource of the OS
+func defaultSessionSource() SessionSource {
+	return utmpSource{path: utmpPath}
+}
+
+// Sessions returns the login sessions in the utmp file, whose login process is running
+func (u utmpSource) Sessions() ([]Session, error) {
+	f, err := os.Open(u.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sessions, err := readUtmp(f)
+	if err != nil {
+		return nil, err
+	}
+
+	running := sessions[:0]
+	for _, s := range sessions {
+		if _, err := os.Stat("/proc/" + strconv.Itoa(s.PID)); err == nil {
+			running = append(running, s)
+		}
+	}
+	return running, nil
+}
+
+// readUtmp reads the login sessions (the USER_PROCESS records) from r, in utmp format
+func readUtmp(r io.Reader) ([]Session, error) {
+	var sessions []Session
+	for {
+		var rec utmpRecord
+		err := binary.Read(r, binary.LittleEndian, &rec)
+		if err == io.EOF {
+			return sessions, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if rec.Type != utmpUserProcess {
+			continue
+		}
+		sessions = append(sessions, Session{
+			User:  cString(rec.User[:]),
+			TTY:   cString(rec.Line[:]),
+			PID:   int(rec.PID),
+			Start: time.Unix(int64(rec.Sec), int64(rec.Usec)*1000),
+		})
+	}
+}
+
+// cString returns the NUL terminated string in b
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestReadUtmp(t *testing.T) {
+	var b bytes.Buffer
+
+	records := []utmpRecord{{Type: 2, PID: 1}, {Type: utmpUserProcess, PID: 42, Sec: 1700000000}}
+	copy(records[1].User[:], "alice")
+	copy(records[1].Line[:], "tty2")
+	for _, r := range records {
+		if err := binary.Write(&b, binary.LittleEndian, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.Len() != 2*384 {
+		t.Fatal("unexpected utmp record size", b.Len()/2)
+	}
+
+	sessions, err := readUtmp(&b)
+	if err != nil {
+		t.Fatal("Could not read utmp:", err)
+	}
+	if len(sessions) != 1 || sessions[0].User != "alice" || sessions[0].TTY != "tty2" || sessions[0].PID != 42 || sessions[0].Start.Unix() != 1700000000 {
+		t.Error("unexpected sessions", sessions)
+	}
+}
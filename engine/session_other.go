@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package engine
+
+// defaultSessionCommand is the command that ends the sessions of a user, when Settings.SessionCommand is not set.
+// There is no default command on this OS.
+var defaultSessionCommand []string
+
+// defaultSessionSource returns nil, since login sessions are not supported on this OS
+func defaultSessionSource() SessionSource {
+	return nil
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeSessions is a SessionSource that returns fixed sessions
+type fakeSessions []Session
+
+func (f fakeSessions) Sessions() ([]Session, error) {
+	return f, nil
+}
+
+func TestCheckSessions(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`{"groups": [], "session_command": ["lock", "{user}", "{tty}"],
+		"profiles": [{"user": "alice", "groups": [], "session_limit": {"*": "1h"}}]}`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	var commands [][]string
+	ph.runCommand = func(ctx context.Context, cmd []string) error {
+		commands = append(commands, cmd)
+		return nil
+	}
+	f := &fakeNotifier{}
+	ph.SetNotifier(f)
+	ph.SetSessionSource(fakeSessions{{User: "alice", TTY: "tty1", PID: 10}, {User: "alice", TTY: "tty2", PID: 11}, {User: "bob", TTY: "tty3", PID: 12}})
+
+	sessions, err := ph.listSessions()
+	if err != nil {
+		t.Fatal("Could not list sessions:", err)
+	}
+
+	now := time.Now()
+	ph.sessions.add(toText(now), "alice", time.Minute*45)
+
+	sdbs, ends := ph.checkSessions(sessions, time.Minute*5, now)
+	if err := ph.endSessions(context.Background(), ends); err != nil {
+		t.Error("endSessions failed:", err)
+	}
+	if len(sdbs) != 1 || sdbs[0].User != "alice" || sdbs[0].Balance.Duration != time.Minute*50 || sdbs[0].Sessions != 2 {
+		t.Error("unexpected session balance:", sdbs)
+	}
+	if ph.sessions[toText(now)]["bob"] != time.Minute*5 {
+		t.Error("session time of a user without profile not tracked")
+	}
+	if len(commands) != 0 {
+		t.Error("ended sessions within the session limit:", commands)
+	}
+	if ev := ph.GetEvents(); len(ev) != 2 || ev[0].Type != EventConfig || ev[1].Type != EventSessionWarning || ev[1].User != "alice" {
+		t.Error("expected a session warning, got", ev)
+	}
+	ph.sendNotifications()
+	if len(f.notifications) != 1 || f.notifications[0].Type != NotifyWarning || f.notifications[0].User != "alice" {
+		t.Error("expected a session warning notification, got", f.notifications)
+	}
+
+	// exceed the session limit
+	_, ends = ph.checkSessions(sessions, time.Minute*15, now)
+	if len(commands) != 0 {
+		t.Error("ran session commands before endSessions:", commands)
+	}
+	if err := ph.endSessions(context.Background(), ends); err != nil {
+		t.Error("endSessions failed:", err)
+	}
+	expected := [][]string{{"lock", "alice", "tty1"}, {"lock", "alice", "tty2"}}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Error("expected session commands", expected, "got", commands)
+	}
+	if ev := ph.GetEvents(); len(ev) != 4 || ev[2].Type != EventSessionEnd || ev[3].Type != EventSessionEnd {
+		t.Error("expected session end events, got", ev)
+	}
+
+	// each session is ended once
+	if _, ends = ph.checkSessions(sessions, time.Minute, now); len(ends) != 0 {
+		t.Error("ended the sessions again:", ends)
+	}
+
+	// a user who logs in again is ended again
+	sessions = append(sessions, Session{User: "alice", TTY: "tty1", PID: 13, Start: now})
+	_, ends = ph.checkSessions(sessions, time.Minute, now)
+	if len(ends) != 1 || ends[0].pid != 13 || !reflect.DeepEqual(ends[0].cmd, []string{"lock", "alice", "tty1"}) {
+		t.Error("expected the new session to be ended, got", ends)
+	}
+}
+
+func TestParseConfigSessions(t *testing.T) {
+	invalid := []string{
+		`{"groups": [], "profiles": [{"user": "alice", "groups": [], "session_limit": {"someday": "1h"}}]}`,
+		`{"groups": [], "profiles": [{"user": "alice", "groups": [], "session_downtime": {"*": ["21:00"]}}]}`,
+		`{"groups": [], "session_command": []}`,
+	}
+	for _, inv := range invalid {
+		if _, err := parseConfig([]byte(inv)); err == nil {
+			t.Error("accepted invalid config", inv)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"time"
+)
+
+// stallPeriods is how many check periods may pass without a successful check, before the scheduler is considered stalled
+const stallPeriods = 3
+
+// Status describes the health of ph
+type Status struct {
+	Healthy           bool           `json:"healthy"`                   // Healthy is false if there are any problems
+	Problems          []string       `json:"problems,omitempty"`        // Problems describes what is unhealthy
+	Version           string         `json:"version,omitempty"`         // Version is the version of ph
+	Started           time.Time      `json:"started"`                   // Started is when ph started
+	Uptime            prettyDuration `json:"uptime"`                    // Uptime is how long ph runs
+	LastCheck         *time.Time     `json:"last_check,omitempty"`      // LastCheck is when the processes were last checked successfully
+	LastCheckDuration prettyDuration `json:"last_check_duration"`       // LastCheckDuration is how long the last successful check took
+	Stalled           bool           `json:"stalled"`                   // Stalled indicates that the processes have not been checked for several check periods
+	LastSave          *time.Time     `json:"last_save,omitempty"`       // LastSave is when the balance was last saved successfully
+	LastSaveError     string         `json:"last_save_error,omitempty"` // LastSaveError is the error of the last save of the balance, if it failed
+	ConfigPath        string         `json:"config_path"`               // ConfigPath is the path of the configuration file
+	ConfigModified    *time.Time     `json:"config_modified,omitempty"` // ConfigModified is the modification time of the loaded configuration file
+	ConfigError       string         `json:"config_error,omitempty"`    // ConfigError is the error of the last load of the configuration file, if it failed
+	Groups            int            `json:"groups"`                    // Groups is the number of process groups
+}
+
+// timeRef returns a reference to t, or nil if t is zero
+func timeRef(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// GetStatus returns the health of ph at now
+func (ph *ProcessHunter) GetStatus(now time.Time) Status {
+	ph.limitsRWM.RLock()
+	st := Status{
+		Started:        ph.started,
+		Uptime:         prettyDuration{now.Sub(ph.started).Round(time.Second)},
+		ConfigPath:     ph.cfgPath,
+		ConfigModified: timeRef(ph.cfgTime),
+		Groups:         len(ph.limits),
+	}
+	ph.limitsRWM.RUnlock()
+
+	m := ph.metrics
+	m.mu.Lock()
+	st.LastCheck = timeRef(m.lastCheck)
+	st.LastCheckDuration = prettyDuration{m.lastCheckDuration}
+	st.LastSave = timeRef(m.lastSave)
+	if m.saveErr != nil {
+		st.LastSaveError = m.saveErr.Error()
+	}
+	if m.loadErr != nil {
+		st.ConfigError = m.loadErr.Error()
+	}
+	lastCheck := m.lastCheck
+	m.mu.Unlock()
+
+	if lastCheck.IsZero() {
+		lastCheck = ph.started
+	}
+	st.Stalled = now.Sub(lastCheck) > stallPeriods*ph.checkPeriod
+
+	if st.Stalled {
+		st.Problems = append(st.Problems, "processes not checked since "+lastCheck.Format(time.DateTime))
+	}
+	if st.LastSaveError != "" {
+		st.Problems = append(st.Problems, "cannot save the balance: "+st.LastSaveError)
+	}
+	if st.ConfigError != "" {
+		st.Problems = append(st.Problems, "cannot load the configuration: "+st.ConfigError)
+	}
+	st.Healthy = len(st.Problems) == 0
+
+	return st
+}
@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetStatus(t *testing.T) {
+	dir := t.TempDir()
+	ph := NewProcessHunter(time.Minute, filepath.Join(dir, "missing", "balance.json"), time.Hour, nil, filepath.Join(dir, "cfg.json"))
+	now := ph.started.Add(time.Minute)
+
+	if err := ph.LoadConfig(); err == nil {
+		t.Fatal("loaded a missing config file")
+	}
+	st := ph.GetStatus(now)
+	if st.Healthy || st.ConfigError == "" || st.Stalled || st.LastCheck != nil {
+		t.Error("unexpected status with a missing config file", st)
+	}
+
+	if err := os.WriteFile(ph.cfgPath, []byte(`[{"id": "games", "processes": ["game"], "limits": {"*": "1h"}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ph.LoadConfig(); err != nil {
+		t.Fatal("Could not load config:", err)
+	}
+	ph.metrics.checked(time.Second, 10)
+	st = ph.GetStatus(now)
+	if !st.Healthy || st.Groups != 1 || st.ConfigModified == nil || st.LastCheck == nil || st.LastCheckDuration.Duration != time.Second {
+		t.Error("unexpected status", st)
+	}
+
+	// the balance directory doesn't exist
+	if err := ph.saveBalance(); err == nil {
+		t.Error("saved the balance to a missing directory")
+	}
+	if st = ph.GetStatus(now); st.Healthy || st.LastSaveError == "" || st.LastSave != nil {
+		t.Error("save error not reported", st)
+	}
+
+	if st = ph.GetStatus(time.Now().Add(stallPeriods*time.Minute + time.Second)); !st.Stalled || st.Healthy {
+		t.Error("stalled scheduler not reported", st)
+	}
+}
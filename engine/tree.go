@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"time"
+)
+
+// respawnWindow is how soon after a kill a process of the same group and name has to start, to be considered a respawn
+const respawnWindow = 15 * time.Second
+
+// processTable indexes the running processes
+type processTable struct {
+	byName    map[string][]processInfo // processes by executable name
+	byPID     map[int]processInfo      // processes by PID
+	children  map[int][]processInfo    // child processes by PID of the parent
+	protected map[int]bool             // PIDs that are never killed
+	killed    map[int]bool             // PIDs that were killed (in this check)
+}
+
+// newProcessTable returns the process table of processes, with the protected PIDs protected
+func newProcessTable(processes []processInfo, protected map[int]bool) *processTable {
+	pt := &processTable{
+		byName:    make(map[string][]processInfo),
+		byPID:     make(map[int]processInfo),
+		children:  make(map[int][]processInfo),
+		protected: protected,
+		killed:    make(map[int]bool),
+	}
+	for _, p := range processes {
+		pt.byName[p.name] = append(pt.byName[p.name], p)
+		pt.byPID[p.pid] = p
+		if p.ppid != p.pid {
+			pt.children[p.ppid] = append(pt.children[p.ppid], p)
+		}
+	}
+	return pt
+}
+
+// descendants returns the child processes of p, their child processes, and so on
+func (pt *processTable) descendants(p processInfo) []processInfo {
+	var ds []processInfo
+	visited := map[int]bool{p.pid: true}
+	queue := []processInfo{p}
+	for len(queue) > 0 {
+		for _, c := range pt.children[queue[0].pid] {
+			if !visited[c.pid] {
+				visited[c.pid] = true
+				ds = append(ds, c)
+				queue = append(queue, c)
+			}
+		}
+		queue = queue[1:]
+	}
+	return ds
+}
+
+// ancestor returns the closest ancestor (parent, parent's parent...) of p named name, and whether it was found
+func (pt *processTable) ancestor(p processInfo, name string) (processInfo, bool) {
+	visited := map[int]bool{p.pid: true}
+	for a, ok := pt.byPID[p.ppid]; ok && !visited[a.pid]; a, ok = pt.byPID[a.ppid] {
+		if a.name == name {
+			return a, true
+		}
+		visited[a.pid] = true
+	}
+	return processInfo{}, false
+}
+
+// victims returns the processes to kill for process p of group g:
+// p itself, the launcher of the group (if it is an ancestor of p), the parent of p when p respawned
+// and g escalates respawns, and the descendants of all of them when g kills process trees
+func (pt *processTable) victims(g ProcessGroupDayLimit, p processInfo, respawned bool) []processInfo {
+	roots := []processInfo{p}
+	if g.Launcher != "" {
+		if l, ok := pt.ancestor(p, g.Launcher); ok {
+			roots = append([]processInfo{l}, roots...)
+		}
+	}
+	if respawned && g.EscalateRespawn {
+		if parent, ok := pt.byPID[p.ppid]; ok && parent.pid != p.pid {
+			roots = append([]processInfo{parent}, roots...)
+		}
+	}
+
+	if !g.KillTree {
+		return roots
+	}
+
+	var vs []processInfo
+	seen := make(map[int]bool)
+	for _, r := range roots {
+		for _, v := range append([]processInfo{r}, pt.descendants(r)...) {
+			if !seen[v.pid] {
+				seen[v.pid] = true
+				vs = append(vs, v)
+			}
+		}
+	}
+	return vs
+}
+
+// respawnKey returns the key of the last kill of process name of group in ph.lastKills
+func respawnKey(group string, name string) string {
+	return group + "\x00" + name
+}
+
+// checkRespawn returns whether process p of group started within respawnWindow after a process of the group
+// with the same name was killed, and emits an event if so. The start of the process is now, when not known.
+func (ph *ProcessHunter) checkRespawn(group string, p processInfo, now time.Time) bool {
+	k, ok := ph.lastKills[respawnKey(group, p.name)]
+	if !ok {
+		return false
+	}
+
+	start := p.start
+	if start.IsZero() {
+		start = now
+	}
+	if start.Before(k) || start.Sub(k) > respawnWindow {
+		return false
+	}
+
+	ph.emit(Event{Type: EventRespawn, Group: group, User: p.user, Process: p.name, PID: p.pid,
+		Message: "started " + start.Sub(k).Round(time.Millisecond).String() + " after a kill"})
+	return true
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testTree is a process tree: launcher (10) -> game (20) -> helper (30) -> crash-reporter (40), and launcher -> updater (50)
+var testTree = []processInfo{
+	{pid: 1, ppid: 0, name: "init"},
+	{pid: 10, ppid: 1, name: "launcher"},
+	{pid: 20, ppid: 10, name: "game"},
+	{pid: 30, ppid: 20, name: "helper"},
+	{pid: 40, ppid: 30, name: "crash-reporter"},
+	{pid: 50, ppid: 10, name: "updater"},
+}
+
+func pids(ps []processInfo) []int {
+	var r []int
+	for _, p := range ps {
+		r = append(r, p.pid)
+	}
+	slices.Sort(r)
+	return r
+}
+
+func TestProcessTable(t *testing.T) {
+	pt := newProcessTable(testTree, nil)
+	game := pt.byPID[20]
+
+	if d := pids(pt.descendants(game)); !reflect.DeepEqual(d, []int{30, 40}) {
+		t.Error("unexpected descendants", d)
+	}
+	if a, ok := pt.ancestor(pt.byPID[40], "launcher"); !ok || a.pid != 10 {
+		t.Error("launcher not found", a, ok)
+	}
+	if _, ok := pt.ancestor(game, "steam"); ok {
+		t.Error("found a launcher that is not an ancestor")
+	}
+
+	tests := []struct {
+		g         ProcessGroupDayLimit
+		respawned bool
+		expected  []int
+	}{
+		{ProcessGroupDayLimit{}, false, []int{20}},
+		{ProcessGroupDayLimit{KillTree: true}, false, []int{20, 30, 40}},
+		{ProcessGroupDayLimit{Launcher: "launcher"}, false, []int{10, 20}},
+		{ProcessGroupDayLimit{Launcher: "launcher", KillTree: true}, false, []int{10, 20, 30, 40, 50}},
+		{ProcessGroupDayLimit{EscalateRespawn: true}, false, []int{20}},
+		{ProcessGroupDayLimit{EscalateRespawn: true}, true, []int{10, 20}},
+	}
+	for _, tc := range tests {
+		if v := pids(pt.victims(tc.g, game, tc.respawned)); !reflect.DeepEqual(v, tc.expected) {
+			t.Error("group", tc.g, "respawned", tc.respawned, "victims", v, "expected", tc.expected)
+		}
+	}
+}
+
+func TestKillProcessesRespawn(t *testing.T) {
+	var killed []int
+	f := func(pid int) error {
+		killed = append(killed, pid)
+		return nil
+	}
+
+	ph := NewProcessHunter(time.Second, "", time.Hour, f, "")
+	g := ProcessGroupDayLimit{ID: "games", PG: []string{"game"}, EscalateRespawn: true}
+	db := dayBalance{active: TimeBalance{"game": time.Hour}}
+
+	err := ph.killProcesses(context.Background(), g, g.PG, db, newProcessTable(testTree, nil))
+	if err != nil {
+		t.Error("killProcesses failed", err)
+	}
+	if !reflect.DeepEqual(killed, []int{20}) {
+		t.Error("expected to kill the game only, killed", killed)
+	}
+
+	// the launcher starts the game again
+	killed = nil
+	respawned := slices.Clone(testTree)
+	respawned[2] = processInfo{pid: 21, ppid: 10, name: "game", start: time.Now()}
+
+	err = ph.killProcesses(context.Background(), g, g.PG, db, newProcessTable(respawned, nil))
+	if err != nil {
+		t.Error("killProcesses failed", err)
+	}
+	if !reflect.DeepEqual(killed, []int{10, 21}) {
+		t.Error("expected to kill the respawned game and its parent, killed", killed)
+	}
+
+	ev := ph.GetEvents()
+	if !slices.ContainsFunc(ev, func(e Event) bool { return e.Type == EventRespawn && e.PID == 21 && e.Group == "games" }) {
+		t.Error("respawn event not emitted", ev)
+	}
+
+	// a game started long after the kill is not a respawn
+	ph.lastKills[respawnKey("games", "game")] = time.Now().Add(-time.Hour)
+	if ph.checkRespawn("games", respawned[2], time.Now()) {
+		t.Error("process started an hour after a kill is a respawn")
+	}
+}
@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// Reasons of the updates
+const (
+	UpdateCheck   = "check"   // the processes were checked
+	UpdateConfig  = "config"  // the configuration was changed or reloaded
+	UpdateGrant   = "grant"   // a group was granted more time
+	UpdateBlock   = "block"   // a group was blocked or unblocked manually, or a lockdown or vacation started or ended
+	UpdateKill    = "kill"    // a process was killed
+	UpdateRequest = "request" // a request for more time was made or decided
+)
+
+// Update tells the subscribers that a new Snapshot is available
+type Update struct {
+	Time   time.Time `json:"time"`   // Time is when the update happened
+	Reason string    `json:"reason"` // Reason is why the snapshot changed, e.g. UpdateCheck
+}
+
+// Snapshot is the state of ph that the UI shows
+type Snapshot struct {
+	Time      time.Time                `json:"time"`      // Time is when the snapshot was taken
+	Reason    string                   `json:"reason"`    // Reason is the reason of the update that led to the snapshot
+	Config    Config                   `json:"config"`    // Config is the current configuration
+	Groups    []ProcessGroupDayBalance `json:"groups"`    // Groups is the latest balance of the process groups
+	Processes TimeBalance              `json:"processes"` // Processes is the latest balance of the processes
+}
+
+// subscribers are the channels that receive the updates
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[chan Update]struct{}
+}
+
+// Subscribe returns a channel that receives the updates, and a function that cancels the subscription.
+// A subscriber that is slow to receive may miss updates, but not the latest one after it receives again.
+func (ph *ProcessHunter) Subscribe() (<-chan Update, func()) {
+	c := make(chan Update, 1)
+
+	ph.updates.mu.Lock()
+	defer ph.updates.mu.Unlock()
+
+	if ph.updates.subs == nil {
+		ph.updates.subs = make(map[chan Update]struct{})
+	}
+	ph.updates.subs[c] = struct{}{}
+
+	return c, func() {
+		ph.updates.mu.Lock()
+		defer ph.updates.mu.Unlock()
+
+		delete(ph.updates.subs, c)
+	}
+}
+
+// publish sends an update with reason to the subscribers, without waiting for them.
+// It doesn't lock the state of ph, so it can be called while the state is locked.
+func (ph *ProcessHunter) publish(reason string) {
+	u := Update{Time: time.Now(), Reason: reason}
+
+	ph.updates.mu.Lock()
+	defer ph.updates.mu.Unlock()
+
+	for c := range ph.updates.subs {
+		// replace an update that the subscriber has not received yet
+		select {
+		case <-c:
+		default:
+		}
+		c <- u
+	}
+}
+
+// Snapshot returns the current state of ph, due to reason.
+// If user is not empty, the balance is limited to the groups and the processes of the user.
+func (ph *ProcessHunter) Snapshot(reason string, user string) Snapshot {
+	s := Snapshot{Time: time.Now(), Reason: reason, Config: ph.GetRedactedConfig()}
+	if user != "" {
+		s.Groups = ph.GetLatestUserPGroupsBalance(user)
+		s.Processes = ph.GetLatestUserProcessesBalance(user)
+	} else {
+		s.Groups = ph.GetLatestPGroupsBalance()
+		s.Processes = ph.GetLatestProcessesBalance()
+	}
+	return s
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+
+	updates, cancel := ph.Subscribe()
+
+	// a slow subscriber receives the latest update
+	ph.publish(UpdateCheck)
+	ph.publish(UpdateGrant)
+	select {
+	case u := <-updates:
+		if u.Reason != UpdateGrant {
+			t.Error("expected the latest update, got", u.Reason)
+		}
+	default:
+		t.Error("no update received")
+	}
+
+	if _, err := ph.AddGrant("none", time.Minute, ""); err == nil {
+		t.Error("granted time to a missing group")
+	}
+	select {
+	case u := <-updates:
+		t.Error("unexpected update", u.Reason)
+	default:
+	}
+
+	cancel()
+	ph.publish(UpdateCheck)
+	select {
+	case u := <-updates:
+		t.Error("update received after cancel", u.Reason)
+	default:
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ph := NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	if err := ph.SetConfig([]byte(`[{"id": "games", "processes": ["game"], "users": ["alice"], "limits": {"*": "1h"}}]`)); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	ph.pgroups = evaluateGroups(ph.limits, dayBalance{}, overrides{}, time.Now())
+
+	if s := ph.Snapshot(UpdateCheck, ""); s.Reason != UpdateCheck || len(s.Config.Groups) != 1 || len(s.Groups) != 1 {
+		t.Error("unexpected snapshot", s)
+	}
+	if s := ph.Snapshot(UpdateCheck, "bob"); len(s.Groups) != 0 {
+		t.Error("snapshot of bob has the groups of alice", s.Groups)
+	}
+}
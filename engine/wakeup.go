@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// nextDowntime returns when the next downtime period of dnt starts after now (today or tomorrow),
+// or the zero time if none does
+func nextDowntime(now time.Time, dnt Downtime) time.Time {
+	specs := mapKeysToSlice(dnt)
+	for d := 0; d <= 1; d++ {
+		day := now.AddDate(0, 0, d)
+		spec, found := getActiveSpec(toText(day), weekDays[day.Weekday()], specs)
+		if !found {
+			continue
+		}
+
+		var next time.Time
+		for _, period := range dnt[spec] {
+			separator := strings.Index(period, "..")
+			if separator < 0 {
+				continue
+			}
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location())
+			if separator > 0 {
+				t, err := time.Parse(dtTimeFormat, period[0:separator])
+				if err != nil {
+					continue
+				}
+				start = time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+			}
+			if start.After(now) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// exhaustion returns when a limit runs out, for a balance that grows rate times faster than the time,
+// or the zero time if it doesn't run out today. The limit runs out when the balance exceeds it.
+func exhaustion(now time.Time, balance time.Duration, limit time.Duration, rate int) time.Time {
+	if rate <= 0 || balance > limit {
+		return time.Time{}
+	}
+	t := now.Add((limit-balance)/time.Duration(rate) + time.Second)
+
+	// balance starts from zero the next day
+	if toText(t) != toText(now) {
+		return time.Time{}
+	}
+	return t
+}
+
+// earliest returns the earliest of the non-zero times a and b, or the zero time if both are zero
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// latest returns the latest of the times a and b
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// predictBlocking sets BlockedAt of the groups pgbs (as evaluated by evaluateGroups) that are not blocked,
+// to when their own limit or downtime, or those of a parent group, are predicted to apply.
+// The balance of a group grows with the number of its running processes (and of its child groups), except those in idle,
+// unless the group counts idle time (see ProcessGroupDayLimit.CountIdle), and those of the group in low (see lowCPU).
+// predictBlocking returns the earliest instant after now when the enforcement of any group, or process of a group, changes:
+// a downtime starts, a limit runs out, a grant expires, a manual block or the lockdown ends, or the zero time if none is expected.
+// Groups that are blocked manually are blocked regardless of grants (see evaluateGroups).
+// During a vacation nothing is predicted to be blocked, and enforcement changes when the vacation ends.
+func predictBlocking(groups []ProcessGroupDayLimit, pgbs []ProcessGroupDayBalance, db dayBalance, running []processInfo, idle map[int]bool, low map[string]map[int]bool, ov overrides, now time.Time) time.Time {
+	if ov.vacation.After(now) {
+		return ov.vacation
+	}
+
+	date := toText(now)
+	weekDay := weekDays[now.Weekday()]
+
+	index := make(map[string]int, len(groups))
+	for i, g := range groups {
+		index[g.GroupID()] = i
+	}
+
+	var next time.Time
+
+	// the number of the running processes of each group (including the child groups), and of each process of the group
+	rates := make([]int, len(groups))
+	for i, g := range groups {
+		procRates := make(map[string]int)
+		for _, p := range running {
+			if g.includes(p.user) && (g.CountIdle || !idle[p.pid]) && !low[g.GroupID()][p.pid] && slices.Contains(g.PG, p.name) {
+				procRates[p.name]++
+			}
+		}
+
+		own := 0
+		for _, n := range procRates {
+			own = own + n
+		}
+		visited := make(map[int]bool)
+		for j, ok := i, true; ok && !visited[j]; j, ok = index[groups[j].Parent] {
+			visited[j] = true
+			rates[j] = rates[j] + own
+		}
+
+		// processes with their own limits or downtime
+		if !g.isEnabled() {
+			continue
+		}
+		for _, p := range g.PG {
+			pl, ok := g.PL[p]
+			if !ok {
+				continue
+			}
+			next = earliest(next, nextDowntime(now, pl.DT))
+			if l, defined := evalDayLimit(date, weekDay, pl.DL); defined {
+				next = earliest(next, exhaustion(now, g.processBalance(p, db), l, procRates[p]))
+			}
+		}
+	}
+
+	// when the own limit or downtime of each group applies, regardless of grants
+	own := make([]time.Time, len(groups))
+	for i, g := range groups {
+		pgb := pgbs[i]
+		if !g.isEnabled() {
+			continue
+		}
+		if pgb.Overtime || pgb.Blocked || pgb.BlockedUntil != nil {
+			own[i] = now
+			continue
+		}
+		own[i] = nextDowntime(now, g.DT)
+		if pgb.LimitDefined {
+			own[i] = earliest(own[i], exhaustion(now, pgb.Balance.Duration, pgb.Limit.Duration, rates[i]))
+		}
+	}
+
+	// the group is blocked when the group itself, or a parent group, is blocked, and no group in between has a grant
+	for i := range groups {
+		var blockedAt, grantedUntil time.Time
+		visited := make(map[int]bool)
+		for j, ok := i, true; ok && !visited[j]; j, ok = index[groups[j].Parent] {
+			visited[j] = true
+			grantedUntil = latest(grantedUntil, ov.grants[groups[j].GroupID()])
+			if !own[j].IsZero() {
+				blockedAt = earliest(blockedAt, latest(own[j], grantedUntil))
+			}
+		}
+		if pgbs[i].BlockedBy == "" && blockedAt.After(now) {
+			t := blockedAt
+			pgbs[i].BlockedAt = &t
+			next = earliest(next, t)
+		}
+	}
+
+	for _, e := range ov.grants {
+		if e.After(now) {
+			next = earliest(next, e)
+		}
+	}
+	for _, e := range ov.blocks {
+		if e.After(now) {
+			next = earliest(next, e)
+		}
+	}
+	if ov.lockdown.After(now) {
+		next = earliest(next, ov.lockdown)
+	}
+
+	return next
+}
+
+// force forces a process check, unless one is already pending
+func (ph *ProcessHunter) force() {
+	select {
+	case ph.forceCheck <- struct{}{}:
+	default:
+	}
+}
+
+// wakeAt schedules a process check at t, if t is before the next regular check.
+// It replaces the previously scheduled check. ph.balanceRWM must be locked by the caller.
+func (ph *ProcessHunter) wakeAt(t time.Time) {
+	if ph.wakeup != nil {
+		ph.wakeup.Stop()
+		ph.wakeup = nil
+	}
+
+	d := time.Until(t)
+	if t.IsZero() || d >= ph.checkPeriod {
+		return
+	}
+	ph.wakeup = time.AfterFunc(max(d, time.Second), ph.force)
+}
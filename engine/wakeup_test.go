@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextDowntime(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local) // wednesday
+	at := func(s string) time.Time {
+		tm, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return tm
+	}
+
+	tests := []struct {
+		dnt      Downtime
+		expected time.Time
+	}{
+		{Downtime{"*": {"21:00..", "13:30..14:00"}}, at("2024-01-10 13:30")},
+		{Downtime{"*": {"..07:00", "11:00..13:00"}}, at("2024-01-11 00:00")},
+		{Downtime{"*": {"..07:00"}, "thu": {"09:00..10:00"}}, at("2024-01-11 09:00")},
+		{Downtime{"mon": {"21:00.."}}, time.Time{}},
+		{nil, time.Time{}},
+	}
+	for _, tc := range tests {
+		if n := nextDowntime(now, tc.dnt); !n.Equal(tc.expected) {
+			t.Error("next downtime of", tc.dnt, "is", n, "expected", tc.expected)
+		}
+	}
+}
+
+func TestPredictBlocking(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{
+		{ID: "screen", DL: DayLimits{"*": time.Hour * 2}},
+		{ID: "games", Parent: "screen", PG: []string{"game"}, DT: Downtime{"*": {"21:00.."}}},
+		{ID: "video", Parent: "screen", PG: []string{"player"}, DL: DayLimits{"*": time.Hour}},
+		{ID: "music", PG: []string{"radio"}, DT: Downtime{"*": {"11:00..13:00"}}},
+	}
+	tb := TimeBalance{"game": time.Minute * 30, "player": time.Minute * 30}
+	running := []processInfo{
+		{pid: 1, name: "game"},
+		{pid: 2, name: "game"},
+		{pid: 3, name: "player"},
+		{pid: 4, name: "player"},
+	}
+	grants := map[string]time.Time{"music": now.Add(time.Minute * 10)}
+
+	pgbs := evaluateGroups(groups, dayBalance{active: tb}, overrides{grants: grants}, now)
+	next := predictBlocking(groups, pgbs, dayBalance{active: tb}, running, map[int]bool{4: true}, nil, overrides{grants: grants}, now)
+
+	// screen: 1h left, growing 3 times faster (player 4 is idle) - blocked in 20 minutes
+	// video: 30 minutes left, growing with a single player - blocked in 30 minutes, but screen is blocked earlier
+	expected := []time.Time{
+		now.Add(time.Minute*20 + time.Second),
+		now.Add(time.Minute*20 + time.Second),
+		now.Add(time.Minute*20 + time.Second),
+		now.Add(time.Minute * 10),
+	}
+	for i, e := range expected {
+		if pgbs[i].BlockedAt == nil || !pgbs[i].BlockedAt.Equal(e) {
+			t.Error("group", pgbs[i].ID, "blocked at", pgbs[i].BlockedAt, "expected", e)
+		}
+	}
+	if !next.Equal(now.Add(time.Minute * 10)) {
+		t.Error("next check at", next, "expected the grant expiry", now.Add(time.Minute*10))
+	}
+}
+
+func TestPredictBlockingEnd(t *testing.T) {
+	now, _ := time.ParseInLocation("2006-01-02 15:04", "2024-01-10 12:00", time.Local)
+
+	groups := []ProcessGroupDayLimit{{ID: "games", PG: []string{"game"}}}
+	blocks := map[string]time.Time{"games": now.Add(time.Minute * 30)}
+	lockdown := now.Add(time.Minute * 20)
+
+	tests := []struct {
+		ov       overrides
+		expected time.Time
+	}{
+		{overrides{blocks: blocks}, now.Add(time.Minute * 30)},
+		{overrides{lockdown: lockdown}, lockdown},
+		{overrides{blocks: blocks, lockdown: lockdown}, lockdown},
+		{overrides{blocks: map[string]time.Time{"games": now.Add(-time.Minute)}}, time.Time{}},
+	}
+	for _, tc := range tests {
+		pgbs := evaluateGroups(groups, dayBalance{}, tc.ov, now)
+		if next := predictBlocking(groups, pgbs, dayBalance{}, nil, nil, nil, tc.ov, now); !next.Equal(tc.expected) {
+			t.Error("next check at", next, "expected the end of the block", tc.expected, tc.ov)
+		}
+	}
+}
+
+func TestWakeAt(t *testing.T) {
+	ph := NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+
+	ph.wakeAt(time.Now().Add(time.Hour * 2))
+	if ph.wakeup != nil {
+		t.Error("scheduled a check after the next regular check")
+	}
+
+	ph.wakeAt(time.Now().Add(time.Millisecond * 100))
+	select {
+	case <-ph.forceCheck:
+	case <-time.After(time.Second * 3):
+		t.Error("the scheduled check wasn't forced")
+	}
+}
@@ -0,0 +1,359 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	webhookMaxAttempts = 10               // how many times the delivery of an event is attempted
+	webhookBackoff     = 5 * time.Second  // the delay before the first retry; it doubles with each attempt
+	webhookMaxBackoff  = time.Hour        // the longest delay between two attempts
+	webhookPeriod      = time.Second      // how often the outbox is checked for due deliveries
+	webhookTimeout     = 10 * time.Second // the timeout of a single delivery attempt
+	outboxFile         = "outbox.json"    // the file of the outbox, in the directory of the balance file
+)
+
+// Webhook is an HTTP endpoint that receives events (see Event) as JSON, with POST requests
+type Webhook struct {
+	URL    string   `json:"url"`              // URL is the URL of the endpoint
+	Events []string `json:"events,omitempty"` // Events lists the types of events to send (all if empty)
+	// Secret signs the requests: the X-PH-Signature header is "sha256=" followed by the hex encoded HMAC-SHA256 of the body
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookStatus describes the deliveries to a webhook
+type WebhookStatus struct {
+	URL          string    `json:"url"`                     // URL is the URL of the webhook
+	Delivered    int       `json:"delivered"`               // Delivered is the number of events delivered since ph started
+	Failed       int       `json:"failed"`                  // Failed is the number of events dropped after the last attempt failed
+	Pending      int       `json:"pending"`                 // Pending is the number of events in the outbox
+	LastDelivery time.Time `json:"last_delivery,omitempty"` // LastDelivery is when an event was last delivered
+	LastError    string    `json:"last_error,omitempty"`    // LastError describes the last failed attempt
+}
+
+// delivery is an event in the outbox, to be delivered to a webhook
+type delivery struct {
+	ID       int64     `json:"id"` // identifies the delivery, as the same event may be in the outbox twice
+	URL      string    `json:"url"`
+	Event    Event     `json:"event"`
+	Attempts int       `json:"attempts"`
+	Next     time.Time `json:"next"`
+}
+
+// webhooks sends the events to the webhooks
+type webhooks struct {
+	mu     sync.Mutex
+	hooks  []Webhook                 // the configured webhooks
+	outbox []delivery                // events to be delivered
+	lastID int64                     // the ID of the last delivery added to the outbox
+	status map[string]*WebhookStatus // deliveries by URL
+	path   string                    // where the outbox is saved; not saved if empty
+	client *http.Client
+	wakeup chan struct{} // signals that new events are in the outbox
+}
+
+// newWebhooks returns webhooks that save the outbox in path, with the outbox saved by a previous run, if any
+func newWebhooks(path string) *webhooks {
+	wh := &webhooks{
+		status: make(map[string]*WebhookStatus),
+		path:   path,
+		client: &http.Client{},
+		wakeup: make(chan struct{}, 1),
+	}
+	if err := wh.load(); err != nil {
+		log.Println("error loading outbox from", path, ":", err)
+	}
+	return wh
+}
+
+// outboxPath returns the path of the outbox file of the balance file balancePath, or "" if there is no balance file
+func outboxPath(balancePath string) string {
+	if balancePath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(balancePath), outboxFile)
+}
+
+// set sets the configured webhooks
+func (wh *webhooks) set(hooks []Webhook) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.hooks = hooks
+}
+
+// matches returns whether h receives events of type t
+func (h Webhook) matches(t string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, t)
+}
+
+// enqueue adds e to the outbox of each webhook that receives it
+func (wh *webhooks) enqueue(e Event) {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	added := false
+	for _, h := range wh.hooks {
+		if h.matches(e.Type) {
+			wh.lastID++
+			wh.outbox = append(wh.outbox, delivery{ID: wh.lastID, URL: h.URL, Event: e, Next: e.Time})
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	wh.save()
+	select {
+	case wh.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// save saves the outbox. wh.mu must be locked by the caller.
+func (wh *webhooks) save() {
+	if wh.path == "" {
+		return
+	}
+	b, err := json.MarshalIndent(wh.outbox, "", "\t")
+	if err == nil {
+		err = os.WriteFile(wh.path, b, 0600)
+	}
+	if err != nil {
+		log.Println("error saving outbox to", wh.path, ":", err)
+	}
+}
+
+// load replaces the outbox with the one saved by a previous run, numbering the deliveries anew
+func (wh *webhooks) load() error {
+	if wh.path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(wh.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var saved []delivery
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return err
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	wh.outbox = saved
+	for i := range wh.outbox {
+		wh.outbox[i].ID = int64(i + 1)
+	}
+	wh.lastID = int64(len(wh.outbox))
+	return nil
+}
+
+// backoff returns the delay after a failed attempt, when attempts were made
+func backoff(attempts int) time.Duration {
+	d := webhookBackoff
+	for i := 1; i < attempts && d < webhookMaxBackoff; i++ {
+		d = d * 2
+	}
+	return min(d, webhookMaxBackoff)
+}
+
+// deliver attempts to deliver the events in the outbox that are due at now. It is not safe for concurrent use.
+// The webhooks are posted to concurrently, each attempt with a timeout (see webhookTimeout), and the events of a webhook in order,
+// until an attempt fails. The events that fail are retried later (see backoff), and dropped after webhookMaxAttempts attempts.
+// The later events of a webhook wait for the retry of its failed event, so that they are delivered in order.
+func (wh *webhooks) deliver(ctx context.Context, now time.Time) {
+	wh.mu.Lock()
+	var due []delivery
+	hooks := make(map[string]Webhook)
+	for _, h := range wh.hooks {
+		hooks[h.URL] = h
+	}
+	for _, d := range wh.outbox {
+		if !d.Next.After(now) {
+			due = append(due, d)
+		}
+	}
+	wh.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	byURL := make(map[string][]int) // the due deliveries of each webhook, by index in due
+	for i, d := range due {
+		byURL[d.URL] = append(byURL[d.URL], i)
+	}
+
+	// deliver without holding the lock, so that events can be added meanwhile
+	errs := make([]error, len(due))
+	attempted := make([]bool, len(due))
+	var dwg sync.WaitGroup
+	for url, indices := range byURL {
+		dwg.Add(1)
+		go func() {
+			defer dwg.Done()
+
+			h, ok := hooks[url]
+			for _, i := range indices {
+				attempted[i] = true
+				if !ok {
+					errs[i] = errors.New("webhook is no longer configured")
+					continue
+				}
+				actx, cancel := context.WithTimeout(ctx, webhookTimeout)
+				errs[i] = wh.post(actx, h, due[i].Event)
+				cancel()
+				if errs[i] != nil {
+					return
+				}
+			}
+		}()
+	}
+	dwg.Wait()
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	retries := make(map[string]time.Time) // the retry of the failed event of each webhook, by URL
+	for i, d := range due {
+		if !attempted[i] {
+			continue
+		}
+		j := slices.IndexFunc(wh.outbox, func(o delivery) bool { return o.ID == d.ID })
+		if j < 0 {
+			continue
+		}
+		st, ok := wh.status[d.URL]
+		if !ok {
+			st = &WebhookStatus{URL: d.URL}
+			wh.status[d.URL] = st
+		}
+
+		if errs[i] == nil {
+			st.Delivered++
+			st.LastDelivery = time.Now()
+			wh.outbox = slices.Delete(wh.outbox, j, j+1)
+			continue
+		}
+
+		st.LastError = errs[i].Error()
+		log.Println("error delivering", d.Event.Type, "event to", d.URL, ":", errs[i])
+		o := &wh.outbox[j]
+		o.Attempts++
+		if _, ok := hooks[d.URL]; !ok || o.Attempts >= webhookMaxAttempts {
+			st.Failed++
+			wh.outbox = slices.Delete(wh.outbox, j, j+1)
+			continue
+		}
+		o.Next = now.Add(backoff(o.Attempts))
+		retries[d.URL] = o.Next
+	}
+
+	for i := range wh.outbox {
+		o := &wh.outbox[i]
+		if next, ok := retries[o.URL]; ok && o.Next.Before(next) {
+			o.Next = next
+		}
+	}
+	wh.save()
+}
+
+// post sends e to h
+func (wh *webhooks) post(ctx context.Context, h Webhook, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-PH-Event", e.Type)
+	if h.Secret != "" {
+		req.Header.Set("X-PH-Signature", sign(h.Secret, body))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// sign returns the signature of body with secret: "sha256=" followed by the hex encoded HMAC-SHA256
+func sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// statuses returns the delivery status of the configured webhooks
+func (wh *webhooks) statuses() []WebhookStatus {
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+
+	sts := []WebhookStatus{}
+	for _, h := range wh.hooks {
+		st := WebhookStatus{URL: h.URL}
+		if s, ok := wh.status[h.URL]; ok {
+			st = *s
+		}
+		for _, d := range wh.outbox {
+			if d.URL == h.URL {
+				st.Pending++
+			}
+		}
+		sts = append(sts, st)
+	}
+	return sts
+}
+
+// run delivers the events in the outbox, when they are added and when they are due, until ctx is cancelled
+func (wh *webhooks) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(webhookPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-wh.wakeup:
+		case <-ticker.C:
+		}
+		wh.deliver(ctx, time.Now())
+	}
+}
+
+// GetWebhooks returns the delivery status of the configured webhooks
+func (ph *ProcessHunter) GetWebhooks() []WebhookStatus {
+	return ph.webhooks.statuses()
+}
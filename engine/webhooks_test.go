@@ -0,0 +1,211 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("X-PH-Signature") != sign("s3cr3t", body) {
+			t.Error("bad signature", r.Header.Get("X-PH-Signature"))
+		}
+		if fail {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		var e Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error("cannot unmarshal event", err)
+		}
+		received = append(received, e)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), outboxFile)
+	wh := newWebhooks(path)
+	wh.set([]Webhook{{URL: srv.URL, Events: []string{EventKill}, Secret: "s3cr3t"}})
+
+	now := time.Now()
+	wh.enqueue(Event{Time: now, Type: EventKill, Process: "game", PID: 10})
+	wh.enqueue(Event{Time: now, Type: EventRespawn, Process: "game", PID: 11})
+
+	wh.deliver(context.Background(), now)
+	st := wh.statuses()
+	if len(st) != 1 || st[0].Pending != 1 || st[0].Delivered != 0 || st[0].LastError == "" {
+		t.Error("unexpected status after a failed delivery", st)
+	}
+
+	// the outbox survives a restart
+	wh = newWebhooks(path)
+	wh.set([]Webhook{{URL: srv.URL, Secret: "s3cr3t"}})
+	if st := wh.statuses(); st[0].Pending != 1 {
+		t.Error("unexpected outbox after a restart", st)
+	}
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+
+	// not due before the backoff
+	wh.deliver(context.Background(), now.Add(time.Second))
+	if st := wh.statuses(); st[0].Pending != 1 {
+		t.Error("delivered before the backoff", st)
+	}
+
+	wh.deliver(context.Background(), now.Add(backoff(1)))
+	st = wh.statuses()
+	if st[0].Pending != 0 || st[0].Delivered != 1 {
+		t.Error("unexpected status after delivery", st)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0].PID != 10 {
+		t.Error("unexpected events received", received)
+	}
+}
+
+func TestWebhooksOutboxLoadedOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), outboxFile)
+	hooks := []Webhook{{URL: "http://localhost:1/ph"}}
+	now := time.Now()
+
+	wh := newWebhooks(path)
+	wh.set(hooks)
+	wh.enqueue(Event{Time: now.Add(time.Hour), Type: EventKill, PID: 1})
+
+	// the events enqueued after a restart are saved with the pending ones, and are not duplicated
+	wh = newWebhooks(path)
+	wh.set(hooks)
+	wh.enqueue(Event{Time: now.Add(time.Hour), Type: EventKill, PID: 2})
+	wh = newWebhooks(path)
+	wh.set(hooks)
+	if st := wh.statuses(); st[0].Pending != 2 {
+		t.Error("unexpected outbox after restarts", st)
+	}
+}
+
+func TestWebhooksPerEndpoint(t *testing.T) {
+	var mu sync.Mutex
+	failed := 0
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		failed++
+		mu.Unlock()
+		http.Error(w, "try later", http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	wh := newWebhooks("")
+	wh.set([]Webhook{{URL: bad.URL}, {URL: good.URL}})
+
+	now := time.Now()
+	wh.enqueue(Event{Time: now, Type: EventKill, PID: 1})
+	wh.enqueue(Event{Time: now, Type: EventKill, PID: 2})
+	wh.deliver(context.Background(), now)
+
+	// the failing webhook is attempted once, and doesn't hold back the other one
+	st := wh.statuses()
+	if st[0].Pending != 2 || st[1].Pending != 0 || st[1].Delivered != 2 {
+		t.Error("unexpected status", st)
+	}
+
+	// the later events wait for the retry of the failed one, which is attempted first
+	attempts := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return failed
+	}
+	wh.deliver(context.Background(), now.Add(time.Second))
+	if n := attempts(); n != 1 {
+		t.Error("unexpected attempts of the failing webhook before the backoff", n)
+	}
+	wh.deliver(context.Background(), now.Add(backoff(1)))
+	if n := attempts(); n != 2 {
+		t.Error("unexpected attempts of the failing webhook after the backoff", n)
+	}
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	if o := wh.outbox; len(o) != 2 || o[0].Event.PID != 1 || o[0].Attempts != 2 || o[1].Attempts != 0 || !o[1].Next.Equal(o[0].Next) {
+		t.Error("unexpected outbox", o)
+	}
+}
+
+func TestWebhooksSameEvent(t *testing.T) {
+	var mu sync.Mutex
+	received := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received++
+	}))
+	defer srv.Close()
+
+	wh := newWebhooks("")
+	wh.set([]Webhook{{URL: srv.URL}})
+
+	// the same event, enqueued twice, is delivered twice
+	e := Event{Time: time.Now(), Type: EventKill, PID: 1}
+	wh.enqueue(e)
+	wh.enqueue(e)
+	wh.deliver(context.Background(), e.Time)
+
+	if st := wh.statuses(); st[0].Pending != 0 || st[0].Delivered != 2 {
+		t.Error("unexpected status", st)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 2 {
+		t.Error("unexpected deliveries", received)
+	}
+}
+
+func TestWebhooksDrop(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	}))
+	defer srv.Close()
+
+	wh := newWebhooks("")
+	wh.set([]Webhook{{URL: srv.URL}})
+
+	now := time.Now()
+	wh.enqueue(Event{Time: now, Type: EventKill})
+	for i := 0; i < webhookMaxAttempts; i++ {
+		wh.deliver(context.Background(), now.Add(time.Hour*time.Duration(i)))
+	}
+	if st := wh.statuses(); st[0].Pending != 0 || st[0].Failed != 1 {
+		t.Error("event was not dropped after the last attempt", st)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if backoff(1) != webhookBackoff || backoff(2) != webhookBackoff*2 || backoff(100) != webhookMaxBackoff {
+		t.Error("unexpected backoff", backoff(1), backoff(2), backoff(100))
+	}
+}
+
+func TestParseConfigWebhooks(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"groups": [], "webhooks": [{"url": "https://example.com/ph", "events": ["kill"]}]}`)); err != nil {
+		t.Error("rejected webhook", err)
+	}
+	if _, err := parseConfig([]byte(`{"groups": [], "webhooks": [{"url": "example.com"}]}`)); err == nil {
+		t.Error("accepted a webhook without scheme")
+	}
+}
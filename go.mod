@@ -4,5 +4,7 @@ go 1.22.5
 
 require (
 	github.com/mitchellh/go-ps v0.0.0-20190716172923-621e5597135b
-	golang.org/x/sys v0.1.0
+	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0
+	golang.org/x/term v0.27.0
 )
@@ -0,0 +1,349 @@
+// Package mqtt publishes the balance of the process groups to an MQTT broker, with Home Assistant discovery,
+// and, if enabled, grants time to, blocks and unblocks the groups as commanded over MQTT
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ventsip/ph/engine"
+)
+
+const (
+	keepAlive       = time.Minute      // the keep alive interval of the connection
+	publishPeriod   = 5 * time.Second  // how often the state of the groups is checked for changes
+	configPeriod    = 10 * time.Second // how often the configuration is checked when MQTT is not configured
+	maxReconnect    = time.Minute      // the longest delay before reconnecting
+	defaultTopic    = "ph"
+	defaultDiscover = "homeassistant"
+)
+
+// errConfigChanged is returned when the MQTT configuration changes, and ph reconnects
+var errConfigChanged = errors.New("MQTT configuration changed")
+
+// groupState is the state of a group, published to the state topic of the group
+type groupState struct {
+	engine.ProcessGroupDayBalance
+	Enforced         bool   `json:"enforced"`          // Enforced indicates whether the processes of the group are terminated
+	ManualBlock      bool   `json:"manual_block"`      // ManualBlock indicates whether the group is blocked manually
+	Remaining        string `json:"remaining"`         // Remaining is the time left today (see ProcessGroupDayBalance.Limit)
+	BalanceMinutes   int    `json:"balance_minutes"`   // BalanceMinutes is the balance, in minutes
+	LimitMinutes     int    `json:"limit_minutes"`     // LimitMinutes is the limit, in minutes
+	RemainingMinutes int    `json:"remaining_minutes"` // RemainingMinutes is the time left, in minutes
+}
+
+// newGroupState returns the state of the group pgb
+func newGroupState(pgb engine.ProcessGroupDayBalance) groupState {
+	remaining := time.Duration(0)
+	if pgb.BlockedBy == "" && pgb.LimitDefined && pgb.Limit.Duration > pgb.Balance.Duration {
+		remaining = pgb.Limit.Duration - pgb.Balance.Duration
+	}
+	return groupState{
+		ProcessGroupDayBalance: pgb,
+		Enforced:               pgb.BlockedBy != "",
+		ManualBlock:            pgb.BlockedUntil != nil,
+		Remaining:              remaining.String(),
+		BalanceMinutes:         int(pgb.Balance.Minutes()),
+		LimitMinutes:           int(pgb.Limit.Minutes()),
+		RemainingMinutes:       int(remaining.Minutes()),
+	}
+}
+
+// topics are the topics of a configuration
+type topics struct {
+	prefix    string // prefix of the state and command topics
+	discovery string // prefix of the Home Assistant discovery topics
+	commands  bool   // whether the commands are enabled
+}
+
+// newTopics returns the topics of the configuration m
+func newTopics(m engine.MQTT) topics {
+	t := topics{prefix: m.Topic, discovery: m.Discovery, commands: m.Commands}
+	if t.prefix == "" {
+		t.prefix = defaultTopic
+	}
+	if t.discovery == "" {
+		t.discovery = defaultDiscover
+	}
+	return t
+}
+
+func (t topics) availability() string      { return t.prefix + "/status" }
+func (t topics) state(group string) string { return t.prefix + "/" + group + "/state" }
+func (t topics) grant(group string) string { return t.prefix + "/" + group + "/grant/set" }
+func (t topics) block(group string) string { return t.prefix + "/" + group + "/block/set" }
+
+// discoveryMessages returns the Home Assistant discovery messages of the group pgb:
+// sensors of the remaining time and of the balance, a binary sensor of enforcement,
+// and, if the commands are enabled, a switch that blocks the group, and a number that grants time to the group (in minutes).
+// When the commands are disabled, the messages of the switch and of the number are empty, which removes them.
+func (t topics) discoveryMessages(pgb engine.ProcessGroupDayBalance) []message {
+	name := pgb.Name
+	if name == "" {
+		name = pgb.ID
+	}
+	object := "ph_" + strings.NewReplacer(".", "_", "-", "_").Replace(pgb.ID)
+	device := map[string]any{"identifiers": []string{t.prefix}, "name": "Process Hunter"}
+
+	entities := []struct {
+		component string
+		suffix    string
+		config    map[string]any
+	}{
+		{"sensor", "remaining", map[string]any{"name": name + " remaining", "unit_of_measurement": "min", "value_template": "{{ value_json.remaining_minutes }}"}},
+		{"sensor", "balance", map[string]any{"name": name + " balance", "unit_of_measurement": "min", "value_template": "{{ value_json.balance_minutes }}"}},
+		{"binary_sensor", "blocked", map[string]any{"name": name + " blocked", "value_template": "{{ 'ON' if value_json.enforced else 'OFF' }}"}},
+		{"switch", "block", map[string]any{"name": name + " block", "command_topic": t.block(pgb.ID), "value_template": "{{ 'ON' if value_json.manual_block else 'OFF' }}"}},
+		{"number", "grant", map[string]any{"name": name + " grant", "command_topic": t.grant(pgb.ID), "unit_of_measurement": "min", "min": 0, "max": 240, "step": 5, "mode": "box"}},
+	}
+
+	var msgs []message
+	for _, e := range entities {
+		topic := t.discovery + "/" + e.component + "/" + object + "_" + e.suffix + "/config"
+		if _, ok := e.config["command_topic"]; ok && !t.commands {
+			msgs = append(msgs, message{topic: topic, retain: true})
+			continue
+		}
+
+		c := e.config
+		c["unique_id"] = object + "_" + e.suffix
+		c["availability_topic"] = t.availability()
+		c["device"] = device
+		if e.component != "number" {
+			c["state_topic"] = t.state(pgb.ID)
+		}
+		b, _ := json.Marshal(c)
+		msgs = append(msgs, message{topic: topic, payload: b, retain: true})
+	}
+	return msgs
+}
+
+// parseGrant parses the payload of a grant command: a duration (e.g. "30m"), or a number of minutes
+func parseGrant(payload string) (time.Duration, error) {
+	payload = strings.TrimSpace(payload)
+	if m, err := strconv.ParseFloat(payload, 64); err == nil {
+		return time.Duration(m * float64(time.Minute)), nil
+	}
+	return time.ParseDuration(payload)
+}
+
+// command runs the command m (a grant, block or unblock of a group), and returns whether m is a command.
+// Nothing is a command when the commands are disabled.
+func command(ph *engine.ProcessHunter, t topics, m message, now time.Time) (bool, error) {
+	rest, ok := strings.CutPrefix(m.topic, t.prefix+"/")
+	if !ok || !t.commands {
+		return false, nil
+	}
+	group, cmd, ok := strings.Cut(rest, "/")
+	if !ok {
+		return false, nil
+	}
+	payload := strings.TrimSpace(string(m.payload))
+
+	switch cmd {
+	case "grant/set":
+		d, err := parseGrant(payload)
+		if err != nil {
+			return true, err
+		}
+		_, err = ph.AddGrant(group, d, "MQTT")
+		return true, err
+	case "block/set":
+		switch strings.ToUpper(payload) {
+		case "OFF":
+			return true, ph.Unblock(group)
+		case "ON":
+			// until the end of the day
+			y, mo, d := now.Date()
+			return true, ph.Block(group, time.Date(y, mo, d+1, 0, 0, 0, 0, now.Location()))
+		}
+		d, err := time.ParseDuration(payload)
+		if err != nil {
+			return true, err
+		}
+		return true, ph.Block(group, now.Add(d))
+	}
+	return false, nil
+}
+
+// Run connects to the MQTT broker configured in ph (see engine.Settings.MQTT), publishes the state of the groups,
+// and runs the commands it receives, until ctx is cancelled. It reconnects when the connection fails,
+// or when the configuration changes.
+func Run(ctx context.Context, wg *sync.WaitGroup, ph *engine.ProcessHunter) {
+	defer func() {
+		if wg != nil {
+			wg.Done()
+		}
+	}()
+
+	delay := time.Second
+	for {
+		var wait time.Duration
+		if m := ph.GetConfig().MQTT; m == nil {
+			wait = configPeriod
+		} else {
+			err := session(ctx, ph, *m)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case errors.Is(err, errConfigChanged):
+				delay = time.Second
+				continue
+			case err != nil:
+				log.Println("MQTT error:", err)
+				wait = delay
+				delay = min(delay*2, maxReconnect)
+			default:
+				delay = time.Second
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// session connects to the broker of m and publishes the state of the groups, until ctx is cancelled,
+// the connection fails or the configuration changes
+func session(ctx context.Context, ph *engine.ProcessHunter, m engine.MQTT) error {
+	t := newTopics(m)
+	clientID := m.ClientID
+	if clientID == "" {
+		clientID = defaultTopic
+	}
+
+	mc, err := dial(m.Broker, connectOptions{
+		clientID:  clientID,
+		username:  m.Username,
+		password:  m.Password,
+		keepAlive: keepAlive,
+		will:      &message{topic: t.availability(), payload: []byte("offline"), retain: true},
+	})
+	if err != nil {
+		return err
+	}
+	log.Println("connected to MQTT broker", m.Broker)
+
+	done := make(chan struct{})
+	defer close(done)
+	msgs := make(chan message)
+	pongs := make(chan struct{}, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- mc.read(msgs, pongs, done)
+	}()
+
+	if t.commands {
+		if err := mc.subscribe(1, t.prefix+"/+/grant/set", t.prefix+"/+/block/set"); err != nil {
+			mc.c.Close()
+			return err
+		}
+	}
+	if err := mc.publish(message{topic: t.availability(), payload: []byte("online"), retain: true}); err != nil {
+		mc.c.Close()
+		return err
+	}
+
+	published := make(map[string]groupState)
+	discovered := make(map[string][]string) // the discovery topics of the groups, by group ID
+	publish := func() error {
+		pgbs := ph.GetLatestPGroupsBalance()
+		for _, pgb := range pgbs {
+			if _, ok := discovered[pgb.ID]; !ok {
+				var topics []string
+				for _, d := range t.discoveryMessages(pgb) {
+					if err := mc.publish(d); err != nil {
+						return err
+					}
+					topics = append(topics, d.topic)
+				}
+				discovered[pgb.ID] = topics
+			}
+
+			st := newGroupState(pgb)
+			if prev, ok := published[pgb.ID]; ok && reflect.DeepEqual(prev, st) {
+				continue
+			}
+			b, _ := json.Marshal(st)
+			if err := mc.publish(message{topic: t.state(pgb.ID), payload: b, retain: true}); err != nil {
+				return err
+			}
+			published[pgb.ID] = st
+		}
+
+		// the retained messages of the deleted groups are cleared, which removes them from Home Assistant
+		for id, topics := range discovered {
+			if slices.ContainsFunc(pgbs, func(pgb engine.ProcessGroupDayBalance) bool { return pgb.ID == id }) {
+				continue
+			}
+			for _, topic := range append(topics, t.state(id)) {
+				if err := mc.publish(message{topic: topic, retain: true}); err != nil {
+					return err
+				}
+			}
+			delete(discovered, id)
+			delete(published, id)
+		}
+		return nil
+	}
+	if err := publish(); err != nil {
+		mc.c.Close()
+		return err
+	}
+
+	ticker := time.NewTicker(publishPeriod)
+	defer ticker.Stop()
+	pinger := time.NewTicker(keepAlive / 2)
+	defer pinger.Stop()
+	var pong <-chan time.Time // expires when the broker doesn't respond to a ping within keepAlive
+
+	for {
+		select {
+		case <-ctx.Done():
+			mc.publish(message{topic: t.availability(), payload: []byte("offline"), retain: true})
+			return mc.disconnect()
+		case err := <-errc:
+			mc.c.Close()
+			return err
+		case msg := <-msgs:
+			if ok, err := command(ph, t, msg, time.Now()); ok && err != nil {
+				log.Println("MQTT command", msg.topic, string(msg.payload), "failed:", err)
+			}
+		case <-pinger.C:
+			if pong != nil {
+				continue // the previous ping is not answered yet
+			}
+			if err := mc.ping(); err != nil {
+				mc.c.Close()
+				return err
+			}
+			pong = time.After(keepAlive)
+		case <-pongs:
+			pong = nil
+		case <-pong:
+			mc.c.Close()
+			return errors.New("no response to ping from the MQTT broker")
+		case <-ticker.C:
+			if c := ph.GetConfig().MQTT; c == nil || *c != m {
+				mc.publish(message{topic: t.availability(), payload: []byte("offline"), retain: true})
+				mc.disconnect()
+				return errConfigChanged
+			}
+			if err := publish(); err != nil {
+				mc.c.Close()
+				return err
+			}
+		}
+	}
+}
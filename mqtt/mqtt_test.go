@@ -0,0 +1,237 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ventsip/ph/engine"
+)
+
+// fakeBroker is a minimal MQTT broker that accepts any connection, and records the published messages
+type fakeBroker struct {
+	l         net.Listener
+	mu        sync.Mutex
+	conn      *conn
+	published chan message
+	connects  chan string // client IDs
+	closed    chan struct{}
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("cannot listen", err)
+	}
+	b := &fakeBroker{l: l, published: make(chan message, 100), connects: make(chan string, 10), closed: make(chan struct{}, 10)}
+	go b.accept()
+	return b
+}
+
+func (b *fakeBroker) accept() {
+	for {
+		c, err := b.l.Accept()
+		if err != nil {
+			return
+		}
+		mc := &conn{c: c, r: bufio.NewReader(c)}
+		b.mu.Lock()
+		b.conn = mc
+		b.mu.Unlock()
+		go b.serve(mc)
+	}
+}
+
+func (b *fakeBroker) serve(mc *conn) {
+	defer mc.c.Close()
+	for {
+		t, flags, body, err := readPacket(mc.r)
+		if err != nil {
+			return
+		}
+		switch t {
+		case typeConnect:
+			// protocol name, level, flags and keep alive precede the client ID
+			id, _, _ := readString(body[10:])
+			b.connects <- id
+			mc.write(packet(typeConnAck, 0, []byte{0, 0}))
+		case typePublish:
+			m, _ := parsePublish(flags, body)
+			b.published <- m
+		case typeSubscribe:
+			mc.write(packet(typeSubAck, 0, []byte{body[0], body[1], 0, 0}))
+		case typePingReq:
+			mc.write(packet(typePingResp, 0, nil))
+		case typeDisconnect:
+			b.closed <- struct{}{}
+			return
+		}
+	}
+}
+
+// send publishes m to the connected client
+func (b *fakeBroker) send(m message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.conn.publish(m)
+}
+
+// waitFor waits for a message published to topic, and returns it
+func (b *fakeBroker) waitFor(t *testing.T, topic string) message {
+	timeout := time.After(15 * time.Second)
+	for {
+		select {
+		case m := <-b.published:
+			if m.topic == topic {
+				return m
+			}
+		case <-timeout:
+			t.Fatal("no message published to", topic)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	b := newFakeBroker(t)
+	defer b.l.Close()
+
+	ph := engine.NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`{"groups": [{"id": "games", "processes": ["non.existing.game"], "limits": {"*": "1h"}}],
+		"mqtt": {"broker": "` + b.l.Addr().String() + `", "client_id": "test", "commands": true}}`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go ph.Run(ctx, &wg)
+	go Run(ctx, &wg, ph)
+
+	if id := <-b.connects; id != "test" {
+		t.Error("unexpected client ID", id)
+	}
+	if m := b.waitFor(t, "ph/status"); string(m.payload) != "online" || !m.retain {
+		t.Error("unexpected availability", string(m.payload), m.retain)
+	}
+	b.waitFor(t, "homeassistant/sensor/ph_games_remaining/config")
+
+	var st map[string]any
+	m := b.waitFor(t, "ph/games/state")
+	if err := json.Unmarshal(m.payload, &st); err != nil || !m.retain || st["limit_minutes"] != 60.0 || st["enforced"] != false {
+		t.Error("unexpected state", string(m.payload), err)
+	}
+
+	b.send(message{topic: "ph/games/grant/set", payload: []byte("30")})
+	b.send(message{topic: "ph/games/block/set", payload: []byte("ON")})
+	for i := 0; i < 20 && (len(ph.GetGrants()) == 0 || len(ph.GetBlocks()) == 0); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if g := ph.GetGrants(); len(g) != 1 || g[0].Group != "games" {
+		t.Error("grant command failed", g)
+	}
+	if _, ok := ph.GetBlocks()["games"]; !ok {
+		t.Error("block command failed", ph.GetBlocks())
+	}
+
+	cancel()
+	if m := b.waitFor(t, "ph/status"); string(m.payload) != "offline" {
+		t.Error("unexpected availability", string(m.payload))
+	}
+	select {
+	case <-b.closed:
+	case <-time.After(5 * time.Second):
+		t.Error("client didn't disconnect")
+	}
+	wg.Wait()
+}
+
+func TestRunWithoutCommands(t *testing.T) {
+	b := newFakeBroker(t)
+	defer b.l.Close()
+
+	mqtt := `"mqtt": {"broker": "` + b.l.Addr().String() + `"}`
+	ph := engine.NewProcessHunter(time.Second, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(`{"groups": [{"id": "games", "processes": ["non.existing.game"], "limits": {"*": "1h"}}], ` + mqtt + `}`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go ph.Run(ctx, &wg)
+	go Run(ctx, &wg, ph)
+
+	<-b.connects
+	// the entities of the commands are removed
+	if m := b.waitFor(t, "homeassistant/switch/ph_games_block/config"); len(m.payload) != 0 || !m.retain {
+		t.Error("unexpected discovery of the block switch", string(m.payload))
+	}
+	b.waitFor(t, "ph/games/state")
+
+	b.send(message{topic: "ph/games/grant/set", payload: []byte("30")})
+	time.Sleep(500 * time.Millisecond)
+	if g := ph.GetGrants(); len(g) != 0 {
+		t.Error("grant command was run while the commands are disabled", g)
+	}
+
+	// the retained messages of a deleted group are cleared
+	err = ph.SetConfig([]byte(`{"groups": [{"id": "video", "processes": ["non.existing.player"], "limits": {"*": "1h"}}], ` + mqtt + `}`))
+	if err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	for _, topic := range []string{"homeassistant/sensor/ph_games_remaining/config", "ph/games/state"} {
+		if m := b.waitFor(t, topic); len(m.payload) != 0 || !m.retain {
+			t.Error("retained message of a deleted group not cleared", topic, string(m.payload))
+		}
+	}
+
+	cancel()
+	wg.Wait()
+}
+
+func TestReadPong(t *testing.T) {
+	p := string(packet(typePingResp, 0, nil))
+	mc := &conn{r: bufio.NewReader(strings.NewReader(p))}
+	pongs := make(chan struct{}, 1)
+	mc.read(make(chan message), pongs, make(chan struct{}))
+	select {
+	case <-pongs:
+	default:
+		t.Error("PINGRESP not signalled")
+	}
+}
+
+func TestParseGrant(t *testing.T) {
+	tests := map[string]time.Duration{"30": time.Minute * 30, "1h": time.Hour, " 2.5 ": time.Second * 150}
+	for p, e := range tests {
+		if d, err := parseGrant(p); err != nil || d != e {
+			t.Error("parseGrant", p, "returned", d, err, "expected", e)
+		}
+	}
+	if _, err := parseGrant("soon"); err == nil {
+		t.Error("parsed a bad grant")
+	}
+}
+
+func TestPacket(t *testing.T) {
+	m := message{topic: "ph/games/state", payload: []byte(strings.Repeat("x", 200)), retain: true}
+	p := publishPacket(m)
+
+	typ, flags, body, err := readPacket(bufio.NewReader(strings.NewReader(string(p))))
+	if err != nil || typ != typePublish {
+		t.Fatal("cannot read packet", typ, err)
+	}
+	r, err := parsePublish(flags, body)
+	if err != nil || r.topic != m.topic || string(r.payload) != string(m.payload) || !r.retain {
+		t.Error("unexpected message", r, err)
+	}
+}
@@ -0,0 +1,273 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	typeConnect    = 1
+	typeConnAck    = 2
+	typePublish    = 3
+	typeSubscribe  = 8
+	typeSubAck     = 9
+	typePingReq    = 12
+	typePingResp   = 13
+	typeDisconnect = 14
+)
+
+// connectOptions are the fields of the CONNECT packet
+type connectOptions struct {
+	clientID  string
+	username  string
+	password  string
+	keepAlive time.Duration
+	will      *message // the message the broker publishes when the connection is lost
+}
+
+// message is a published message
+type message struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// conn is a minimal MQTT 3.1.1 client connection, with QoS 0 only
+type conn struct {
+	c   net.Conn
+	r   *bufio.Reader
+	wmu sync.Mutex // serializes the writes
+}
+
+// appendString appends s prefixed with its length, as MQTT encodes strings
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a string prefixed with its length from b, and returns the string and the rest of b
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("malformed string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("malformed string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// packet returns the packet of type t with flags and the variable header and payload body
+func packet(t byte, flags byte, body []byte) []byte {
+	p := []byte{t<<4 | flags}
+
+	// remaining length
+	n := len(body)
+	for {
+		d := byte(n % 128)
+		n = n / 128
+		if n > 0 {
+			d = d | 0x80
+		}
+		p = append(p, d)
+		if n == 0 {
+			break
+		}
+	}
+
+	return append(p, body...)
+}
+
+// readPacket reads a packet from r, and returns its type, flags and body
+func readPacket(r *bufio.Reader) (t byte, flags byte, body []byte, err error) {
+	h, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	n, mul := 0, 1
+	for i := 0; ; i++ {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		n = n + int(d&0x7f)*mul
+		if d&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, 0, nil, errors.New("malformed remaining length")
+		}
+		mul = mul * 128
+	}
+
+	body = make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+	return h >> 4, h & 0x0f, body, nil
+}
+
+// connectPacket returns the CONNECT packet with options o
+func connectPacket(o connectOptions) []byte {
+	flags := byte(0x02) // clean session
+	if o.will != nil {
+		flags = flags | 0x04
+		if o.will.retain {
+			flags = flags | 0x20
+		}
+	}
+	if o.username != "" {
+		flags = flags | 0x80
+	}
+	if o.password != "" {
+		flags = flags | 0x40
+	}
+
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags) // protocol level 4 is MQTT 3.1.1
+	b = binary.BigEndian.AppendUint16(b, uint16(o.keepAlive/time.Second))
+	b = appendString(b, o.clientID)
+	if o.will != nil {
+		b = appendString(b, o.will.topic)
+		b = appendString(b, string(o.will.payload))
+	}
+	if o.username != "" {
+		b = appendString(b, o.username)
+	}
+	if o.password != "" {
+		b = appendString(b, o.password)
+	}
+
+	return packet(typeConnect, 0, b)
+}
+
+// publishPacket returns the PUBLISH packet (QoS 0) of m
+func publishPacket(m message) []byte {
+	flags := byte(0)
+	if m.retain {
+		flags = 1
+	}
+	return packet(typePublish, flags, append(appendString(nil, m.topic), m.payload...))
+}
+
+// parsePublish parses the body of a PUBLISH packet with flags
+func parsePublish(flags byte, body []byte) (message, error) {
+	topic, rest, err := readString(body)
+	if err != nil {
+		return message{}, err
+	}
+	if flags&0x06 != 0 { // QoS 1 and 2 have a packet identifier
+		if len(rest) < 2 {
+			return message{}, errors.New("malformed publish")
+		}
+		rest = rest[2:]
+	}
+	return message{topic: topic, payload: rest, retain: flags&1 == 1}, nil
+}
+
+// dial connects to the broker at addr, and waits for the broker to accept the connection
+func dial(addr string, o connectOptions) (*conn, error) {
+	c, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	mc := &conn{c: c, r: bufio.NewReader(c)}
+	if err := mc.write(connectPacket(o)); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	t, _, body, err := readPacket(mc.r)
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if t != typeConnAck || len(body) != 2 {
+		c.Close()
+		return nil, errors.New("unexpected response to connect")
+	}
+	if body[1] != 0 {
+		c.Close()
+		return nil, fmt.Errorf("connection refused by the broker, code %d", body[1])
+	}
+
+	return mc, nil
+}
+
+// write writes the packet p
+func (mc *conn) write(p []byte) error {
+	mc.wmu.Lock()
+	defer mc.wmu.Unlock()
+
+	mc.c.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := mc.c.Write(p)
+	return err
+}
+
+// publish publishes m with QoS 0
+func (mc *conn) publish(m message) error {
+	return mc.write(publishPacket(m))
+}
+
+// subscribe subscribes to filters with QoS 0, using packet identifier id
+func (mc *conn) subscribe(id uint16, filters ...string) error {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		b = appendString(b, f)
+		b = append(b, 0) // QoS 0
+	}
+	return mc.write(packet(typeSubscribe, 0x02, b))
+}
+
+// ping sends PINGREQ
+func (mc *conn) ping() error {
+	return mc.write(packet(typePingReq, 0, nil))
+}
+
+// disconnect sends DISCONNECT and closes the connection
+func (mc *conn) disconnect() error {
+	err := mc.write(packet(typeDisconnect, 0, nil))
+	mc.c.Close()
+	return err
+}
+
+// read reads the packets from the broker and sends the published messages to msgs, and signals PINGRESP on pongs,
+// until the connection fails or is closed, or done is closed
+func (mc *conn) read(msgs chan<- message, pongs chan<- struct{}, done <-chan struct{}) error {
+	for {
+		t, flags, body, err := readPacket(mc.r)
+		if err != nil {
+			return err
+		}
+		if t == typePingResp {
+			select {
+			case pongs <- struct{}{}:
+			default:
+			}
+			continue
+		}
+		if t != typePublish {
+			continue // SUBACK
+		}
+		m, err := parsePublish(flags, body)
+		if err != nil {
+			return err
+		}
+		select {
+		case msgs <- m:
+		case <-done:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,528 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ventsip/ph/engine"
+)
+
+const (
+	maxLoginFailures = 5                // failed logins of a client, within loginWindow, that lock it out
+	loginWindow      = 15 * time.Minute // the period in which the failed logins are counted
+	lockoutPeriod    = 15 * time.Minute // how long a client is locked out
+)
+
+// loginAttempts are the failed logins of a client
+type loginAttempts struct {
+	failures    int       // failed logins since first
+	first       time.Time // the first failed login in the current window
+	lockedUntil time.Time // the end of the lockout, if locked out
+}
+
+// loginLimiter limits the failed logins per client IP
+type loginLimiter struct {
+	mu      sync.Mutex
+	clients map[string]*loginAttempts
+}
+
+// newLoginLimiter returns a loginLimiter without failed logins
+func newLoginLimiter() *loginLimiter {
+	return &loginLimiter{clients: make(map[string]*loginAttempts)}
+}
+
+// locked returns when the lockout of ip ends, if ip is locked out at now
+func (l *loginLimiter) locked(ip string, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.clients[ip]
+	if !ok || !now.Before(a.lockedUntil) {
+		return time.Time{}, false
+	}
+	return a.lockedUntil, true
+}
+
+// failed records a failed login of ip at now, and returns true if ip is locked out because of it
+func (l *loginLimiter) failed(ip string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// forget the clients whose failed logins and lockouts have expired
+	for c, a := range l.clients {
+		if now.Sub(a.first) > loginWindow && !now.Before(a.lockedUntil) {
+			delete(l.clients, c)
+		}
+	}
+
+	a, ok := l.clients[ip]
+	if !ok {
+		a = &loginAttempts{first: now}
+		l.clients[ip] = a
+	}
+	a.failures++
+	if a.failures < maxLoginFailures {
+		return false
+	}
+
+	a.failures, a.first = 0, now
+	a.lockedUntil = now.Add(lockoutPeriod)
+	return true
+}
+
+// succeeded forgets the failed logins of ip
+func (l *loginLimiter) succeeded(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.clients, ip)
+}
+
+// permissions that the handlers require, besides the token scopes
+const (
+	permView  = "view"  // view the balance of the own groups; viewers see only those of their OS user
+	permAny   = "any"   // any authenticated user or token
+	permAdmin = "admin" // admin users only
+)
+
+const (
+	sessionCookie = "ph_session"   // the name of the cookie of the web UI sessions
+	sessionPeriod = 12 * time.Hour // how long a web UI session lasts
+)
+
+// principal is the authenticated user or token of a request
+type principal struct {
+	Name   string   `json:"name"`             // Name is the name of the user, or the ID of the token
+	Role   string   `json:"role"`             // Role is RoleAdmin, RoleViewer or RoleToken
+	Scopes []string `json:"scopes,omitempty"` // Scopes are the scopes of the token
+}
+
+// can returns true if p has permission perm, which is a token scope or a permission (e.g. permView)
+func (p principal) can(perm string) bool {
+	switch p.Role {
+	case RoleAdmin:
+		return true
+	case RoleViewer:
+		return perm == permView || perm == permAny
+	case RoleToken:
+		if perm == permView && slices.Contains(p.Scopes, ScopeRead) {
+			return true
+		}
+		return perm == permAny || slices.Contains(p.Scopes, perm)
+	}
+	return false
+}
+
+// userPrincipal returns the principal of usr
+func userPrincipal(usr User) principal {
+	role := usr.Role
+	if role == "" {
+		role = RoleAdmin
+	}
+	return principal{Name: usr.Name, Role: role}
+}
+
+// principalKey is the key of the principal in the context of the request
+type principalKey struct{}
+
+// principalOf returns the principal of r, if r is authenticated
+func principalOf(r *http.Request) (principal, bool) {
+	p, ok := r.Context().Value(principalKey{}).(principal)
+	return p, ok
+}
+
+// session is a logged in user of the web UI
+type session struct {
+	name    string    // the name of the user
+	expires time.Time // when the session expires
+}
+
+// auth authenticates the requests with the users, the tokens and the sessions, limiting the failed logins
+type auth struct {
+	ph      *engine.ProcessHunter
+	users   *userStore
+	limiter *loginLimiter
+
+	mu        sync.Mutex
+	sessions  map[string]session // the web UI sessions, by session ID
+	setupCode string             // the one-time code that sets the first password (see setup); empty once a password is set
+	setupPath string             // the file of the setup code
+}
+
+// newAuth returns auth with the users in the file at usersPath.
+// If there are no users, it writes a one-time setup code to a file next to the users file, readable by its owner only.
+func newAuth(ph *engine.ProcessHunter, usersPath string) *auth {
+	u, err := loadUsers(usersPath)
+	if err != nil {
+		log.Println("error loading users file:", err)
+	}
+	a := &auth{ph: ph, users: u, limiter: newLoginLimiter(), sessions: make(map[string]session),
+		setupPath: filepath.Join(filepath.Dir(usersPath), SetupCodeFile)}
+
+	if !u.empty() {
+		a.endSetup() // the password may have been set with the passwd command
+		return a
+	}
+
+	code, err := randomHex(8)
+	if err == nil {
+		err = os.WriteFile(a.setupPath, []byte(code+"\n"), 0600)
+	}
+	if err != nil {
+		log.Println("error writing setup code:", err)
+		return a
+	}
+	a.setupCode = code
+	log.Println("no password is set: the setup code is in", a.setupPath, "- or set the password with the passwd command")
+	return a
+}
+
+// checkSetupCode returns true if code is the setup code
+func (a *auth) checkSetupCode(code string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.setupCode != "" && subtle.ConstantTimeCompare([]byte(code), []byte(a.setupCode)) == 1
+}
+
+// endSetup invalidates the setup code, and removes its file
+func (a *auth) endSetup() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.setupCode = ""
+	if err := os.Remove(a.setupPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println("error removing setup code:", err)
+	}
+}
+
+// clientIP returns the IP address of the client of r
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// newSession starts a web UI session of user name, and returns its ID
+func (a *auth) newSession(name string, now time.Time) (string, error) {
+	id, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for sid, s := range a.sessions {
+		if !now.Before(s.expires) {
+			delete(a.sessions, sid)
+		}
+	}
+	a.sessions[id] = session{name: name, expires: now.Add(sessionPeriod)}
+	return id, nil
+}
+
+// sessionUser returns the user of the session with id, if the session is valid at now
+func (a *auth) sessionUser(id string, now time.Time) (User, bool) {
+	a.mu.Lock()
+	s, ok := a.sessions[id]
+	a.mu.Unlock()
+
+	if !ok || !now.Before(s.expires) {
+		return User{}, false
+	}
+	// the user may have been removed from the users file
+	return a.users.user(s.name)
+}
+
+// endSession ends the session with id
+func (a *auth) endSession(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.sessions, id)
+}
+
+// failedLogin records a failed login of user from the client of r, and emits the events
+func (a *auth) failedLogin(r *http.Request, user string, now time.Time) {
+	ip := clientIP(r)
+	a.ph.Emit(engine.Event{Type: engine.EventLoginFailed, User: user, Message: "failed login from " + ip})
+	if a.limiter.failed(ip, now) {
+		a.ph.Emit(engine.Event{Type: engine.EventLockout, Message: fmt.Sprint(ip, " locked out for ", lockoutPeriod)})
+	}
+}
+
+// lockedOut responds with http.StatusTooManyRequests and returns true, if the client of r is locked out
+func (a *auth) lockedOut(w http.ResponseWriter, r *http.Request, now time.Time) bool {
+	until, ok := a.limiter.locked(clientIP(r), now)
+	if ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(until.Sub(now).Seconds())+1))
+		http.Error(w, "Too many failed logins, try again later", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// authenticate authenticates r with the session cookie, the bearer token or the basic authentication credentials.
+// It responds with an error and returns false, if the credentials are missing or wrong, or the client is locked out.
+func (a *auth) authenticate(w http.ResponseWriter, r *http.Request) (principal, bool) {
+	now := time.Now()
+
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if usr, ok := a.sessionUser(c.Value, now); ok {
+			return userPrincipal(usr), true
+		}
+	}
+
+	if a.lockedOut(w, r, now) {
+		return principal{}, false
+	}
+
+	if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		t, ok := a.users.authenticateToken(tok)
+		if !ok {
+			a.failedLogin(r, "", now)
+			http.Error(w, "Invalid or revoked token", http.StatusUnauthorized)
+			return principal{}, false
+		}
+		return principal{Name: t.ID, Role: RoleToken, Scopes: t.Scopes}, true
+	}
+
+	// the web UI logs in with its own form, instead of the browser's
+	if r.Header.Get("X-Requested-With") == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Configuration"`)
+	}
+	u, p, ok := r.BasicAuth()
+	if !ok {
+		http.Error(w, "Username and password required", http.StatusUnauthorized)
+		return principal{}, false
+	}
+	usr, ok := a.users.authenticate(u, p)
+	if !ok {
+		a.failedLogin(r, u, now)
+		http.Error(w, "Incorrect username or password", http.StatusUnauthorized)
+		return principal{}, false
+	}
+	a.limiter.succeeded(clientIP(r))
+
+	return userPrincipal(usr), true
+}
+
+// authorize is a middleware that allows the requests to h, if they have permission get (GET and HEAD methods),
+// or permission put (other methods). An empty permission allows the requests without authentication.
+// Until a password is set, the reads are allowed and the changes are refused.
+// Viewers get the balance of their own OS user only: the "user" query parameter is set to their name.
+func (a *auth) authorize(get, put string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perm := put
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			perm = get
+		}
+		if perm == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if a.users.empty() {
+			if perm != get {
+				http.Error(w, "Set the password first", http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		p, ok := a.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if !p.can(perm) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+		if perm == permView && !p.can(ScopeRead) {
+			q := r.URL.Query()
+			q.Set("user", p.Name)
+			r.URL.RawQuery = q.Encode()
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// login starts a web UI session (POST) of {"username", "password"}, and responds with the principal
+func login(a *auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+			return
+		}
+
+		now := time.Now()
+		if a.lockedOut(w, r, now) {
+			return
+		}
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		usr, ok := a.users.authenticate(req.Username, req.Password)
+		if !ok {
+			a.failedLogin(r, req.Username, now)
+			http.Error(w, "Incorrect username or password", http.StatusUnauthorized)
+			return
+		}
+		a.limiter.succeeded(clientIP(r))
+
+		id, err := a.newSession(usr.Name, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/", Expires: now.Add(sessionPeriod),
+			HttpOnly: true, SameSite: http.SameSiteStrictMode})
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		b, _ := json.MarshalIndent(userPrincipal(usr), "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// logout ends the web UI session (POST)
+func logout(a *auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+			return
+		}
+		if c, err := r.Cookie(sessionCookie); err == nil {
+			a.endSession(c.Value)
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		http.Error(w, "Logged out", http.StatusOK)
+	})
+}
+
+// whoami serves the principal of the request as JSON (GET); the admin, until a password is set
+func whoami() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		p, ok := principalOf(r)
+		if !ok {
+			p = principal{Role: RoleAdmin}
+		}
+		b, _ := json.MarshalIndent(p, "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// tokens serves the API tokens as JSON (GET), creates a token (POST) with {"name", "scopes"},
+// responding with the token, and revokes a token (DELETE) with the "id" parameter
+func tokens(a *auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			b, _ := json.MarshalIndent(a.users.getTokens(), "", "    ")
+			fmt.Fprintf(w, "%s", b)
+		case http.MethodPost:
+			var req struct {
+				Name   string   `json:"name"`
+				Scopes []string `json:"scopes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			t, tok, err := a.users.addToken(req.Name, req.Scopes)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusCreated)
+			b, _ := json.MarshalIndent(struct {
+				Token
+				Secret string `json:"token"` // Secret is the token to use, shown only once
+			}{t, tok}, "", "    ")
+			fmt.Fprintf(w, "%s", b)
+		case http.MethodDelete:
+			if err := a.users.revokeToken(r.URL.Query().Get("id")); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Token revoked", http.StatusOK)
+		default:
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		}
+	})
+}
+
+// setup reports whether the password must be set (GET), and sets the first password (PUT) with {"username", "password", "code"},
+// where code is the one-time setup code written by newAuth. Wrong codes count as failed logins.
+// Once a password is set, setup refuses to set another; change it with the passwd command instead.
+func setup(a *auth) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			fmt.Fprintf(w, `{"required": %t}`, a.users.empty())
+		case http.MethodPut:
+			now := time.Now()
+			if a.lockedOut(w, r, now) {
+				return
+			}
+			var req struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+				Code     string `json:"code"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if !a.users.empty() {
+				http.Error(w, "Password already set", http.StatusForbidden)
+				return
+			}
+			if !a.checkSetupCode(req.Code) {
+				a.failedLogin(r, req.Username, now)
+				http.Error(w, "Incorrect setup code", http.StatusUnauthorized)
+				return
+			}
+			err := a.users.setFirstPassword(req.Username, req.Password)
+			if errors.Is(err, errPasswordSet) {
+				http.Error(w, "Password already set", http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			a.endSetup()
+			log.Println("password of", req.Username, "set")
+			http.Error(w, "Password set", http.StatusCreated)
+		default:
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		}
+	})
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ventsip/ph/engine"
+)
+
+// testAuth returns auth with user "parent" and password "s3cr3t pass"
+func testAuth(t *testing.T) *auth {
+	path := filepath.Join(t.TempDir(), UsersFile)
+	if err := SetPassword(path, "parent", "s3cr3t pass"); err != nil {
+		t.Fatal("Could not set password:", err)
+	}
+	return newAuth(engine.NewProcessHunter(time.Hour, "", time.Hour, nil, ""), path)
+}
+
+func TestSetPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), UsersFile)
+	if err := SetPassword(path, "parent", "short"); err == nil {
+		t.Error("accepted a short password")
+	}
+	if err := SetPassword(path, "parent", "first password"); err != nil {
+		t.Fatal("Could not set password:", err)
+	}
+	if err := SetPassword(path, "parent", "second password"); err != nil {
+		t.Fatal("Could not change password:", err)
+	}
+
+	u, err := loadUsers(path)
+	if err != nil {
+		t.Fatal("Could not load users:", err)
+	}
+	if len(u.users) != 1 || strings.Contains(u.users[0].Hash, "password") {
+		t.Error("unexpected users", u.users)
+	}
+	if _, ok := u.authenticate("parent", "first password"); ok {
+		t.Error("authenticated with the old password")
+	}
+	if usr, ok := u.authenticate("parent", "second password"); !ok || usr.Role != RoleAdmin {
+		t.Error("not authenticated as admin", usr)
+	}
+	if _, ok := u.authenticate("child", "second password"); ok {
+		t.Error("wrong authentication")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	a := newAuth(engine.NewProcessHunter(time.Hour, "", time.Hour, nil, ""), filepath.Join(dir, UsersFile))
+	called := false
+	h := a.authorize(ScopeRead, ScopeConfig, http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+
+	// no edits before the password is set
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/config", nil)
+	r.SetBasicAuth("time", "k33p3rs")
+	h.ServeHTTP(rec, r)
+	if called || rec.Code != http.StatusForbidden {
+		t.Error("edit allowed before the password is set", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	setup(a).ServeHTTP(rec, httptest.NewRequest("GET", "/setup", nil))
+	if rec.Body.String() != `{"required": true}` {
+		t.Error("setup not required", rec.Body.String())
+	}
+
+	// the setup code is required
+	for _, body := range []string{`{"username": "child", "password": "s3cr3t pass"}`, `{"username": "child", "password": "s3cr3t pass", "code": "guess"}`} {
+		rec = httptest.NewRecorder()
+		setup(a).ServeHTTP(rec, httptest.NewRequest("PUT", "/setup", strings.NewReader(body)))
+		if rec.Code != http.StatusUnauthorized || !a.users.empty() {
+			t.Error("password set without the setup code", rec.Code, body)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, SetupCodeFile))
+	if err != nil {
+		t.Fatal("Could not read setup code:", err)
+	}
+	code := strings.TrimSpace(string(b))
+	rec = httptest.NewRecorder()
+	setup(a).ServeHTTP(rec, httptest.NewRequest("PUT", "/setup", strings.NewReader(`{"username": "parent", "password": "s3cr3t pass", "code": "`+code+`"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Error("password not set", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, SetupCodeFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("setup code not removed", err)
+	}
+
+	// the password cannot be set again through setup
+	rec = httptest.NewRecorder()
+	setup(a).ServeHTTP(rec, httptest.NewRequest("PUT", "/setup", strings.NewReader(`{"username": "child", "password": "another pass", "code": "`+code+`"}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Error("password set twice", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/config", nil)
+	r.SetBasicAuth("parent", "s3cr3t pass")
+	h.ServeHTTP(rec, r)
+	if !called {
+		t.Error("edit rejected after the password is set", rec.Code)
+	}
+}
+
+func TestLockout(t *testing.T) {
+	a := testAuth(t)
+	h := a.authorize(ScopeRead, ScopeConfig, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	put := func(ip, password string) int {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/config", nil)
+		r.RemoteAddr = ip + ":1234"
+		r.SetBasicAuth("parent", password)
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	for i := 0; i < maxLoginFailures; i++ {
+		if c := put("10.0.0.1", "wrong"); c != http.StatusUnauthorized {
+			t.Error("unexpected status of a failed login", c)
+		}
+	}
+	if c := put("10.0.0.1", "s3cr3t pass"); c != http.StatusTooManyRequests {
+		t.Error("client not locked out", c)
+	}
+	if c := put("10.0.0.2", "s3cr3t pass"); c != http.StatusOK {
+		t.Error("another client locked out", c)
+	}
+
+	var failed, lockouts int
+	for _, e := range a.ph.GetEvents() {
+		switch e.Type {
+		case engine.EventLoginFailed:
+			failed++
+		case engine.EventLockout:
+			lockouts++
+		}
+	}
+	if failed != maxLoginFailures || lockouts != 1 {
+		t.Error("unexpected events", a.ph.GetEvents())
+	}
+}
+
+func TestLoginLimiter(t *testing.T) {
+	l := newLoginLimiter()
+	now := time.Now()
+
+	for i := 0; i < maxLoginFailures-1; i++ {
+		if l.failed("ip", now) {
+			t.Error("locked out too early")
+		}
+	}
+	// the failures expire after the window
+	if l.failed("ip", now.Add(loginWindow+time.Second)) {
+		t.Error("locked out by expired failures")
+	}
+	if _, ok := l.locked("ip", now.Add(loginWindow+time.Second)); ok {
+		t.Error("locked out by expired failures")
+	}
+
+	l.succeeded("ip")
+	for i := 0; i < maxLoginFailures; i++ {
+		l.failed("ip", now)
+	}
+	if until, ok := l.locked("ip", now); !ok || !until.Equal(now.Add(lockoutPeriod)) {
+		t.Error("not locked out", until)
+	}
+	if _, ok := l.locked("ip", now.Add(lockoutPeriod)); ok {
+		t.Error("locked out after the lockout period")
+	}
+}
+
+func TestPasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), UsersFile)
+	var out strings.Builder
+	if err := Passwd(path, nil, strings.NewReader("first pass\nother pass\n"), &out); err == nil {
+		t.Error("accepted passwords that don't match")
+	}
+	if err := Passwd(path, []string{"mom"}, strings.NewReader("first pass\nfirst pass\n"), &out); err != nil {
+		t.Error("Could not set password:", err)
+	}
+	if u, _ := loadUsers(path); !authenticated(u, "mom", "first pass") {
+		t.Error("password not set")
+	}
+
+	if err := Passwd(path, []string{"alice", "child"}, strings.NewReader("alice pass\nalice pass\n"), &out); err == nil {
+		t.Error("accepted an unknown role")
+	}
+	if err := Passwd(path, []string{"alice", RoleViewer}, strings.NewReader("alice pass\nalice pass\n"), &out); err != nil {
+		t.Error("Could not set password:", err)
+	}
+	if u, _ := loadUsers(path); u.users[1].Role != RoleViewer {
+		t.Error("role not set", u.users)
+	}
+}
+
+// authenticated returns true if password is the password of user name
+func authenticated(u *userStore, name, password string) bool {
+	_, ok := u.authenticate(name, password)
+	return ok
+}
+
+// testRoles returns auth with admin "parent", viewer "alice", both with password "s3cr3t pass"
+func testRoles(t *testing.T) *auth {
+	a := testAuth(t)
+	if err := a.users.setPassword("alice", "s3cr3t pass", RoleViewer); err != nil {
+		t.Fatal("Could not set password:", err)
+	}
+	return a
+}
+
+// request serves a request with method and url by h, with the header key set to value, and returns the response
+func request(h http.Handler, method, url string, key, value string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(method, url, nil)
+	if key != "" {
+		r.Header.Set(key, value)
+	}
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// basic returns the basic authorization header value of user and password
+func basic(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func TestRoles(t *testing.T) {
+	a := testRoles(t)
+	var query string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { query = r.URL.RawQuery })
+
+	view := a.authorize(permView, ScopeConfig, h)
+	if rec := request(view, "GET", "/groupbalance", "Authorization", basic("alice", "s3cr3t pass")); rec.Code != http.StatusOK || query != "user=alice" {
+		t.Error("viewer does not see the own groups only", rec.Code, query)
+	}
+	if rec := request(view, "GET", "/groupbalance?user=bob", "Authorization", basic("alice", "s3cr3t pass")); rec.Code != http.StatusOK || query != "user=alice" {
+		t.Error("viewer sees the groups of another user", rec.Code, query)
+	}
+	if rec := request(view, "GET", "/groupbalance?user=bob", "Authorization", basic("parent", "s3cr3t pass")); rec.Code != http.StatusOK || query != "user=bob" {
+		t.Error("admin does not see the groups of any user", rec.Code, query)
+	}
+	if rec := request(view, "GET", "/groupbalance", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Error("anonymous user sees the groups", rec.Code)
+	}
+
+	cfg := a.authorize(ScopeRead, ScopeConfig, h)
+	if rec := request(cfg, "GET", "/config", "Authorization", basic("alice", "s3cr3t pass")); rec.Code != http.StatusForbidden {
+		t.Error("viewer sees the configuration", rec.Code)
+	}
+	if rec := request(cfg, "PUT", "/config", "Authorization", basic("alice", "s3cr3t pass")); rec.Code != http.StatusForbidden {
+		t.Error("viewer edits the configuration", rec.Code)
+	}
+	if rec := request(cfg, "PUT", "/config", "Authorization", basic("parent", "s3cr3t pass")); rec.Code != http.StatusOK {
+		t.Error("admin cannot edit the configuration", rec.Code)
+	}
+
+	// the web UI gets no basic authentication challenge
+	if rec := request(cfg, "GET", "/config", "X-Requested-With", "XMLHttpRequest"); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "" {
+		t.Error("unexpected response to the web UI", rec.Code, rec.Header())
+	}
+}
+
+func TestTokens(t *testing.T) {
+	a := testRoles(t)
+	admin := basic("parent", "s3cr3t pass")
+	h := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	tk := a.authorize(permAdmin, permAdmin, tokens(a))
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/tokens", strings.NewReader(`{"name": "grafana", "scopes": ["read"]}`))
+	r.Header.Set("Authorization", admin)
+	tk.ServeHTTP(rec, r)
+	var created struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+		Hash  string `json:"hash"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); rec.Code != http.StatusCreated || err != nil || created.Token == "" || created.Hash != "" {
+		t.Fatal("token not created", rec.Code, rec.Body.String())
+	}
+	bearer := "Bearer " + created.Token
+
+	if rec := request(a.authorize(ScopeRead, ScopeConfig, h), "GET", "/metrics", "Authorization", bearer); rec.Code != http.StatusOK {
+		t.Error("token cannot read", rec.Code)
+	}
+	if rec := request(a.authorize(ScopeRead, ScopeGrant, h), "PUT", "/grants", "Authorization", bearer); rec.Code != http.StatusForbidden {
+		t.Error("token grants time without the scope", rec.Code)
+	}
+	if rec := request(tk, "GET", "/tokens", "Authorization", bearer); rec.Code != http.StatusForbidden {
+		t.Error("token manages tokens", rec.Code)
+	}
+	if rec := request(tk, "GET", "/tokens", "Authorization", basic("alice", "s3cr3t pass")); rec.Code != http.StatusForbidden {
+		t.Error("viewer manages tokens", rec.Code)
+	}
+	if rec := request(tk, "GET", "/tokens", "Authorization", admin); rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), `"hash"`) {
+		t.Error("unexpected tokens", rec.Code, rec.Body.String())
+	}
+
+	if rec := request(tk, "DELETE", "/tokens?id="+created.ID, "Authorization", admin); rec.Code != http.StatusOK {
+		t.Error("token not revoked", rec.Code, rec.Body.String())
+	}
+	if rec := request(a.authorize(ScopeRead, ScopeConfig, h), "GET", "/metrics", "Authorization", bearer); rec.Code != http.StatusUnauthorized {
+		t.Error("revoked token can read", rec.Code)
+	}
+	if _, _, err := a.users.addToken("bad", []string{"everything"}); err == nil {
+		t.Error("token with an unknown scope created")
+	}
+}
+
+func TestSessions(t *testing.T) {
+	a := testRoles(t)
+
+	rec := httptest.NewRecorder()
+	login(a).ServeHTTP(rec, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "alice", "password": "wrong"}`)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Error("logged in with a wrong password", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	login(a).ServeHTTP(rec, httptest.NewRequest("POST", "/login", strings.NewReader(`{"username": "alice", "password": "s3cr3t pass"}`)))
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || !cookies[0].HttpOnly || !strings.Contains(rec.Body.String(), RoleViewer) {
+		t.Fatal("not logged in", rec.Code, rec.Body.String())
+	}
+	cookie := sessionCookie + "=" + cookies[0].Value
+
+	who := a.authorize(permAny, permAny, whoami())
+	if rec := request(who, "GET", "/whoami", "Cookie", cookie); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"alice"`) {
+		t.Error("session not authenticated", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/logout", nil)
+	r.Header.Set("Cookie", cookie)
+	logout(a).ServeHTTP(rec, r)
+	if rec := request(who, "GET", "/whoami", "Cookie", cookie); rec.Code != http.StatusUnauthorized {
+		t.Error("session authenticated after logout", rec.Code)
+	}
+
+	// sessions expire
+	id, _ := a.newSession("alice", time.Now().Add(-sessionPeriod))
+	if _, ok := a.sessionUser(id, time.Now()); ok {
+		t.Error("expired session is valid")
+	}
+}
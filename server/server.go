@@ -4,11 +4,16 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,14 +22,15 @@ import (
 
 const port = ":8080"
 
-// config serves configuration as JSON (GET) and applies new configuration (PUT).
+// config serves configuration as JSON (GET), without the secrets (see engine.SecretPlaceholder),
+// and applies new configuration (PUT).
 func config(ph *engine.ProcessHunter) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
-			l := ph.GetLimits()
-			b, err := json.MarshalIndent(l, "", "    ")
+			c := ph.GetRedactedConfig()
+			b, err := json.MarshalIndent(c, "", "    ")
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				break
@@ -48,20 +54,147 @@ func config(ph *engine.ProcessHunter) http.Handler {
 	})
 }
 
-// groupBalance serves ph.GetLatestPGroupsBalance() as JSON (GET)
+// groupBalance serves ph.GetLatestPGroupsBalance() as JSON (GET).
+// The optional "user" parameter limits the result to the groups that apply to the user.
 func groupBalance(ph *engine.ProcessHunter) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		b, _ := json.MarshalIndent(ph.GetLatestPGroupsBalance(), "", "    ")
+		pgbs := ph.GetLatestPGroupsBalance()
+		if u := r.URL.Query().Get("user"); u != "" {
+			pgbs = ph.GetLatestUserPGroupsBalance(u)
+		}
+		b, _ := json.MarshalIndent(pgbs, "", "    ")
 		fmt.Fprintf(w, "%s", b)
 	})
 }
 
-// processBalance serves ph.GetLatestProcessesBalance() as JSON (GET)
+// processBalance serves ph.GetLatestProcessesBalance() as JSON (GET).
+// The optional "user" parameter limits the balance to the processes of the user.
 func processBalance(ph *engine.ProcessHunter) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		b, _ := json.MarshalIndent(ph.GetLatestProcessesBalance(), "", "    ")
+		tb := ph.GetLatestProcessesBalance()
+		if u := r.URL.Query().Get("user"); u != "" {
+			tb = ph.GetLatestUserProcessesBalance(u)
+		}
+		b, _ := json.MarshalIndent(tb, "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// cpuHistory serves ph.GetCPUHistory() as JSON (GET)
+func cpuHistory(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=120")
+		b, _ := json.MarshalIndent(ph.GetCPUHistory(), "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// sessionBalance serves ph.GetLatestSessionsBalance() as JSON (GET).
+// The optional "user" parameter limits the result to the session balance of the user.
+func sessionBalance(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		sdbs := ph.GetLatestSessionsBalance()
+		if u := r.URL.Query().Get("user"); u != "" {
+			sdbs = slices.DeleteFunc(slices.Clone(sdbs), func(sdb engine.SessionDayBalance) bool { return sdb.User != u })
+		}
+		if sdbs == nil {
+			sdbs = []engine.SessionDayBalance{}
+		}
+		b, _ := json.MarshalIndent(sdbs, "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// events serves ph.GetEvents() as JSON (GET)
+func events(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		b, _ := json.MarshalIndent(ph.GetEvents(), "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// keepAlivePeriod is how often a comment is sent to the event stream, to keep the connection open
+const keepAlivePeriod = 30 * time.Second
+
+// eventStream streams ph.Snapshot() as server-sent "snapshot" events (GET),
+// initially and whenever the engine publishes an update.
+// The optional "user" parameter limits the balance to the groups and the processes of the user.
+func eventStream(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		updates, cancel := ph.Subscribe()
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		user := r.URL.Query().Get("user")
+		// the configuration may hold secrets, and is not sent to viewers
+		p, ok := principalOf(r)
+		readable := !ok || p.can(ScopeRead)
+		send := func(reason string) {
+			s := ph.Snapshot(reason, user)
+			if !readable {
+				s.Config = engine.Config{}
+			}
+			b, _ := json.Marshal(s)
+			fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", b)
+			flusher.Flush()
+		}
+		send("initial")
+
+		ticker := time.NewTicker(keepAlivePeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case u := <-updates:
+				send(u.Reason)
+			case <-ticker.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// metrics serves ph.WriteMetrics() in the Prometheus text exposition format (GET)
+func metrics(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := ph.WriteMetrics(w); err != nil {
+			log.Println("error writing metrics:", err)
+		}
+	})
+}
+
+// webhooks serves ph.GetWebhooks() as JSON (GET)
+func webhooks(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		b, _ := json.MarshalIndent(ph.GetWebhooks(), "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// users serves ph.GetUsers() as JSON (GET)
+func users(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		b, _ := json.MarshalIndent(ph.GetUsers(), "", "    ")
 		fmt.Fprintf(w, "%s", b)
 	})
 }
@@ -76,30 +209,283 @@ func balanceHistory(ph *engine.ProcessHunter) http.Handler {
 	})
 }
 
-// version serves version
-func version(ver string) http.Handler {
+// discovery serves ph.Discover() as JSON (GET) and adds a discovered process to a process group (PUT).
+// GET accepts optional "from" and "to" dates (YYYY-MM-DD, the last 7 days by default)
+// and "new_days" - the number of days in which a process is considered new (7 by default).
+// PUT expects a JSON object like {"process": "name", "group": "games"}, where group is the ID of the process group.
+func discovery(ph *engine.ProcessHunter) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, ver)
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			to := time.Now()
+			from := to.AddDate(0, 0, -6)
+			newDays := 7
+
+			var err error
+			if v := q.Get("from"); v != "" {
+				if from, err = time.ParseInLocation(time.DateOnly, v, time.Local); err != nil {
+					http.Error(w, "Bad from date: "+err.Error(), http.StatusBadRequest)
+					break
+				}
+			}
+			if v := q.Get("to"); v != "" {
+				if to, err = time.ParseInLocation(time.DateOnly, v, time.Local); err != nil {
+					http.Error(w, "Bad to date: "+err.Error(), http.StatusBadRequest)
+					break
+				}
+			}
+			if v := q.Get("new_days"); v != "" {
+				if newDays, err = strconv.Atoi(v); err != nil {
+					http.Error(w, "Bad new_days: "+err.Error(), http.StatusBadRequest)
+					break
+				}
+			}
+
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			b, _ := json.MarshalIndent(ph.Discover(from, to, newDays), "", "    ")
+			fmt.Fprintf(w, "%s", b)
+		case http.MethodPut:
+			var req struct {
+				Process string `json:"process"`
+				Group   string `json:"group"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				break
+			}
+			err = ph.AddProcessToGroup(req.Process, req.Group)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				break
+			}
+			http.Error(w, "Configuration saved", http.StatusCreated)
+		default:
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		}
+	})
+}
+
+// grants serves ph.GetGrants() as JSON (GET) and grants more time to a process group (PUT).
+// PUT expects a JSON object like {"group": "games", "duration": "30m", "reason": "homework done"}.
+func grants(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			b, _ := json.MarshalIndent(ph.GetGrants(), "", "    ")
+			fmt.Fprintf(w, "%s", b)
+		case http.MethodPut:
+			var req struct {
+				Group    string `json:"group"`
+				Duration string `json:"duration"`
+				Reason   string `json:"reason"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				break
+			}
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				http.Error(w, "Bad duration: "+err.Error(), http.StatusBadRequest)
+				break
+			}
+			gr, err := ph.AddGrant(req.Group, d, req.Reason)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				break
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusCreated)
+			b, _ := json.MarshalIndent(gr, "", "    ")
+			fmt.Fprintf(w, "%s", b)
+		default:
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		}
 	})
 }
 
-// authPut is a middleware that protects PUT method for handler h with basic authentication.
-// Expected username and password are hardcoded.
-func authPut(h http.Handler) http.Handler {
+// control serves ph.GetControls() as JSON (GET), sets a control with set (PUT) of {"group", "until"},
+// or of {"group", "duration"} from now, and clears it with clear (DELETE) of the group in the query.
+// It responds to PUT and DELETE with the updated controls.
+func control(ph *engine.ProcessHunter, set func(group string, until time.Time) error, clear func(group string) error) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPut { // only PUT method is protected
-			w.Header().Set("WWW-Authenticate", `Basic realm="Configuration"`)
-			u, p, ok := r.BasicAuth()
-			if !ok {
-				http.Error(w, "Username and password required", http.StatusUnauthorized)
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var req struct {
+				Group    string    `json:"group"`
+				Until    time.Time `json:"until"`
+				Duration string    `json:"duration"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if !(u == "time" && p == "k33p3rs") {
-				http.Error(w, "Incorrect username or password", http.StatusUnauthorized)
+			if req.Duration != "" {
+				d, err := time.ParseDuration(req.Duration)
+				if err != nil {
+					http.Error(w, "Bad duration: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+				req.Until = time.Now().Add(d)
+			}
+			if err := set(req.Group, req.Until); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
+		case http.MethodDelete:
+			if err := clear(r.URL.Query().Get("group")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+			return
 		}
-		h.ServeHTTP(w, r)
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		b, _ := json.MarshalIndent(ph.GetControls(), "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// blocks serves the controls (see control), and blocks (PUT) and unblocks (DELETE) a group
+func blocks(ph *engine.ProcessHunter) http.Handler {
+	return control(ph, ph.Block, ph.Unblock)
+}
+
+// lockdown serves the controls (see control), and starts (PUT) and ends (DELETE) the lockdown of all the groups
+func lockdown(ph *engine.ProcessHunter) http.Handler {
+	return control(ph,
+		func(_ string, until time.Time) error { return ph.Lockdown(until) },
+		func(_ string) error { ph.EndLockdown(); return nil })
+}
+
+// vacation serves the controls (see control), and starts (PUT) and ends (DELETE) the vacation
+func vacation(ph *engine.ProcessHunter) http.Handler {
+	return control(ph,
+		func(_ string, until time.Time) error { return ph.Vacation(until) },
+		func(_ string) error { ph.EndVacation(); return nil })
+}
+
+// timeRequests serves the requests for more time of the user in the query, or of all users, as JSON (GET),
+// and makes a request (POST) of {"group", "duration", "reason"} on behalf of the user in the query,
+// or of {"user"} if the query has no user
+func timeRequests(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			b, _ := json.MarshalIndent(ph.GetRequests(r.URL.Query().Get("user")), "", "    ")
+			fmt.Fprintf(w, "%s", b)
+		case http.MethodPost:
+			var req struct {
+				User     string `json:"user"`
+				Group    string `json:"group"`
+				Duration string `json:"duration"`
+				Reason   string `json:"reason"`
+			}
+			err := json.NewDecoder(r.Body).Decode(&req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				break
+			}
+			if u := r.URL.Query().Get("user"); u != "" {
+				req.User = u
+			}
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				http.Error(w, "Bad duration: "+err.Error(), http.StatusBadRequest)
+				break
+			}
+			tr, err := ph.RequestTime(req.User, req.Group, d, req.Reason)
+			if errors.Is(err, engine.ErrRequestLimit) {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				break
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusCreated)
+			b, _ := json.MarshalIndent(tr, "", "    ")
+			fmt.Fprintf(w, "%s", b)
+		default:
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		}
+	})
+}
+
+// decideRequest approves (if approve is true) or denies the request for more time (POST) of {"id", "note"},
+// and responds with the decided request as JSON
+func decideRequest(ph *engine.ProcessHunter, approve bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+			return
+		}
+
+		var req struct {
+			ID   string `json:"id"`
+			Note string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, _ := principalOf(r)
+		tr, err := ph.DecideRequest(req.ID, approve, p.Name, req.Note)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		b, _ := json.MarshalIndent(tr, "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// audit serves ph.GetAllowlistPreviews() as JSON (GET)
+func audit(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		b, _ := json.MarshalIndent(ph.GetAllowlistPreviews(), "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// healthz responds with "ok" if ph is healthy, and with the problems and http.StatusServiceUnavailable otherwise (GET)
+func healthz(ph *engine.ProcessHunter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := ph.GetStatus(time.Now())
+		if !st.Healthy {
+			http.Error(w, strings.Join(st.Problems, "\n"), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+}
+
+// status serves ph.GetStatus() with version ver as JSON (GET)
+func status(ph *engine.ProcessHunter, ver string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		st := ph.GetStatus(time.Now())
+		st.Version = ver
+		b, _ := json.MarshalIndent(st, "", "    ")
+		fmt.Fprintf(w, "%s", b)
+	})
+}
+
+// version serves version
+func version(ver string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, ver)
 	})
 }
 
@@ -118,22 +504,58 @@ func Serve(ctx context.Context, wg *sync.WaitGroup, ph *engine.ProcessHunter, ve
 	}()
 
 	mux := http.NewServeMux() // avoid using DefaultServeMux
+	a := newAuth(ph, UsersFile)
 
+	// public
 	mux.Handle("/", http.FileServer(http.FS(webFS)))
 	mux.Handle("/version", version(ver))
-	mux.Handle("/config", authPut(config(ph)))
-	mux.Handle("/groupbalance", groupBalance(ph))
-	mux.Handle("/processbalance", processBalance(ph))
-	mux.Handle("/balance", balanceHistory(ph))
+	mux.Handle("/healthz", healthz(ph))
+	mux.Handle("/setup", setup(a))
+	mux.Handle("/login", login(a))
+	mux.Handle("/logout", logout(a))
+
+	// the balance of the own groups, for viewers
+	mux.Handle("/whoami", a.authorize(permAny, permAny, whoami()))
+	mux.Handle("/groupbalance", a.authorize(permView, ScopeConfig, groupBalance(ph)))
+	mux.Handle("/processbalance", a.authorize(permView, ScopeConfig, processBalance(ph)))
+	mux.Handle("/sessionbalance", a.authorize(permView, ScopeConfig, sessionBalance(ph)))
+	mux.Handle("/events/stream", a.authorize(permView, ScopeConfig, eventStream(ph)))
+	mux.Handle("/requests", a.authorize(permView, permView, timeRequests(ph)))
+
+	// everything else, for admins and tokens
+	mux.Handle("/status", a.authorize(ScopeRead, ScopeConfig, status(ph, ver)))
+	mux.Handle("/config", a.authorize(ScopeRead, ScopeConfig, config(ph)))
+	mux.Handle("/balance", a.authorize(ScopeRead, ScopeConfig, balanceHistory(ph)))
+	mux.Handle("/cpu", a.authorize(ScopeRead, ScopeConfig, cpuHistory(ph)))
+	mux.Handle("/users", a.authorize(ScopeRead, ScopeConfig, users(ph)))
+	mux.Handle("/events", a.authorize(ScopeRead, ScopeConfig, events(ph)))
+	mux.Handle("/metrics", a.authorize(ScopeRead, ScopeConfig, metrics(ph)))
+	mux.Handle("/webhooks", a.authorize(ScopeRead, ScopeConfig, webhooks(ph)))
+	mux.Handle("/discovery", a.authorize(ScopeRead, ScopeConfig, discovery(ph)))
+	mux.Handle("/audit", a.authorize(ScopeRead, ScopeConfig, audit(ph)))
+	mux.Handle("/grants", a.authorize(ScopeRead, ScopeGrant, grants(ph)))
+	mux.Handle("/blocks", a.authorize(ScopeRead, ScopeGrant, blocks(ph)))
+	mux.Handle("/lockdown", a.authorize(ScopeRead, ScopeGrant, lockdown(ph)))
+	mux.Handle("/vacation", a.authorize(ScopeRead, ScopeGrant, vacation(ph)))
+	mux.Handle("/requests/approve", a.authorize(ScopeRead, ScopeGrant, decideRequest(ph, true)))
+	mux.Handle("/requests/deny", a.authorize(ScopeRead, ScopeGrant, decideRequest(ph, false)))
+	mux.Handle("/tokens", a.authorize(permAdmin, permAdmin, tokens(a)))
 
-	s := http.Server{Addr: port, Handler: mux}
+	// the requests are cancelled with ctx, to end the event streams on shut down
+	s := http.Server{Addr: port, Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
 
 	log.Println("starting service")
-	go func() {
-		if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Println("Web service listen error:", err)
-		}
-	}()
+	// listen before signaling ready, so that clients can connect right away
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		log.Println("Web service listen error:", err)
+	} else {
+		go func() {
+			if err := s.Serve(l); err != nil && err != http.ErrServerClosed {
+				log.Println("Web service serve error:", err)
+			}
+		}()
+	}
 
 	ready <- struct{}{} // signal that the server is ready
 
@@ -142,7 +564,7 @@ func Serve(ctx context.Context, wg *sync.WaitGroup, ph *engine.ProcessHunter, ve
 	log.Println("Web service shutting down")
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	err := s.Shutdown(ctx)
+	err = s.Shutdown(ctx)
 	if err != nil {
 		log.Println("Web service shut down error:", err)
 	} else {
@@ -1,11 +1,13 @@
 package server
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"sync"
 	"testing"
@@ -14,10 +16,25 @@ import (
 	"github.com/ventsip/ph/engine"
 )
 
+// TestMain runs the tests in a temporary directory, where Serve writes the setup code
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "ph-server")
+	if err == nil {
+		err = os.Chdir(dir)
+	}
+	if err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 // some test configuration
 // don't use tabs - only spaces; otherwise the some string comparisons may fail
 const cfg = `[
     {
+        "id": "non.existing.process.name.with",
         "processes": [
             "non.existing.process.name.with"
         ],
@@ -85,9 +102,172 @@ func TestPutConfigHandler(t *testing.T) {
 	}
 }
 
+func TestPutDiscoveryHandler(t *testing.T) {
+	ph := engine.NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(cfg))
+	if err != nil {
+		t.Fatal("Could not set config:", cfg)
+	}
+
+	h := http.Handler(discovery(ph))
+	rec := httptest.NewRecorder()
+	r, err := http.NewRequest("PUT", "/discovery", strings.NewReader(`{"process": "new.game", "group": "non.existing.process.name.with"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rec.Code, http.StatusCreated)
+	}
+
+	l := ph.GetLimits()
+	if len(l[0].PG) != 2 || l[0].PG[1] != "new.game" {
+		t.Error("Process was not added to the group")
+	}
+}
+
+func TestPutGrantsHandler(t *testing.T) {
+	ph := engine.NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(cfg))
+	if err != nil {
+		t.Fatal("Could not set config:", cfg)
+	}
+
+	h := http.Handler(grants(ph))
+	rec := httptest.NewRecorder()
+	r, err := http.NewRequest("PUT", "/grants", strings.NewReader(`{"group": "non.existing.process.name.with", "duration": "30m"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rec.Code, http.StatusCreated)
+	}
+	if g := ph.GetGrants(); len(g) != 1 || g[0].Group != "non.existing.process.name.with" {
+		t.Error("Grant was not added", g)
+	}
+
+	rec = httptest.NewRecorder()
+	r, err = http.NewRequest("PUT", "/grants", strings.NewReader(`{"group": "non.existing.process.name.with", "duration": "30"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestControlHandlers(t *testing.T) {
+	ph := engine.NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	err := ph.SetConfig([]byte(cfg))
+	if err != nil {
+		t.Fatal("Could not set config:", cfg)
+	}
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("PUT", "/blocks", strings.NewReader(`{"group": "non.existing.process.name.with", "duration": "1h"}`))
+	blocks(ph).ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rec.Code, http.StatusOK)
+	}
+	if b := ph.GetBlocks(); len(b) != 1 {
+		t.Error("Group was not blocked", b)
+	}
+
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/lockdown", strings.NewReader(`{"until": "2000-01-01T00:00:00Z"}`))
+	lockdown(ph).ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rec.Code, http.StatusBadRequest)
+	}
+
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/vacation", strings.NewReader(`{"duration": "48h"}`))
+	vacation(ph).ServeHTTP(rec, r)
+	var c engine.Controls
+	if err := json.Unmarshal(rec.Body.Bytes(), &c); err != nil || c.Vacation == nil || len(c.Blocks) != 1 {
+		t.Error("unexpected controls", c, err)
+	}
+
+	request(vacation(ph), "DELETE", "/vacation", "", "")
+	rec = request(blocks(ph), "DELETE", "/blocks?group=non.existing.process.name.with", "", "")
+	var cleared engine.Controls
+	if err := json.Unmarshal(rec.Body.Bytes(), &cleared); err != nil || cleared.Vacation != nil || len(cleared.Blocks) != 0 {
+		t.Error("unexpected controls", cleared, err)
+	}
+}
+
+func TestRequestsHandler(t *testing.T) {
+	a := testRoles(t)
+	if err := a.ph.SetConfig([]byte(cfg)); err != nil {
+		t.Fatal("Could not set config:", cfg)
+	}
+	h := a.authorize(permView, permView, timeRequests(a.ph))
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/requests", strings.NewReader(`{"user": "bob", "group": "non.existing.process.name.with", "duration": "30m", "reason": "homework"}`))
+	r.Header.Set("Authorization", basic("alice", "s3cr3t pass"))
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rec.Code, http.StatusCreated)
+	}
+	var tr engine.TimeRequest
+	if err := json.Unmarshal(rec.Body.Bytes(), &tr); err != nil || tr.User != "alice" || tr.Status != engine.RequestPending {
+		t.Error("unexpected request", tr, err)
+	}
+
+	deny := a.authorize(ScopeRead, ScopeGrant, decideRequest(a.ph, false))
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/requests/deny", strings.NewReader(`{"id": "`+tr.ID+`"}`))
+	r.Header.Set("Authorization", basic("alice", "s3cr3t pass"))
+	deny.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Error("viewer decided a request", rec.Code)
+	}
+
+	approve := a.authorize(ScopeRead, ScopeGrant, decideRequest(a.ph, true))
+	rec = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/requests/approve", strings.NewReader(`{"id": "`+tr.ID+`", "note": "ok"}`))
+	r.Header.Set("Authorization", basic("parent", "s3cr3t pass"))
+	approve.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rec.Code, http.StatusOK)
+	}
+	if g := a.ph.GetGrants(); len(g) != 1 || g[0].Group != "non.existing.process.name.with" {
+		t.Error("Grant was not added", g)
+	}
+
+	rec = request(h, "GET", "/requests?user=bob", "Authorization", basic("alice", "s3cr3t pass"))
+	var requests []engine.TimeRequest
+	if err := json.Unmarshal(rec.Body.Bytes(), &requests); err != nil || len(requests) != 1 ||
+		requests[0].Status != engine.RequestApproved || requests[0].DecidedBy != "parent" {
+		t.Error("unexpected requests", requests, err)
+	}
+}
+
+func TestGetDiscoveryBadDate(t *testing.T) {
+	ph := engine.NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+
+	h := http.Handler(discovery(ph))
+	rec := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/discovery?from=yesterday", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			rec.Code, http.StatusBadRequest)
+	}
+}
+
 func TestAuthPutHandler(t *testing.T) {
 	called := false
-	h := http.Handler(authPut(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+	h := http.Handler(testAuth(t).authorize(ScopeRead, ScopeConfig, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
 		called = true
 	})))
 	rec := httptest.NewRecorder()
@@ -113,7 +293,7 @@ func TestAuthPutHandler(t *testing.T) {
 }
 func TestAuthPutBadCredentials(t *testing.T) {
 	called := false
-	h := http.Handler(authPut(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+	h := http.Handler(testAuth(t).authorize(ScopeRead, ScopeConfig, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
 		called = true
 	})))
 	rec := httptest.NewRecorder()
@@ -140,14 +320,14 @@ func TestAuthPutBadCredentials(t *testing.T) {
 
 func TestAuthPutGoodCredentials(t *testing.T) {
 	called := false
-	h := http.Handler(authPut(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+	h := http.Handler(testAuth(t).authorize(ScopeRead, ScopeConfig, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
 		called = true
 	})))
 	r, err := http.NewRequest("PUT", "not relevant", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	r.SetBasicAuth("time", "k33p3rs")
+	r.SetBasicAuth("parent", "s3cr3t pass")
 	rec := httptest.NewRecorder()
 
 	h.ServeHTTP(rec, r)
@@ -245,6 +425,27 @@ func TestSimpleGetProcessBalance(t *testing.T) {
 	quickTestGetJSON(t, "http://localhost:8080/processbalance", "application/json; charset=utf-8")
 }
 
+func TestSimpleGetUserBalance(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/groupbalance?user=nobody", "application/json; charset=utf-8")
+	quickTestGetJSON(t, "http://localhost:8080/processbalance?user=nobody", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetSessionBalance(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/sessionbalance?user=nobody", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetEvents(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/events", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetWebhooks(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/webhooks", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetUsers(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/users", "application/json; charset=utf-8")
+}
+
 func TestSimpleGetVersion(t *testing.T) {
 	quickTestGetJSON(t, "http://localhost:8080/version", "text/plain; charset=utf-8")
 }
@@ -252,3 +453,106 @@ func TestSimpleGetVersion(t *testing.T) {
 func TestSimpleGetBalance(t *testing.T) {
 	quickTestGetJSON(t, "http://localhost:8080/balance", "application/json; charset=utf-8")
 }
+
+func TestSimpleGetCPU(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/cpu", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetDiscovery(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/discovery", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetAudit(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/audit", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetGrants(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/grants", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetBlocks(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/blocks", "application/json; charset=utf-8")
+}
+
+func TestSimpleGetRequests(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/requests", "application/json; charset=utf-8")
+}
+
+func TestEventStream(t *testing.T) {
+	ph := engine.NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+	srv := httptest.NewServer(eventStream(ph))
+	defer srv.Close()
+
+	r, err := http.Get(srv.URL + "?user=nobody")
+	if err != nil {
+		t.Fatal("Error calling", srv.URL)
+	}
+	defer r.Body.Close()
+	if ctype := r.Header.Get("Content-Type"); ctype != "text/event-stream" {
+		t.Errorf("content type header does not match: got %v want %v", ctype, "text/event-stream")
+	}
+
+	rd := bufio.NewReader(r.Body)
+	next := func() engine.Snapshot {
+		var s engine.Snapshot
+		for {
+			line, err := rd.ReadString('\n')
+			if err != nil {
+				t.Fatal("Cannot read event stream:", err)
+			}
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				if err := json.Unmarshal([]byte(data), &s); err != nil {
+					t.Fatal("Cannot unmarshal snapshot:", err)
+				}
+				return s
+			}
+		}
+	}
+
+	if s := next(); s.Reason != "initial" {
+		t.Error("expected the initial snapshot, got", s.Reason)
+	}
+
+	if err := ph.SetConfig([]byte(cfg)); err != nil {
+		t.Fatal("Could not set config:", err)
+	}
+	if s := next(); s.Reason != engine.UpdateConfig || len(s.Config.Groups) != 1 {
+		t.Error("expected a snapshot with the new config, got", s.Reason, s.Config)
+	}
+}
+
+func TestSimpleGetMetrics(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/metrics", "text/plain; version=0.0.4; charset=utf-8")
+}
+
+func TestHealthzHandler(t *testing.T) {
+	ph := engine.NewProcessHunter(time.Hour, "", time.Hour, nil, "")
+
+	rec := httptest.NewRecorder()
+	healthz(ph).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Error("unexpected health", rec.Code, rec.Body.String())
+	}
+
+	ph = engine.NewProcessHunter(time.Hour, "", time.Hour, nil, "missing.json")
+	ph.LoadConfig()
+	rec = httptest.NewRecorder()
+	healthz(ph).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "configuration") {
+		t.Error("unexpected health with a missing config file", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	status(ph, "test").ServeHTTP(rec, httptest.NewRequest("GET", "/status", nil))
+	var st map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal("Cannot unmarshal status:", err)
+	}
+	if st["healthy"] != false || st["version"] != "test" || st["config_path"] != "missing.json" || len(st["problems"].([]any)) != 1 {
+		t.Error("unexpected status", st)
+	}
+}
+
+func TestSimpleGetStatus(t *testing.T) {
+	quickTestGetJSON(t, "http://localhost:8080/status", "application/json; charset=utf-8")
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// UsersFile is the file that holds the users and the API tokens
+const UsersFile = "users.json"
+
+// SetupCodeFile is the file, next to the users file, of the one-time code that sets the first password through the web UI
+const SetupCodeFile = "setup-code.txt"
+
+// minPasswordLength is the minimum length of a password
+const minPasswordLength = 8
+
+// Roles of the users and the tokens
+const (
+	RoleAdmin  = "admin"  // the parent: edits the configuration, grants time and views everything
+	RoleViewer = "viewer" // a child: views the remaining time of the groups of the OS user with the same name
+	RoleToken  = "token"  // a script: can do what the scopes of its token allow
+)
+
+// Scopes of the API tokens
+const (
+	ScopeRead   = "read"   // view everything
+	ScopeGrant  = "grant"  // grant more time
+	ScopeConfig = "config" // edit the configuration
+)
+
+// User is a user of the web UI and the API
+type User struct {
+	Name string `json:"name"`           // Name is the username; the name of the OS user for viewers
+	Hash string `json:"hash"`           // Hash is the bcrypt hash of the password
+	Role string `json:"role,omitempty"` // Role is RoleAdmin or RoleViewer (RoleAdmin if empty)
+}
+
+// Token is an API token for scripts
+type Token struct {
+	ID      string     `json:"id"`                // ID identifies the token, and is the first part of the token
+	Name    string     `json:"name"`              // Name describes what the token is for
+	Hash    string     `json:"hash,omitempty"`    // Hash is the SHA-256 hash of the secret part of the token
+	Scopes  []string   `json:"scopes"`            // Scopes lists what the token allows, e.g. ScopeRead
+	Created time.Time  `json:"created"`           // Created is when the token was created
+	Revoked *time.Time `json:"revoked,omitempty"` // Revoked is when the token was revoked, if it was
+}
+
+// usersFile is the representation of the users file
+type usersFile struct {
+	Users  []User  `json:"users"`
+	Tokens []Token `json:"tokens,omitempty"`
+}
+
+// userStore holds the users of the web UI and the API, and the API tokens, stored in a file
+type userStore struct {
+	mu     sync.RWMutex
+	path   string
+	users  []User
+	tokens []Token
+}
+
+// loadUsers loads the users from the file at path. There are no users if the file doesn't exist.
+func loadUsers(path string) (*userStore, error) {
+	u := &userStore{path: path}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return u, nil
+	}
+	if err != nil {
+		return u, err
+	}
+
+	var f usersFile
+	err = json.Unmarshal(b, &f)
+	u.users, u.tokens = f.Users, f.Tokens
+	return u, err
+}
+
+// save writes the users to their file, readable by the owner only. u.mu must be locked by the caller.
+func (u *userStore) save() error {
+	b, err := json.MarshalIndent(usersFile{Users: u.users, Tokens: u.tokens}, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(u.path, b, 0600)
+}
+
+// empty returns true if there are no users, i.e. no password has been set yet
+func (u *userStore) empty() bool {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	return len(u.users) == 0
+}
+
+// errPasswordSet is returned when setting the first password, but a password is already set
+var errPasswordSet = errors.New("password already set")
+
+// hashPassword validates user name and password, and returns the hash of password
+func hashPassword(name, password string) ([]byte, error) {
+	if name == "" {
+		return nil, errors.New("username cannot be empty")
+	}
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters long", minPasswordLength)
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+// setPassword sets the password of user name, adding the user with role if necessary, and saves the users.
+// The role of an existing user changes only if role is not empty.
+func (u *userStore) setPassword(name, password, role string) error {
+	if role != "" && role != RoleAdmin && role != RoleViewer {
+		return fmt.Errorf("unknown role %s", role)
+	}
+	hash, err := hashPassword(name, password)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.set(name, hash, role)
+}
+
+// setFirstPassword sets the password of admin name, unless a password is already set
+func (u *userStore) setFirstPassword(name, password string) error {
+	hash, err := hashPassword(name, password)
+	if err != nil {
+		return err
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.users) > 0 {
+		return errPasswordSet
+	}
+	return u.set(name, hash, RoleAdmin)
+}
+
+// set sets the password hash of user name, adding the user if necessary, and saves the users.
+// The role is set if not empty. u.mu must be locked by the caller.
+func (u *userStore) set(name string, hash []byte, role string) error {
+	i := slices.IndexFunc(u.users, func(usr User) bool { return usr.Name == name })
+	if i < 0 {
+		u.users = append(u.users, User{Name: name, Role: RoleAdmin})
+		i = len(u.users) - 1
+	}
+	u.users[i].Hash = string(hash)
+	if role != "" {
+		u.users[i].Role = role
+	}
+
+	return u.save()
+}
+
+// user returns user name, if it exists
+func (u *userStore) user(name string) (User, bool) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	i := slices.IndexFunc(u.users, func(usr User) bool { return usr.Name == name })
+	if i < 0 {
+		return User{}, false
+	}
+	return u.users[i], true
+}
+
+// dummyHash is compared to the passwords of unknown users, so that they take as long to check as those of known users
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// authenticate returns user name, if password is its password
+func (u *userStore) authenticate(name, password string) (User, bool) {
+	usr, ok := u.user(name)
+	hash := dummyHash
+	if ok {
+		hash = []byte(usr.Hash)
+	}
+
+	return usr, bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil && ok
+}
+
+// hashSecret returns the hash of the secret part of a token
+func hashSecret(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// addToken adds a token with name and scopes, saves it, and returns it with the token to use ("id.secret").
+// Only the hash of the secret is stored, so the token cannot be retrieved later.
+func (u *userStore) addToken(name string, scopes []string) (Token, string, error) {
+	if len(scopes) == 0 {
+		return Token{}, "", errors.New("token must have scopes")
+	}
+	for _, s := range scopes {
+		if s != ScopeRead && s != ScopeGrant && s != ScopeConfig {
+			return Token{}, "", fmt.Errorf("unknown scope %s", s)
+		}
+	}
+	id, err := randomHex(4)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	t := Token{ID: id, Name: name, Hash: hashSecret(secret), Scopes: scopes, Created: time.Now()}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.tokens = append(u.tokens, t)
+	if err := u.save(); err != nil {
+		u.tokens = u.tokens[:len(u.tokens)-1]
+		return Token{}, "", err
+	}
+
+	t.Hash = ""
+	return t, id + "." + secret, nil
+}
+
+// revokeToken revokes token id, and saves the tokens
+func (u *userStore) revokeToken(id string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	i := slices.IndexFunc(u.tokens, func(t Token) bool { return t.ID == id })
+	if i < 0 {
+		return fmt.Errorf("token %s not found", id)
+	}
+	if u.tokens[i].Revoked == nil {
+		now := time.Now()
+		u.tokens[i].Revoked = &now
+	}
+
+	return u.save()
+}
+
+// getTokens returns the tokens, without their hashes
+func (u *userStore) getTokens() []Token {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	tokens := make([]Token, len(u.tokens))
+	for i, t := range u.tokens {
+		t.Hash = ""
+		tokens[i] = t
+	}
+	return tokens
+}
+
+// authenticateToken returns the token of tok ("id.secret"), if it's valid and not revoked
+func (u *userStore) authenticateToken(tok string) (Token, bool) {
+	id, secret, ok := strings.Cut(tok, ".")
+	if !ok {
+		return Token{}, false
+	}
+
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	i := slices.IndexFunc(u.tokens, func(t Token) bool { return t.ID == id })
+	if i < 0 || u.tokens[i].Revoked != nil {
+		return Token{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(u.tokens[i].Hash), []byte(hashSecret(secret))) != 1 {
+		return Token{}, false
+	}
+	return u.tokens[i], true
+}
+
+// Passwd sets the password of a user in the users file at path, reading the new password twice from in
+// (without echo, when in is a terminal), and prompting for it on out. args are the name of the user ("parent" by default)
+// and, optionally, the role of the user (RoleAdmin for new users by default).
+func Passwd(path string, args []string, in io.Reader, out io.Writer) error {
+	name, role := "parent", ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if len(args) > 1 {
+		role = args[1]
+	}
+
+	read := readLine(in, out)
+	var passwords [2]string
+	for i, prompt := range []string{"New password for " + name + ": ", "Repeat the password: "} {
+		fmt.Fprint(out, prompt)
+		p, err := read()
+		if err != nil {
+			return err
+		}
+		passwords[i] = p
+	}
+	if passwords[0] != passwords[1] {
+		return errors.New("the passwords don't match")
+	}
+
+	u, err := loadUsers(path)
+	if err != nil {
+		return err
+	}
+	return u.setPassword(name, passwords[0], role)
+}
+
+// readLine returns a function that reads a line from in. The lines are read without echo when in is a terminal,
+// and the newline typed by the user is written to out instead.
+func readLine(in io.Reader, out io.Writer) func() (string, error) {
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		return func() (string, error) {
+			b, err := term.ReadPassword(int(f.Fd()))
+			fmt.Fprintln(out)
+			return string(b), err
+		}
+	}
+
+	s := bufio.NewScanner(in)
+	return func() (string, error) {
+		if !s.Scan() {
+			return "", errors.New("no password entered")
+		}
+		return s.Text(), nil
+	}
+}
+
+// SetPassword sets the password of user name in the users file at path, adding the user as admin if necessary
+func SetPassword(path, name, password string) error {
+	u, err := loadUsers(path)
+	if err != nil {
+		return err
+	}
+	return u.setPassword(name, password, "")
+}
@@ -2,6 +2,89 @@
 const refreshPeriod = 60000;
 
 var dataConfig = {}; // loaded data
+var dataGroupBalance = []; // loaded balance of process groups
+var selectedUser = ""; // user selected in the user switcher, "" for all users
+var role = ""; // role of the logged in user: "admin", "viewer" or "token"
+var stream = null; // the event stream of snapshots, null while polling
+var polling = []; // the intervals that poll the config and the balance, while the event stream is not available
+
+// requestSetup shows the setup dialog, if the password has not been set yet
+function requestSetup() {
+    $.getJSON('/setup', (d, s) => {
+        if (s == "success" && d.required) {
+            $('#phid_setup').css({
+                display: 'block'
+            });
+        }
+    });
+}
+
+function saveSetup() {
+    let password = $('#phid_setup_password').val();
+    if (password != $('#phid_setup_repeat').val()) {
+        alert("The passwords don't match");
+        return;
+    }
+    $.ajax({
+        url: '/setup',
+        type: 'PUT',
+        contentType: 'application/json',
+        data: JSON.stringify({
+            username: $('#phid_setup_user').val(),
+            password: password,
+            code: $('#phid_setup_code').val().trim()
+        }),
+        success: (r, s) => {
+            $('#phid_setup').css({
+                display: 'none'
+            });
+        },
+        error: (x, s, r) => {
+            alert(r + ":\n" + x.responseText);
+        }
+    })
+}
+
+// ajaxError asks to log in or to set the password, if necessary, and shows the other errors
+function ajaxError(x, s, r) {
+    if (x.status == 401) {
+        showLogin();
+    } else if (x.status == 403 && x.responseText.startsWith("Set the password")) {
+        requestSetup();
+    } else {
+        alert(r + ":\n" + x.responseText);
+    }
+}
+
+function showLogin() {
+    $('#phid_login').css({
+        display: 'block'
+    });
+}
+
+function login() {
+    $.ajax({
+        url: '/login',
+        type: 'POST',
+        contentType: 'application/json',
+        data: JSON.stringify({
+            username: $('#phid_login_user').val(),
+            password: $('#phid_login_password').val()
+        }),
+        success: (r, s) => {
+            location.reload();
+        },
+        error: (x, s, r) => {
+            alert(r + ":\n" + x.responseText);
+        }
+    })
+}
+
+function logout() {
+    $.post('/logout').always(() => {
+        location.reload();
+    });
+}
 
 function editConfig() {
     $('#phid_edit_config').css({
@@ -21,20 +104,24 @@ function saveConfig() {
             $('#phid_edit_config').css({
                 display: 'none'
             });
-            requestCfg();
-            requestProcessGroupBalance();
-            requestProcessBalance();
+            if (!stream) {
+                requestCfg();
+                requestProcessGroupBalance();
+                requestProcessBalance();
+            }
         },
-        error: (x, s, r) => {
-            alert(r + ":\n" + x.responseText);
-        }
+        error: ajaxError
     })
 }
 
+function showData(d, rootID, processData) {
+    processData(d, $('#' + $.escapeSelector(rootID)).html(""));
+}
+
 function requestData(ep, rootID, processData) {
     $.getJSON(ep, (d, s) => {
         if (s == "success") {
-            processData(d, $('#' + $.escapeSelector(rootID)).html(""));
+            showData(d, rootID, processData);
         } else {
             $('#' + $.escapeSelector(rootID)).text("Error retrieving data");
         }
@@ -95,19 +182,74 @@ function registerHover(e, name) {
 function processList(processes) {
     let c = $('<div></div>')
 
-    processes.forEach(proc => {
-        c.append(registerHover($('<p class="w3-round w3-bar-item w3-margin w3-tag"></p>').text(proc), proc));
+    (processes || []).forEach(proc => {
+        // a process is either a name, or an object with the name and its own limits and downtime
+        if (typeof proc === 'string') {
+            c.append(registerHover($('<p class="w3-round w3-bar-item w3-margin w3-tag"></p>').text(proc), proc));
+        } else {
+            c.append(
+                registerHover($('<div class="w3-round w3-bar-item w3-margin w3-tag w3-tooltip"></div>').text(proc.name + ' *'), proc.name).append(
+                    $('<div class="w3-text w3-white w3-card" style="position:absolute;z-index:1"></div>').append(
+                        proc.limits ? genLimits(proc.limits) : '',
+                        proc.downtime ? genDowntime(proc.downtime) : ''
+                    )
+                )
+            );
+        }
     });
 
     return c;
 }
 
+// configGroups returns the process groups of the configuration,
+// which is either an array of process groups, or an object with process groups in "groups"
+// and the process groups of each user in "profiles"
+function configGroups(cfg) {
+    let groups = (Array.isArray(cfg) ? cfg : cfg.groups) || [];
+    if (!Array.isArray(cfg)) {
+        (cfg.profiles || []).forEach(pr => {
+            (pr.groups || []).forEach(g => {
+                groups = groups.concat($.extend({}, g, { users: [pr.user] }));
+            });
+        });
+    }
+    return groups;
+}
+
+// userQuery returns the query string that limits a request to the selected user
+function userQuery() {
+    return selectedUser ? '?user=' + encodeURIComponent(selectedUser) : '';
+}
+
+// groupHeader generates the header of a process group card, with the group's name, description and color
+function groupHeader(g, cls) {
+    let h = $('<header class="w3-container w3-bar"></header>').addClass(cls);
+
+    if (g.color) {
+        h.css({ 'background-color': g.color });
+    }
+    if (g.name) {
+        h.append($('<h3 class="w3-bar-item"></h3>').text(g.name));
+    }
+    if (g.enabled === false) {
+        h.append($('<span class="w3-bar-item w3-tag w3-grey">disabled</span>'));
+    }
+    if (g.description) {
+        h.append($('<p class="w3-bar-item"></p>').text(g.description));
+    }
+    (g.users || []).forEach(u => {
+        h.append($('<span class="w3-bar-item w3-tag w3-indigo"></span>').text(u));
+    });
+
+    return h.append(processList(g.processes));
+}
+
 function processConfig(data, root) {
     dataConfig = data;
-    data.forEach(dtl => {
+    configGroups(data).filter(g => !selectedUser || !g.users || g.users.includes(selectedUser)).forEach(dtl => {
         root.append(
             $('<div class="w3-card w3-margin" style="float:left"></div>').append(
-                $('<header class="w3-container w3-blue w3-bar"></header>').append(processList(dtl.processes)),
+                groupHeader(dtl, 'w3-blue'),
                 $('<div class="w3-margin" style="float:left"></div>').append(genLimits(dtl.limits)),
                 $('<div class="w3-margin" style="float:left"></div>').append(genDowntime(dtl.downtime))
             )
@@ -226,20 +368,255 @@ function genDowntimeLine(dnts, ts) {
 }
 
 
-function processPGB(data, root) {
-    data.forEach(pgb => {
+// timeOf returns the local time (HH:MM) of the JSON time t
+function timeOf(t) {
+    return new Date(t).toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+}
+
+// untilOf returns the local time of the JSON time t, with the date if t is not today
+function untilOf(t) {
+    let d = new Date(t);
+    if (d.toDateString() == new Date().toDateString()) {
+        return timeOf(t);
+    }
+    return d.toLocaleString([], { dateStyle: 'short', timeStyle: 'short' });
+}
+
+const blockReasons = { manual: 'blocked manually', lockdown: 'lockdown', limit: 'time limit reached', downtime: 'downtime' };
+
+// genBlockedBy shows which group (this one, or a parent group) triggers enforcement, and why
+function genBlockedBy(pgb) {
+    let c = $('<div></div>');
+
+    if (pgb.suspended_until) {
+        c.append($('<span class="w3-tag w3-teal w3-margin-right"></span>').text('Vacation until ' + untilOf(pgb.suspended_until)));
+    }
+    if (pgb.blocked_by) {
+        let reason = pgb.blocked_by == pgb.id ? 'Blocked' : 'Blocked by ' + pgb.blocked_by;
+        if (pgb.block_reason) {
+            reason += ': ' + (blockReasons[pgb.block_reason] || pgb.block_reason);
+        }
+        if (pgb.blocked_until && pgb.blocked_by == pgb.id) {
+            reason += ' until ' + untilOf(pgb.blocked_until);
+        }
+        c.append($('<span class="w3-tag w3-red"></span>').text(reason));
+    }
+    (pgb.blocked_processes || []).forEach(p => {
+        c.append($('<span class="w3-tag w3-orange w3-margin-left"></span>').text(p + ' blocked by its own limits'));
+    });
+    if (pgb.granted_until) {
+        c.append($('<span class="w3-tag w3-green w3-margin-right"></span>').text('Granted until ' + timeOf(pgb.granted_until)));
+    }
+    if (pgb.blocked_at) {
+        c.append($('<span class="w3-tag w3-amber"></span>').text('Blocked at ' + timeOf(pgb.blocked_at)));
+    }
+
+    return c;
+}
+
+// genPGB generates the card of process group pgb, followed by the cards of its child groups (indented)
+function genPGB(pgb, byID, depth, root) {
+    root.append(
+        $('<div class="w3-card w3-margin"></div>').css({ 'margin-left': (16 + depth * 48) + 'px' }).append(
+            groupHeader(pgb, 'w3-light-blue'),
+            $('<div class="w3-container w3-margin"></div>').append(genLimitAndBalance(pgb.limit, pgb.limit_defined, pgb.balance)),
+            $('<div class="w3-container w3-margin"></div>').append(genDowntimeLine(pgb.downtime, pgb.timestamp)),
+            $('<div class="w3-container w3-margin"></div>').append(genBlockedBy(pgb), genRequestButton(pgb), genBlockButton(pgb))
+        )
+    );
+
+    (pgb.children || []).forEach(id => {
+        if (byID[id]) {
+            genPGB(byID[id], byID, depth + 1, root);
+        }
+    });
+}
+
+// genBlockButton generates the button of admins to block group pgb manually, or to unblock it
+function genBlockButton(pgb) {
+    if (role == "viewer" || !pgb.enabled) {
+        return null;
+    }
+    if (pgb.blocked_until && pgb.block_reason == "manual" && pgb.blocked_by == pgb.id) {
+        return $('<button class="w3-button w3-small w3-green w3-margin-top">Unblock</button>').on('click', () => {
+            setControl('/blocks?group=' + encodeURIComponent(pgb.id), 'DELETE');
+        });
+    }
+    return $('<button class="w3-button w3-small w3-red w3-margin-top">Block...</button>').on('click', () => {
+        let duration = prompt("Block " + pgb.id + " for how long?", "2h");
+        if (duration) {
+            setControl('/blocks', 'PUT', { group: pgb.id, duration: duration });
+        }
+    });
+}
+
+// setControl blocks or unblocks a group, or starts or ends the lockdown or the vacation, at the endpoint url
+function setControl(url, method, data) {
+    $.ajax({
+        url: url,
+        type: method,
+        contentType: 'application/json',
+        data: data ? JSON.stringify(data) : null,
+        success: (r, s) => {
+            if (!stream) {
+                requestProcessGroupBalance();
+            }
+        },
+        error: ajaxError
+    })
+}
+
+// startControl asks for how long, and starts the lockdown or the vacation at the endpoint url
+function startControl(url, question) {
+    let duration = prompt(question, "24h");
+    if (duration) {
+        setControl(url, 'PUT', { duration: duration });
+    }
+}
+
+// processControls shows whether the groups are locked down, or on vacation, with the buttons to start or end these
+function processControls(data) {
+    let root = $('#phid_controls').html("");
+    let locked = data.find(pgb => pgb.block_reason == "lockdown" && pgb.blocked_by == pgb.id);
+    let vacation = data.find(pgb => pgb.suspended_until);
+
+    if (locked) {
         root.append(
-            $('<div class="w3-card w3-margin" style="float:left"></div>').append(
-                $('<header class="w3-container w3-light-blue w3-bar"></header>').append(processList(pgb.processes)),
-                $('<div class="w3-container w3-margin"></div>').append(genLimitAndBalance(pgb.limit, pgb.limit_defined, pgb.balance)),
-                $('<div class="w3-container w3-margin"></div>').append(genDowntimeLine(pgb.downtime, pgb.timestamp))
+            $('<span class="w3-tag w3-red w3-margin-right"></span>').text('Lockdown until ' + untilOf(locked.blocked_until)),
+            $('<button class="w3-button w3-small w3-green w3-margin-right">End lockdown</button>').on('click', () => setControl('/lockdown', 'DELETE'))
+        );
+    } else {
+        root.append($('<button class="w3-button w3-small w3-red w3-margin-right">Lockdown...</button>').on('click', () => {
+            startControl('/lockdown', "Block all the groups for how long?");
+        }));
+    }
+    if (vacation) {
+        root.append(
+            $('<span class="w3-tag w3-teal w3-margin-right"></span>').text('Vacation until ' + untilOf(vacation.suspended_until)),
+            $('<button class="w3-button w3-small w3-red">End vacation</button>').on('click', () => setControl('/vacation', 'DELETE'))
+        );
+    } else {
+        root.append($('<button class="w3-button w3-small w3-teal">Vacation...</button>').on('click', () => {
+            startControl('/vacation', "Suspend all the limits for how long?");
+        }));
+    }
+}
+
+// genRequestButton generates the button of viewers to request more time for group pgb
+function genRequestButton(pgb) {
+    if (role != "viewer") {
+        return null;
+    }
+    return $('<button class="w3-button w3-small w3-blue w3-margin-top">Request more time</button>').on('click', () => requestTime(pgb.id));
+}
+
+function requestTime(group) {
+    let duration = prompt("How much more time do you need for " + group + "?", "30m");
+    if (!duration) {
+        return;
+    }
+    let reason = prompt("Why do you need it?", "");
+    if (reason === null) {
+        return;
+    }
+    $.ajax({
+        url: '/requests' + userQuery(),
+        type: 'POST',
+        contentType: 'application/json',
+        data: JSON.stringify({ group: group, duration: duration, reason: reason }),
+        success: (r, s) => {
+            requestRequests();
+        },
+        error: ajaxError
+    })
+}
+
+// decideRequest approves or denies request r, with an optional note. The approved time is granted to the whole group.
+function decideRequest(r, approve) {
+    let note = prompt(approve ? "Approve the request - the time is granted to " + r.group + " for all its users (note):" : "Deny the request (note):", "");
+    if (note === null) {
+        return;
+    }
+    $.ajax({
+        url: approve ? '/requests/approve' : '/requests/deny',
+        type: 'POST',
+        contentType: 'application/json',
+        data: JSON.stringify({ id: r.id, note: note }),
+        success: (r, s) => {
+            requestRequests();
+        },
+        error: ajaxError
+    })
+}
+
+const requestColors = { pending: 'w3-amber', approved: 'w3-green', denied: 'w3-red', expired: 'w3-grey' };
+
+// processRequests lists the requests for more time, latest first, with the buttons to decide the pending ones
+function processRequests(data, root) {
+    if (!data.length) {
+        root.text("No requests");
+        return;
+    }
+
+    let t = $('<table class="w3-table w3-bordered"></table>').append(
+        $('<tr></tr>').append(
+            ['Time', 'User', 'Group', 'Duration', 'Reason', 'Status', ''].map(h => $('<th></th>').text(h))
+        )
+    );
+    data.forEach(r => {
+        let status = $('<td></td>').append($('<span class="w3-tag"></span>').addClass(requestColors[r.status]).text(r.status));
+        if (r.decided_by) {
+            status.append($('<span class="w3-margin-left"></span>').text('by ' + r.decided_by + (r.note ? ': ' + r.note : '')));
+        }
+        let actions = $('<td></td>');
+        if (r.status == "pending" && role != "viewer") {
+            actions.append(
+                $('<button class="w3-button w3-small w3-green">Approve</button>').on('click', () => decideRequest(r, true)),
+                $('<button class="w3-button w3-small w3-red w3-margin-left">Deny</button>').on('click', () => decideRequest(r, false))
+            );
+        }
+        t.append(
+            $('<tr></tr>').append(
+                $('<td></td>').text(new Date(r.created).toLocaleString()),
+                $('<td></td>').text(r.user),
+                $('<td></td>').text(r.group),
+                $('<td></td>').text(r.duration),
+                $('<td></td>').text(r.reason || ''),
+                status,
+                actions
             )
         );
     });
+
+    root.append(
+        $('<div class="w3-card w3-margin"></div>').append(
+            $('<div class="w3-margin"></div>').append(t)
+        )
+    );
+}
+
+function requestRequests() {
+    requestData('/requests' + userQuery(), 'phid_requests', processRequests);
+}
+
+function processPGB(data, root) {
+    dataGroupBalance = data;
+    processControls(data);
+
+    let byID = {};
+    data.forEach(pgb => {
+        byID[pgb.id] = pgb;
+    });
+
+    data.forEach(pgb => {
+        if (!pgb.parent || !byID[pgb.parent]) {
+            genPGB(pgb, byID, 0, root);
+        }
+    });
 }
 
 function requestProcessGroupBalance() {
-    requestData('/groupbalance', 'phid_groupbalance', processPGB);
+    requestData('/groupbalance' + userQuery(), 'phid_groupbalance', processPGB);
 }
 
 function processProcB(data, root) {
@@ -262,20 +639,244 @@ function processProcB(data, root) {
 }
 
 function requestProcessBalance() {
-    requestData('/processbalance', 'phid_processbalance', processProcB);
+    requestData('/processbalance' + userQuery(), 'phid_processbalance', processProcB);
 }
 
+function addToGroup(process, group) {
+    $.ajax({
+        url: '/discovery',
+        type: 'PUT',
+        contentType: 'application/json',
+        data: JSON.stringify({ process: process, group: group }),
+        success: (r, s) => {
+            requestCfg();
+            requestDiscovery();
+        },
+        error: ajaxError
+    })
+}
 
-$(document).ready(
-    () => {
-        $("#phid_version").load("/version");
+function processDiscovery(data, root) {
+    let t = $('<table class="w3-table w3-bordered"></table>');
+    t.append($('<tr></tr>').append(
+        $('<th>Process</th>'),
+        $('<th>Time (last 7 days)</th>'),
+        $('<th>Days</th>'),
+        $('<th>First seen</th>'),
+        $('<th>Add to group</th>')
+    ));
+
+    data.forEach(dp => {
+        let sel = $('<select class="w3-select"></select>');
+        dataGroupBalance.forEach(g => {
+            sel.append($('<option></option>').val(g.id).text(g.name || g.id));
+        });
+
+        let name = $('<td></td>').text(dp.process);
+        if (dp.new) {
+            name.append($('<span class="w3-tag w3-red w3-margin-left">new</span>'));
+        }
+
+        t.append(
+            $('<tr></tr>').append(
+                name,
+                $('<td></td>').text(dp.balance),
+                $('<td></td>').text(dp.days),
+                $('<td></td>').text(dp.first_seen),
+                $('<td></td>').append(
+                    sel,
+                    $('<button class="w3-button w3-red">Add</button>').click(() => addToGroup(dp.process, sel.val()))
+                )
+            )
+        );
+    });
+
+    root.append(
+        $('<div class="w3-card w3-margin" style="float:left"></div>').append(
+            $('<div class="w3-margin"></div>').append(t)
+        )
+    );
+}
 
+function requestDiscovery() {
+    requestData('/discovery', 'phid_discovery', processDiscovery);
+}
+
+function processAudit(data, root) {
+    data.forEach(ap => {
+        let t = $('<table class="w3-table w3-bordered"></table>');
+        t.append($('<tr></tr>').append($('<th>User</th>'), $('<th>Processes that would be killed</th>')));
+
+        Object.keys(ap.processes).forEach(user => {
+            t.append(
+                $('<tr></tr>').append(
+                    $('<td class="w3-right-align"></td>').text(user),
+                    $('<td></td>').append(processList(ap.processes[user]))
+                )
+            );
+        });
+
+        root.append(
+            $('<div class="w3-card w3-margin" style="float:left"></div>').append(
+                $('<header class="w3-container w3-amber"></header>').append(
+                    $('<h3></h3>').text(ap.group),
+                    $('<p></p>').text('Audited since ' + new Date(ap.since).toLocaleString() +
+                        ', last updated ' + new Date(ap.updated).toLocaleString())
+                ),
+                $('<div class="w3-margin"></div>').append(t)
+            )
+        );
+    });
+}
+
+function requestAudit() {
+    requestData('/audit', 'phid_audit', processAudit);
+}
+
+// processUsers fills the user switcher with the known users, keeping the selected user
+function processUsers(data) {
+    let sel = $('#phid_user').html("").append($('<option value="">All users</option>'));
+    data.forEach(u => {
+        sel.append($('<option></option>').val(u).text(u));
+    });
+    if (selectedUser && !data.includes(selectedUser)) {
+        sel.append($('<option></option>').val(selectedUser).text(selectedUser));
+    }
+    sel.val(selectedUser);
+}
+
+function requestUsers() {
+    $.getJSON('/users', (d, s) => {
+        if (s == "success") {
+            processUsers(d);
+        }
+    });
+}
+
+function startPolling() {
+    if (polling.length) {
+        return;
+    }
+    requestCfg();
+    requestProcessGroupBalance();
+    requestProcessBalance();
+    requestRequests();
+    polling = [
+        setInterval("requestCfg();", refreshPeriod),
+        setInterval("requestProcessGroupBalance();", refreshPeriod),
+        setInterval("requestProcessBalance();", refreshPeriod),
+        setInterval("requestRequests();", refreshPeriod)
+    ];
+}
+
+function stopPolling() {
+    polling.forEach(clearInterval);
+    polling = [];
+}
+
+// openStream shows the snapshots of the event stream as they arrive,
+// and falls back to polling if the browser or the server doesn't support it
+function openStream() {
+    if (stream) {
+        stream.close();
+        stream = null;
+    }
+    if (!window.EventSource) {
+        startPolling();
+        return;
+    }
+
+    let es = new EventSource('/events/stream' + userQuery());
+    stream = es;
+    es.addEventListener('snapshot', e => {
+        stopPolling();
+        let d = JSON.parse(e.data);
+        showData(d.config, 'phid_config', processConfig);
+        showData(d.groups, 'phid_groupbalance', processPGB);
+        showData(d.processes, 'phid_processbalance', processProcB);
+        requestRequests();
+    });
+    es.onerror = () => {
+        // the browser reconnects, unless the stream is closed; poll in the meantime
+        startPolling();
+        if (es.readyState == EventSource.CLOSED && stream == es) {
+            stream = null;
+        }
+    };
+}
+
+// processStatus shows a banner with the problems, if ph is not healthy
+function processStatus(data) {
+    let b = $('#phid_health').html("");
+    if (data.healthy) {
+        b.hide();
+        return;
+    }
+    b.append($('<h3>Process Hunter is not healthy</h3>'));
+    (data.problems || []).forEach(p => {
+        b.append($('<p></p>').text(p));
+    });
+    b.show();
+}
+
+function requestStatus() {
+    $.getJSON('/status', (d, s) => {
+        if (s == "success") {
+            processStatus(d);
+        }
+    }).fail(() => {
+        processStatus({ healthy: false, problems: ["The server does not respond"] });
+    });
+}
+
+function selectUser(user) {
+    selectedUser = user;
+    if (stream) {
+        openStream();
+    } else {
         requestCfg();
         requestProcessGroupBalance();
         requestProcessBalance();
+    }
+    requestRequests();
+}
+
+// start shows what the logged in user may see: viewers see the balance of their own groups only
+function start(user) {
+    role = user.role;
+    $('#phid_logout').toggle(!!user.name);
+    if (role == "viewer") {
+        $('.ph-admin').hide();
+        selectedUser = user.name;
+        requestRequests();
+        openStream();
+        return;
+    }
 
-        setInterval("requestCfg();", refreshPeriod);
-        setInterval("requestProcessGroupBalance();", refreshPeriod);
-        setInterval("requestProcessBalance();", refreshPeriod);
+    requestStatus();
+    requestRequests();
+    requestUsers();
+    requestDiscovery();
+    requestAudit();
+    openStream();
+
+    setInterval("requestStatus();", refreshPeriod);
+    setInterval("requestUsers();", refreshPeriod);
+    setInterval("requestDiscovery();", refreshPeriod);
+    setInterval("requestAudit();", refreshPeriod);
+}
+
+$(document).ready(
+    () => {
+        $("#phid_version").load("/version");
+
+        requestSetup();
+        $.getJSON('/whoami', (d, s) => {
+            start(d);
+        }).fail(x => {
+            if (x.status == 401) {
+                showLogin();
+            }
+        });
     }
 );
\ No newline at end of file